@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/analyze"
+	"github.com/ryanmontgomery/MonadsCLI/internal/cli"
+	"github.com/ryanmontgomery/MonadsCLI/internal/document"
+	"github.com/ryanmontgomery/MonadsCLI/internal/settings"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func analyzeCommand() cli.Command {
+	var csvPath string
+	var logsDir string
+	var asJSON bool
+
+	return cli.Command{
+		Name:        "analyze",
+		Description: "List every path through a tree with its worst-case agent calls, and routes past runs never took",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&csvPath, "csv", "", "Path to Lucid CSV export")
+			fs.StringVar(&logsDir, "logs", "", "LOG_DIR whose run directories' short logs (run_<time>/short.json) measure route coverage")
+			fs.BoolVar(&asJSON, "json", false, "Print the analysis as JSON")
+		},
+		Run: func(fs *flag.FlagSet) error {
+			if csvPath == "" {
+				return fmt.Errorf("missing --csv")
+			}
+			data, err := os.ReadFile(csvPath)
+			if err != nil {
+				return fmt.Errorf("read CSV: %w", err)
+			}
+			doc, err := document.TransformFromCSV(data)
+			if err != nil {
+				return fmt.Errorf("transform CSV: %w", err)
+			}
+			if doc.Root == nil {
+				return fmt.Errorf("CSV produced no root node")
+			}
+			effective, err := settings.Effective()
+			if err != nil {
+				return fmt.Errorf("settings: %w", err)
+			}
+			// Tree inputs are not needed: paths and retry limits do not depend on them.
+			defaults := processedDefaultsFromSettings(effective)
+			defaults.LookupEnv = settings.TemplateLookupEnv
+			defaults.LookupEnvMetadata = settings.EnvMetadataLookupEnv(effective)
+			defaults.Metadata = doc.Metadata
+			root := types.NodeToProcessedNodeWithDefaults(doc.Root, defaults)
+			logDir := strings.TrimSpace(effective["LOG_DIR"])
+			if logDir == "" {
+				logDir = "./_monad_logs/"
+			}
+
+			out := struct {
+				analyze.Analysis
+				Coverage *analyze.Coverage `json:"coverage,omitempty"`
+			}{Analysis: analyze.Paths(root, pathGuardFromSettings(effective, logDir))}
+			if logsDir != "" {
+				c, err := analyze.LoadCoverage(root, logsDir, strings.TrimSpace(doc.Title))
+				if err != nil {
+					return fmt.Errorf("read logs: %w", err)
+				}
+				out.Coverage = &c
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(out)
+			}
+			printAnalysis(out.Analysis, out.Coverage)
+			return nil
+		},
+	}
+}
+
+func printAnalysis(a analyze.Analysis, c *analyze.Coverage) {
+	fmt.Printf("%d path(s):\n", len(a.Paths))
+	for _, p := range a.Paths {
+		loop := ""
+		if p.Loop {
+			loop = " (loops back)"
+		}
+		fmt.Printf("  %s%s: up to %d agent call(s)\n", analyze.FormatPath(p.Steps), loop, p.Calls)
+	}
+	if a.Truncated {
+		fmt.Printf("  ... stopped after %d paths\n", analyze.MaxPaths)
+	}
+	if len(a.Paths) > 0 {
+		fmt.Printf("Worst case: %d agent call(s) on %s\n", a.MaxCalls, analyze.FormatPath(a.Paths[a.Worst].Steps))
+	}
+	if c == nil {
+		return
+	}
+	untaken := c.Untaken()
+	fmt.Printf("\nCoverage: %d of %d route(s) taken in %d run(s)", len(c.Routes)-len(untaken), len(c.Routes), c.Logs)
+	if len(c.Skipped) > 0 {
+		fmt.Printf(" (%d log(s) skipped: another chart or a different tree)", len(c.Skipped))
+	}
+	fmt.Println()
+	for _, r := range c.Routes {
+		fmt.Printf("  %-5d %s -[%s]-> %s\n", r.Taken, r.From, r.Route, r.To)
+	}
+	if len(untaken) > 0 {
+		fmt.Println("Never taken:")
+		for _, r := range untaken {
+			fmt.Printf("  %s\n", analyze.FormatPath(append(r.Via, analyze.Step{Node: r.From, Route: r.Route}, analyze.Step{Node: r.To})))
+		}
+	}
+}
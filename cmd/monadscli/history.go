@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/cli"
+	"github.com/ryanmontgomery/MonadsCLI/internal/history"
+	"github.com/ryanmontgomery/MonadsCLI/internal/settings"
+)
+
+func historyCommand() cli.Command {
+	return cli.Command{
+		Name:        "history",
+		Description: "Query the run history: recent runs, flakiest nodes, CLI success rates, slowest steps (runs|nodes|cli|slow)",
+		Run: func(fs *flag.FlagSet) error {
+			args := fs.Args()
+			if len(args) == 0 {
+				args = []string{"runs"}
+			}
+			switch args[0] {
+			case "runs", "nodes", "cli", "slow":
+				return historyReport(args[0], args[1:])
+			default:
+				return fmt.Errorf("unknown history report: %s (want runs, nodes, cli, or slow)", args[0])
+			}
+		},
+	}
+}
+
+func historyReport(report string, args []string) error {
+	fs := flag.NewFlagSet("history "+report, flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	var path, chart, since, period string
+	var limit int
+	var asJSON bool
+	fs.StringVar(&path, "file", "", "History file (default: "+history.FileName+" in the settings directory)")
+	fs.StringVar(&chart, "chart", "", "Only runs of this chart (document title)")
+	fs.StringVar(&since, "since", "", "Only runs started since a date (2026-01-31) or within a duration (30d, 12h)")
+	fs.BoolVar(&asJSON, "json", false, "Print the report as JSON")
+	switch report {
+	case "runs":
+		fs.IntVar(&limit, "limit", 20, "Most recent runs to list (0 = all)")
+	case "slow":
+		fs.IntVar(&limit, "limit", 10, "Slowest steps to list (0 = all)")
+		fs.StringVar(&period, "by", history.PeriodWeek, "Average each step per day, week, or month")
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if path == "" {
+		dir, err := settings.StateDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(dir, history.FileName)
+	}
+	filter := history.Filter{Chart: chart}
+	if since != "" {
+		t, err := parseSince(since, time.Now())
+		if err != nil {
+			return err
+		}
+		filter.Since = t
+	}
+	all, skipped, err := history.Load(path)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s: skipped %d unreadable line(s)\n", path, skipped)
+	}
+	runs := filter.Apply(all)
+
+	var out any
+	switch report {
+	case "runs":
+		if limit > 0 && len(runs) > limit {
+			runs = runs[len(runs)-limit:]
+		}
+		out = runs
+	case "nodes":
+		out = history.ByNode(runs)
+	case "cli":
+		out = history.ByCLI(runs)
+	case "slow":
+		if out, err = history.Slowest(runs, period, limit); err != nil {
+			return err
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+	if len(runs) == 0 {
+		fmt.Fprintln(os.Stdout, "No runs recorded")
+		return nil
+	}
+	switch v := out.(type) {
+	case []history.Run:
+		for _, r := range v {
+			fmt.Fprintf(os.Stdout, "%s  %-11s %-8s %s  %d node(s)  %s\n", r.Started.Local().Format("2006-01-02 15:04"), r.Status,
+				formatMs(r.DurationMs), r.Document.Chart, len(r.Nodes), r.Usage)
+		}
+	case []history.NodeStats:
+		fmt.Fprintf(os.Stdout, "%-6s %-6s %-8s %-8s %-8s %s\n", "RUNS", "FLAKY", "FAILED", "RETRIES", "AVG", "NODE")
+		for _, s := range v {
+			fmt.Fprintf(os.Stdout, "%-6d %-6s %-8d %-8.2f %-8s %s / %s\n", s.Runs, percent(s.FlakeRate), s.Failed, s.AvgRetries, formatMs(s.AvgDurationMs), s.Chart, s.Node)
+		}
+	case []history.CLIStats:
+		fmt.Fprintf(os.Stdout, "%-10s %-6s %-8s %-8s %-8s %s\n", "CLI", "NODES", "SUCCESS", "RETRIES", "AVG", "COST")
+		for _, s := range v {
+			fmt.Fprintf(os.Stdout, "%-10s %-6d %-8s %-8.2f %-8s $%.4f\n", s.CLI, s.Nodes, percent(s.SuccessRate), s.AvgRetries, formatMs(s.AvgDurationMs), s.CostUSD)
+		}
+	case []history.SlowStats:
+		for _, s := range v {
+			fmt.Fprintf(os.Stdout, "%s / %s: avg %s, max %s over %d run(s)\n", s.Chart, s.Node, formatMs(s.AvgDurationMs), formatMs(s.MaxDurationMs), s.Runs)
+			for _, p := range s.Periods {
+				fmt.Fprintf(os.Stdout, "  %-10s %-8s (%d)\n", p.Period, formatMs(p.AvgDurationMs), p.Runs)
+			}
+		}
+	}
+	return nil
+}
+
+// appendHistory adds a finished run-tree run to the history file in the settings directory.
+func appendHistory(r history.Run) error {
+	dir, err := settings.StateDir()
+	if err != nil {
+		return err
+	}
+	return history.Append(filepath.Join(dir, history.FileName), r)
+}
+
+// parseSince parses --since: a date (2006-01-02, local time) or a duration before now, with a d
+// suffix for days.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: want a date (2026-01-31) or a duration (30d, 12h)", s)
+}
+
+func formatMs(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(100 * time.Millisecond).String()
+}
+
+func percent(f float64) string {
+	return fmt.Sprintf("%.0f%%", f*100)
+}
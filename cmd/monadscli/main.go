@@ -20,12 +20,17 @@ import (
 
 func main() {
 	cli.Execute([]cli.Command{
+		analyzeCommand(),
+		historyCommand(),
 		installCommand(),
 		loginCommand(),
 		lucidCommand(),
+		promptsCommand(),
 		runCommand(),
 		runTreeCommand(),
 		settingsCommand(),
+		testCommand(),
+		worktreesCommand(),
 	})
 }
 
@@ -47,6 +52,7 @@ func runCommand() cli.Command {
 	var shell string
 	var workDir string
 	var shellArgs cli.StringList
+	var output string
 
 	return cli.Command{
 		Name:        "run",
@@ -57,11 +63,20 @@ func runCommand() cli.Command {
 			fs.StringVar(&shell, "shell", "", "Shell executable to use")
 			fs.Var(&shellArgs, "shell-arg", "Shell arg (repeatable)")
 			fs.StringVar(&workDir, "workdir", "", "Working directory for the command")
+			fs.StringVar(&output, "output", string(outputStream), outputUsage)
 		},
 		Run: func(fs *flag.FlagSet) error {
 			if command == "" {
 				return fmt.Errorf("missing --command")
 			}
+			mode, err := parseOutputMode(output)
+			if err != nil {
+				return err
+			}
+			stdout, stderr := mode.agentWriters()
+			if mode == outputPrefixed {
+				stdout, stderr = runner.NewPrefixWriter(os.Stdout, "[run] "), runner.NewPrefixWriter(os.Stderr, "[run] ")
+			}
 
 			shellCmd, defaultArgs := runner.DefaultShell()
 			if shell != "" {
@@ -75,23 +90,49 @@ func runCommand() cli.Command {
 				args = append(args, defaultArgs...)
 			}
 
+			if reportPath == "" {
+				reportPath = filepath.Join("reports", fmt.Sprintf("report-%s.json", time.Now().Format("20060102-150405")))
+			}
+			effective, err := settings.Effective()
+			if err != nil {
+				return fmt.Errorf("settings: %w", err)
+			}
+			redactor, err := redactorFromSettings(effective)
+			if err != nil {
+				return err
+			}
+			// Output past CAPTURE_MAX_BYTES spills next to the report.
+			capture, _, err := captureFromSettings(effective, filepath.Dir(reportPath))
+			if err != nil {
+				return fmt.Errorf("settings: %w", err)
+			}
+			capture.Filter = redactor.Bytes
+
 			result, err := runner.RunShellCommand(runner.CommandSpec{
 				Shell:     shellCmd,
 				ShellArgs: args,
 				Command:   command,
 				WorkDir:   workDir,
+				Stdout:    stdout,
+				Stderr:    stderr,
+				Capture:   capture,
 			})
+			if p, ok := stdout.(*runner.PrefixWriter); ok {
+				_ = p.Flush()
+				_ = stderr.(*runner.PrefixWriter).Flush()
+			}
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "command failed: %v\n", err)
 			}
 
-			if reportPath == "" {
-				reportPath = filepath.Join("reports", fmt.Sprintf("report-%s.json", time.Now().Format("20060102-150405")))
-			}
-
-			if err := report.WriteJSON(reportPath, result); err != nil {
+			if err := report.WriteJSON(reportPath, result, redactor); err != nil {
 				return fmt.Errorf("write report: %w", err)
 			}
+			if mode == outputJSON {
+				if err := printJSON(result, redactor); err != nil {
+					return err
+				}
+			}
 
 			if result.ExitCode != 0 {
 				return cli.ExitError{Code: result.ExitCode}
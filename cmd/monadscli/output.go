@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/redact"
+)
+
+// outputMode is the console output of run and run-tree (--output).
+type outputMode string
+
+const (
+	outputStream   outputMode = "stream"   // agent output as it arrives
+	outputPrefixed outputMode = "prefixed" // agent output with "[node name] " before each line
+	outputQuiet    outputMode = "quiet"    // no agent output; status messages only
+	outputJSON     outputMode = "json"     // only the structured result on stdout
+)
+
+const outputUsage = "Console output: stream (agent output as is), prefixed ([node] before each line), quiet (no agent output), or json (only the structured result on stdout)"
+
+func parseOutputMode(s string) (outputMode, error) {
+	switch m := outputMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return outputStream, nil
+	case outputStream, outputPrefixed, outputQuiet, outputJSON:
+		return m, nil
+	}
+	return "", fmt.Errorf("--output: unknown mode %q (want stream, prefixed, quiet, or json)", s)
+}
+
+// agentWriters returns where live agent output goes; nil keeps the process's stdout and stderr.
+func (m outputMode) agentWriters() (io.Writer, io.Writer) {
+	if m == outputQuiet || m == outputJSON {
+		return io.Discard, io.Discard
+	}
+	return nil, nil
+}
+
+// console returns where status messages go: stderr in json mode, so stdout holds only the result.
+func (m outputMode) console() io.Writer {
+	if m == outputJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printJSON writes v to stdout as indented JSON, masking secrets with r.
+func printJSON(v any, r *redact.Redactor) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, r.String(string(data)))
+	return err
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/cli"
+	"github.com/ryanmontgomery/MonadsCLI/internal/settings"
+	"github.com/ryanmontgomery/MonadsCLI/prompts"
+)
+
+// defaultPromptsDir is the project config directory searched for <name>.txt prompt overrides.
+const defaultPromptsDir = ".monads/prompts"
+
+func promptsCommand() cli.Command {
+	return cli.Command{
+		Name:        "prompts",
+		Description: "Show or export the effective built-in prompts (show|export)",
+		Run: func(fs *flag.FlagSet) error {
+			args := fs.Args()
+			if len(args) == 0 {
+				return fmt.Errorf("missing prompts subcommand")
+			}
+			switch args[0] {
+			case "show":
+				return promptsShow(args[1:])
+			case "export":
+				return promptsExport(args[1:])
+			default:
+				return fmt.Errorf("unknown prompts subcommand: %s", args[0])
+			}
+		},
+	}
+}
+
+func promptsShow(args []string) error {
+	fs := flag.NewFlagSet("prompts show", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	var workDir string
+	fs.StringVar(&workDir, "workdir", "", "Project directory (default: current dir)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if err := loadPromptOverridesFromSettings(workDir); err != nil {
+		return err
+	}
+	names, err := promptNames(fs.Args())
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		text, source := prompts.Effective(name)
+		if i > 0 {
+			fmt.Fprintln(os.Stdout)
+		}
+		fmt.Fprintf(os.Stdout, "# %s (%s)\n%s\n", name, source, strings.TrimSpace(text))
+	}
+	return nil
+}
+
+func promptsExport(args []string) error {
+	fs := flag.NewFlagSet("prompts export", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	var workDir string
+	var dir string
+	var force bool
+	fs.StringVar(&workDir, "workdir", "", "Project directory (default: current dir)")
+	fs.StringVar(&dir, "dir", "", "Directory to write <name>.txt files (default: <workdir>/"+defaultPromptsDir+")")
+	fs.BoolVar(&force, "force", false, "Overwrite existing files")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if err := loadPromptOverridesFromSettings(workDir); err != nil {
+		return err
+	}
+	names, err := promptNames(fs.Args())
+	if err != nil {
+		return err
+	}
+	if dir == "" {
+		dir = filepath.Join(workDirOrCwd(workDir), defaultPromptsDir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name+".txt")
+		if _, err := os.Stat(path); err == nil && !force {
+			return fmt.Errorf("%s exists (use --force to overwrite)", path)
+		}
+		text, _ := prompts.Effective(name)
+		if err := os.WriteFile(path, []byte(strings.TrimSpace(text)+"\n"), 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Wrote %s\n", path)
+	}
+	return nil
+}
+
+// promptNames returns args, or every prompt name when args is empty.
+func promptNames(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return prompts.Names(), nil
+	}
+	for _, name := range args {
+		if _, ok := prompts.Builtin(name); !ok {
+			return nil, fmt.Errorf("unknown prompt %q (known: %s)", name, strings.Join(prompts.Names(), ", "))
+		}
+	}
+	return args, nil
+}
+
+func workDirOrCwd(workDir string) string {
+	if workDir != "" {
+		return workDir
+	}
+	cwd, _ := os.Getwd()
+	return cwd
+}
+
+func loadPromptOverridesFromSettings(workDir string) error {
+	effective, err := settings.Effective()
+	if err != nil {
+		return fmt.Errorf("settings: %w", err)
+	}
+	return loadPromptOverrides(effective, workDirOrCwd(workDir))
+}
+
+// loadPromptOverrides applies PROMPT_<NAME> files from settings, then <name>.txt files in
+// PROMPTS_DIR (default <workdir>/.monads/prompts). Relative paths are resolved against workDir.
+func loadPromptOverrides(effective settings.Settings, workDir string) error {
+	dir := strings.TrimSpace(effective["PROMPTS_DIR"])
+	if dir == "" {
+		dir = defaultPromptsDir
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(workDir, dir)
+	}
+	files := map[string]string{}
+	for _, name := range prompts.Names() {
+		path := strings.TrimSpace(effective["PROMPT_"+strings.ToUpper(name)])
+		if path != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(workDir, path)
+		}
+		files[name] = path
+	}
+	_, err := prompts.LoadOverrides(dir, files)
+	return err
+}
@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ryanmontgomery/MonadsCLI/internal/cli"
 	"github.com/ryanmontgomery/MonadsCLI/internal/document"
+	"github.com/ryanmontgomery/MonadsCLI/internal/gitops"
+	"github.com/ryanmontgomery/MonadsCLI/internal/history"
+	"github.com/ryanmontgomery/MonadsCLI/internal/redact"
 	"github.com/ryanmontgomery/MonadsCLI/internal/run"
 	"github.com/ryanmontgomery/MonadsCLI/internal/runlog"
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
 	"github.com/ryanmontgomery/MonadsCLI/internal/settings"
 	"github.com/ryanmontgomery/MonadsCLI/types"
 )
@@ -20,6 +31,19 @@ func runTreeCommand() cli.Command {
 	var csvPath string
 	var workDir string
 	var cliCodename string
+	var varsFile string
+	var vars cli.StringList
+	var isolate bool
+	var merge bool
+	var auditEnv bool
+	var resumePath string
+	var output string
+	var approvalFile string
+	var answers cli.StringList
+	var answersFile string
+	var recordDir string
+	var replayDir string
+	var replayMatch string
 
 	return cli.Command{
 		Name:        "run-tree",
@@ -28,11 +52,47 @@ func runTreeCommand() cli.Command {
 			fs.StringVar(&csvPath, "csv", "", "Path to Lucid CSV export")
 			fs.StringVar(&workDir, "workdir", "", "Working directory (default: current dir)")
 			fs.StringVar(&cliCodename, "cli", "", "Override DEFAULT_CLI codename (e.g. GEMINI)")
+			fs.Var(&vars, "var", "Tree input KEY=VALUE for {{vars.KEY}} (repeatable)")
+			fs.StringVar(&varsFile, "vars-file", "", "File of tree inputs: JSON object or KEY=VALUE lines")
+			fs.BoolVar(&isolate, "isolate", false, "Run nodes in a new git worktree on branch monads/<chart>-<time>; the branch is kept for review")
+			fs.BoolVar(&merge, "merge", false, "With --isolate, merge the run branch back when the tree succeeds")
+			fs.BoolVar(&auditEnv, "audit-env", false, "Print the environment variable names each agent invocation receives and record them in the short log")
+			fs.StringVar(&output, "output", string(outputStream), outputUsage)
+			fs.StringVar(&approvalFile, "approval-file", "", "Answer approval nodes through this file or named pipe instead of the terminal")
+			fs.Var(&answers, "answer", "Route for a Human decision node as node=route (repeatable)")
+			fs.StringVar(&answersFile, "answers", "", "File of Human decision routes: JSON object or node=route lines")
+			fs.StringVar(&recordDir, "record", "", "Record every agent invocation and its result to this directory")
+			fs.StringVar(&replayDir, "replay", "", "Serve agent invocations from a --record directory instead of running agents")
+			fs.StringVar(&replayMatch, "replay-match", "strict", "With --replay: strict (prompts must equal the recording) or lenient (match by node, phase, and attempt only)")
+			fs.StringVar(&resumePath, "resume", "", "Resume an interrupted run from its state file (state.json in the run directory, or the directory)")
 		},
 		Run: func(fs *flag.FlagSet) error {
 			if csvPath == "" {
 				return fmt.Errorf("missing --csv")
 			}
+			if merge && !isolate {
+				return fmt.Errorf("--merge requires --isolate")
+			}
+			if recordDir != "" && replayDir != "" {
+				return fmt.Errorf("--record and --replay cannot be combined")
+			}
+			if replayMatch != "strict" && replayMatch != "lenient" {
+				return fmt.Errorf("invalid --replay-match %q: want strict or lenient", replayMatch)
+			}
+			mode, err := parseOutputMode(output)
+			if err != nil {
+				return err
+			}
+			console := mode.console()
+			var state *runlog.RunState
+			if resumePath != "" {
+				if fi, statErr := os.Stat(resumePath); statErr == nil && fi.IsDir() {
+					resumePath = filepath.Join(resumePath, runlog.StateFile)
+				}
+				if state, err = runlog.ReadRunState(resumePath); err != nil {
+					return err
+				}
+			}
 			data, err := os.ReadFile(csvPath)
 			if err != nil {
 				return fmt.Errorf("read CSV: %w", err)
@@ -45,7 +105,8 @@ func runTreeCommand() cli.Command {
 				return fmt.Errorf("CSV produced no root node")
 			}
 
-			effective, err := settings.ToEnv()
+			// Settings are not exported to the process environment: each agent gets only its own keys (see run.EnvOptions).
+			effective, err := settings.Effective()
 			if err != nil {
 				return fmt.Errorf("settings: %w", err)
 			}
@@ -54,7 +115,23 @@ func runTreeCommand() cli.Command {
 				effective["DEFAULT_VALIDATE_CLI"] = cliCodename
 				effective["DEFAULT_RETRY_CLI"] = cliCodename
 			}
+			given, err := varsFromFlags(varsFile, vars)
+			if err != nil {
+				return err
+			}
+			resolvedVars, err := types.ResolveVars(doc.Inputs, given)
+			if err != nil {
+				return fmt.Errorf("tree inputs:\n%w", err)
+			}
+			runDir := workDirOrCwd(workDir)
+			if err := loadPromptOverrides(effective, runDir); err != nil {
+				return err
+			}
 			defaults := processedDefaultsFromSettings(effective)
+			defaults.Vars = resolvedVars
+			defaults.LookupEnv = settings.TemplateLookupEnv
+			defaults.LookupEnvMetadata = settings.EnvMetadataLookupEnv(effective)
+			defaults.Metadata = doc.Metadata
 			root := types.NodeToProcessedNodeWithDefaults(doc.Root, defaults)
 
 			opts := run.RunOptions{
@@ -62,28 +139,221 @@ func runTreeCommand() cli.Command {
 				DefaultValidateCLI: effective["DEFAULT_VALIDATE_CLI"],
 				DefaultRetryCLI:    effective["DEFAULT_RETRY_CLI"],
 				WorkDir:            workDir,
+				NativeOutput:       strings.TrimSpace(strings.ToLower(effective["NATIVE_OUTPUT"])) == "true",
+			}
+			opts.Env = &run.EnvOptions{Passthrough: splitSetting(effective["ENV_PASSTHROUGH"]), Secrets: settings.CLISecrets(effective)}
+			if auditEnv {
+				opts.Env.Audit = os.Stderr
 			}
 			if opts.WorkDir == "" {
 				opts.WorkDir, _ = os.Getwd()
 			}
+			ledger, err := ledgerFromSettings(effective)
+			if err != nil {
+				return fmt.Errorf("settings: %w", err)
+			}
+			opts.Ledger = ledger
+			opts.DefaultModels, opts.ExtraModels = modelsFromSettings(effective)
+			if err := run.LoadOutputSchemas(root, opts.WorkDir, filepath.Dir(csvPath)); err != nil {
+				return err
+			}
+			fileOpts, err := fileOptionsFromSettings(effective)
+			if err != nil {
+				return fmt.Errorf("settings: %w", err)
+			}
+			fileOpts.Dirs = []string{opts.WorkDir, filepath.Dir(csvPath)}
+			fileOpts.Vars = resolvedVars
+			fileOpts.LookupEnv = defaults.LookupEnv
+			warnings, err := run.LoadNodeFiles(root, fileOpts)
+			for _, w := range warnings {
+				fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+			}
+			if err != nil {
+				return err
+			}
+			tty := terminal()
+			opts.Approver = approverFor(approvalFile, tty, console, func(s string) string { return opts.Redactor.String(s) })
+			if tty != nil {
+				opts.Chooser = tty
+			}
+			if opts.Answers, err = answersFromFlags(answersFile, answers); err != nil {
+				return err
+			}
+			if opts.ApprovalTimeout, err = approvalTimeout(effective); err != nil {
+				return fmt.Errorf("settings: %w", err)
+			}
+			if err := run.Preflight(root, opts); err != nil {
+				return fmt.Errorf("preflight:\n%w", err)
+			}
 			logDir := strings.TrimSpace(effective["LOG_DIR"])
 			if logDir == "" {
 				logDir = "./_monad_logs/"
 			}
+			chartName := strings.TrimSpace(doc.Title)
+			// Logs stay in the original workdir; with --isolate only the nodes run in the worktree.
+			logWorkDir := opts.WorkDir
+			var iso *isolation
+			if isolate {
+				iso, err = startIsolation(opts.WorkDir, chartName, console)
+				if err != nil {
+					return err
+				}
+				opts.WorkDir = iso.workDir
+				// An early return leaves the branch for review; the end of the run finishes it below.
+				defer func() {
+					if iso != nil {
+						_ = iso.finish(false, chartName)
+					}
+				}()
+			}
+			gitOpts, err := gitOptionsFromSettings(effective, opts.WorkDir, logDir)
+			if err != nil {
+				return err
+			}
+			opts.Git = gitOpts
+			opts.Guard = pathGuardFromSettings(effective, logDir)
+			if opts.Capture, opts.MaxPromptOutput, err = captureFromSettings(effective, ""); err != nil {
+				return fmt.Errorf("settings: %w", err)
+			}
+			if opts.Redactor, err = redactorFromSettings(effective); err != nil {
+				return err
+			}
+			if opts.Executor, err = executorFor(recordDir, replayDir, replayMatch == "strict", opts.Redactor); err != nil {
+				return err
+			}
 			writeShort := strings.TrimSpace(strings.ToLower(effective["WRITE_LOG_SHORT"])) == "true"
 			writeLong := strings.TrimSpace(strings.ToLower(effective["WRITE_LOG_LONG"])) == "true"
 
-			chartName := strings.TrimSpace(doc.Title)
-			if err := runlog.ExecuteTree(root, opts, opts.WorkDir, logDir, chartName, writeShort, writeLong); err != nil {
+			opts.AgentStdout, opts.AgentStderr = mode.agentWriters()
+			opts.PrefixAgentOutput = mode == outputPrefixed
+			result := treeResult{Chart: chartName, Nodes: make([]runlog.ShortEntry, 0)}
+			// The recorder also feeds the run directory's manifest.
+			hist := history.NewRecorder(history.NewDocument(chartName, csvPath, data), opts.DefaultCLI)
+			opts.OnNodeDone = func(node *types.ProcessedNode, res run.NodeResult) {
+				result.Nodes = append(result.Nodes, runlog.NewShortEntry(node, res))
+				hist.NodeDone(node, res)
+			}
+			runLogDir, err := runlog.NewRunDir(logWorkDir, logDir, time.Now())
+			if err != nil {
+				return fmt.Errorf("create run directory: %w", err)
+			}
+			absRunDir := filepath.Join(logWorkDir, runLogDir)
+			opts.Capture.SpillDir = filepath.Join(absRunDir, runlog.OutputDir)
+
+			var stopInterrupts func()
+			opts.Interrupts, stopInterrupts = handleInterrupts(interruptGrace(effective))
+			if state != nil {
+				err = runlog.ResumeTree(root, state, opts, logWorkDir, runLogDir, chartName, writeShort, writeLong)
+			} else {
+				err = runlog.ExecuteTree(root, opts, logWorkDir, runLogDir, chartName, writeShort, writeLong)
+			}
+			stopInterrupts()
+			fmt.Fprintf(console, "Usage: %s\n", ledger.Total)
+			finished := hist.Finish(err, ledger.Total, opts.Redactor)
+			// Replayed runs are not real agent runs and would skew the history.
+			if replayDir == "" && strings.TrimSpace(strings.ToLower(effective["RUN_HISTORY"])) != "false" {
+				if histErr := appendHistory(finished); histErr != nil {
+					fmt.Fprintf(os.Stderr, "warning: run history: %v\n", histErr)
+				}
+			}
+			// The manifest describes what the run wrote; a run that wrote nothing (logs off, no
+			// spill, not interrupted) leaves no directory.
+			if written, readErr := os.ReadDir(absRunDir); readErr == nil && len(written) == 0 {
+				_ = os.Remove(absRunDir)
+			} else if readErr == nil {
+				// A replayed run invoked no CLI, so their versions are not probed.
+				if manErr := writeManifest(absRunDir, finished, result.Nodes, effective, err, replayDir == "", opts.Redactor); manErr != nil {
+					fmt.Fprintf(os.Stderr, "warning: run manifest: %v\n", manErr)
+				}
+			}
+			if iso != nil {
+				finishErr := iso.finish(merge && err == nil, chartName)
+				iso = nil
+				if finishErr != nil && err == nil {
+					err = finishErr
+				}
+			}
+			if mode == outputJSON {
+				result.Usage = runlog.UsageSummary{Total: ledger.Total, ByCLI: ledger.ByCLI}
+				if writeShort || writeLong {
+					result.Logs = absRunDir
+				}
+				if err != nil {
+					result.Error = err.Error()
+				}
+				if printErr := printJSON(result, opts.Redactor); printErr != nil && err == nil {
+					err = printErr
+				}
+			}
+			if err != nil {
 				return err
 			}
-			absLogDir := filepath.Join(opts.WorkDir, logDir)
-			fmt.Fprintf(os.Stdout, "Logs written to %s\n", absLogDir)
+			if writeShort || writeLong {
+				fmt.Fprintf(console, "Logs written to %s\n", absRunDir)
+			}
 			return nil
 		},
 	}
 }
 
+// treeResult is the run-tree --output json document: the short log entries of the executed nodes,
+// usage, and the error that stopped the run.
+type treeResult struct {
+	Chart string              `json:"chart"`
+	Nodes []runlog.ShortEntry `json:"nodes"`
+	Usage runlog.UsageSummary `json:"usage"`
+	Logs  string              `json:"logs,omitempty"`
+	Error string              `json:"error,omitempty"`
+}
+
+// writeManifest writes manifest.json to the run directory: the history record of the run, the
+// settings without secrets, and the version of each CLI it used (left empty unless probeCLIs).
+func writeManifest(dir string, r history.Run, entries []runlog.ShortEntry, effective settings.Settings, runErr error, probeCLIs bool, redactor *redact.Redactor) error {
+	m := runlog.NewManifest(r, entries)
+	if runErr != nil {
+		m.ExitCode = 1
+		var exit cli.ExitError
+		if errors.As(runErr, &exit) {
+			m.ExitCode = exit.Code
+		}
+	}
+	m.Settings = map[string]string{}
+	for key, value := range effective {
+		if !settings.IsSecretKey(key) {
+			m.Settings[key] = value
+		}
+	}
+	m.CLIs = map[string]string{}
+	for _, e := range entries {
+		for _, a := range e.Attempts {
+			if _, ok := m.CLIs[a.CLI]; !ok {
+				m.CLIs[a.CLI] = ""
+				if probeCLIs {
+					m.CLIs[a.CLI] = cliVersion(a.CLI)
+				}
+			}
+		}
+	}
+	return runlog.WriteManifest(dir, m, redactor)
+}
+
+// cliVersion returns the first line of `<command> --version` for a CLI codename, or "" when the
+// CLI is unknown or the command fails within a few seconds.
+func cliVersion(codename string) string {
+	clis, err := types.SelectCLIs([]string{codename})
+	if err != nil || len(clis) == 0 {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, clis[0].Command, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(line)
+}
+
 func processedDefaultsFromSettings(effective settings.Settings) *types.ProcessedNodeDefaults {
 	d := &types.ProcessedNodeDefaults{
 		CLI:         strings.TrimSpace(effective["DEFAULT_CLI"]),
@@ -104,3 +374,295 @@ func processedDefaultsFromSettings(effective settings.Settings) *types.Processed
 	}
 	return d
 }
+
+// ledgerFromSettings builds the run ledger from MAX_RUN_COST, MAX_RUN_TOKENS, and PRICE_<CODENAME>.
+// A budget needs NATIVE_OUTPUT, which is where usage comes from.
+func ledgerFromSettings(effective settings.Settings) (*run.Ledger, error) {
+	var budget run.Budget
+	if v := strings.TrimSpace(effective["MAX_RUN_COST"]); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return nil, fmt.Errorf("invalid MAX_RUN_COST %q", v)
+		}
+		budget.MaxCostUSD = f
+	}
+	if v := strings.TrimSpace(effective["MAX_RUN_TOKENS"]); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("invalid MAX_RUN_TOKENS %q", v)
+		}
+		budget.MaxTokens = i
+	}
+	// Usage is only known from native output; without it a budget would never trigger.
+	if (budget.MaxCostUSD > 0 || budget.MaxTokens > 0) && strings.TrimSpace(strings.ToLower(effective["NATIVE_OUTPUT"])) != "true" {
+		return nil, fmt.Errorf("MAX_RUN_COST and MAX_RUN_TOKENS need NATIVE_OUTPUT=true (usage is only reported in native output mode)")
+	}
+	prices := run.PriceTable{}
+	for _, c := range types.AllCLIs {
+		v := strings.TrimSpace(effective["PRICE_"+c.Codename])
+		if v == "" {
+			continue
+		}
+		p, err := run.ParsePrice(v)
+		if err != nil {
+			return nil, fmt.Errorf("PRICE_%s: %w", c.Codename, err)
+		}
+		prices[c.Codename] = p
+	}
+	return run.NewLedger(budget, prices), nil
+}
+
+// fileOptionsFromSettings reads the context_files limits CONTEXT_MAX_FILE_BYTES and CONTEXT_MAX_BYTES.
+func fileOptionsFromSettings(effective settings.Settings) (run.FileOptions, error) {
+	var o run.FileOptions
+	for key, dst := range map[string]*int{"CONTEXT_MAX_FILE_BYTES": &o.MaxFileBytes, "CONTEXT_MAX_BYTES": &o.MaxBytes} {
+		v := strings.TrimSpace(effective[key])
+		if v == "" {
+			continue
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			return o, fmt.Errorf("invalid %s %q", key, v)
+		}
+		*dst = i
+	}
+	return o, nil
+}
+
+// captureFromSettings reads CAPTURE_MAX_BYTES (in-memory agent output per stream and long log;
+// 0 = unlimited) and VALIDATE_OUTPUT_MAX_BYTES (node output embedded in validation prompts).
+// Output past the cap spills to spillDir.
+func captureFromSettings(effective settings.Settings, spillDir string) (runner.CaptureOptions, int, error) {
+	c := runner.CaptureOptions{MaxBytes: runner.DefaultCaptureMaxBytes, SpillDir: spillDir}
+	maxPrompt := 0
+	for key, dst := range map[string]*int{"CAPTURE_MAX_BYTES": &c.MaxBytes, "VALIDATE_OUTPUT_MAX_BYTES": &maxPrompt} {
+		v := strings.TrimSpace(effective[key])
+		if v == "" {
+			continue
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			return c, 0, fmt.Errorf("invalid %s %q", key, v)
+		}
+		*dst = i
+	}
+	return c, maxPrompt, nil
+}
+
+// gitOptionsFromSettings returns git checkpoint options when GIT_CHECKPOINT, GIT_RESET_ON_RETRY,
+// or GIT_COMMIT is true, or nil when all are off. The log dir is excluded from snapshots and commits.
+// GIT_COMMIT needs a clean worktree so that uncommitted work is not committed under a node's name.
+func gitOptionsFromSettings(effective settings.Settings, workDir, logDir string) (*run.GitOptions, error) {
+	isTrue := func(key string) bool { return strings.TrimSpace(strings.ToLower(effective[key])) == "true" }
+	g := &run.GitOptions{ResetOnRetry: isTrue("GIT_RESET_ON_RETRY"), Commit: isTrue("GIT_COMMIT")}
+	if !isTrue("GIT_CHECKPOINT") && !g.ResetOnRetry && !g.Commit {
+		return nil, nil
+	}
+	repo, err := gitops.Open(workDir)
+	if err != nil {
+		return nil, fmt.Errorf("git checkpoints: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(workDir); err == nil {
+		workDir = resolved
+	}
+	absLog := logDir
+	if !filepath.IsAbs(absLog) {
+		absLog = filepath.Join(workDir, logDir)
+	}
+	if rel, err := filepath.Rel(repo.Dir, absLog); err == nil && !strings.HasPrefix(rel, "..") {
+		repo.Exclude = append(repo.Exclude, rel)
+	}
+	if g.Commit {
+		dirty, err := repo.Dirty()
+		if err != nil {
+			return nil, fmt.Errorf("git checkpoints: %w", err)
+		}
+		if dirty {
+			return nil, fmt.Errorf("GIT_COMMIT: the worktree has uncommitted changes; commit or stash them first, or use --isolate")
+		}
+	}
+	g.Repo = repo
+	return g, nil
+}
+
+// pathGuardFromSettings reads ALLOWED_PATHS and PROTECTED_PATHS (comma-separated globs) and
+// PATH_GUARD_REVERT. A relative log dir is excluded from the checks.
+func pathGuardFromSettings(effective settings.Settings, logDir string) *run.PathGuard {
+	g := &run.PathGuard{
+		AllowedPaths:   splitSetting(effective["ALLOWED_PATHS"]),
+		ProtectedPaths: splitSetting(effective["PROTECTED_PATHS"]),
+		Revert:         strings.TrimSpace(strings.ToLower(effective["PATH_GUARD_REVERT"])) == "true",
+	}
+	if !filepath.IsAbs(logDir) {
+		g.Exclude = []string{logDir}
+	}
+	return g
+}
+
+// handleInterrupts forwards SIGINT and SIGTERM to the running agent until stop is called: the
+// first signal stops the run gracefully (see runner.Interrupts), the second force-kills the agent.
+func handleInterrupts(grace time.Duration) (interrupts *runner.Interrupts, stop func()) {
+	interrupts = runner.NewInterrupts(grace)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if interrupts.Interrupt(sig) {
+					fmt.Fprintln(os.Stderr, "\nForce-killing the agent")
+				} else {
+					fmt.Fprintf(os.Stderr, "\nInterrupted: stopping the agent (waiting up to %s; press Ctrl-C again to force)\n", grace)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return interrupts, func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// interruptGrace reads INTERRUPT_GRACE (seconds the agent gets to exit after an interrupt).
+func interruptGrace(effective settings.Settings) time.Duration {
+	if v := strings.TrimSpace(effective["INTERRUPT_GRACE"]); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return runner.DefaultGrace
+}
+
+// terminal returns the prompter for approval and Human decision nodes when stdin is a terminal,
+// otherwise nil.
+func terminal() *run.TTYApprover {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		return &run.TTYApprover{In: os.Stdin, Out: os.Stderr}
+	}
+	return nil
+}
+
+// approverFor answers approval nodes through path when set, otherwise on tty; nil when neither is
+// available (approval nodes then fail preflight).
+func approverFor(path string, tty *run.TTYApprover, console io.Writer, redact func(string) string) run.Approver {
+	if path != "" {
+		return &run.FileApprover{Path: path, Out: console, Redact: redact}
+	}
+	if tty != nil {
+		return tty
+	}
+	return nil
+}
+
+// executorFor returns the executor for --record or --replay; nil runs agents directly.
+func executorFor(recordDir, replayDir string, strict bool, r *redact.Redactor) (run.Executor, error) {
+	switch {
+	case recordDir != "":
+		return run.NewRecorder(recordDir, nil, r)
+	case replayDir != "":
+		return run.NewReplayer(replayDir, strict, r)
+	}
+	return nil, nil
+}
+
+// answersFromFlags merges --answers and --answer routes for Human decision nodes; --answer wins.
+func answersFromFlags(answersFile string, assignments []string) (map[string]string, error) {
+	out := map[string]string{}
+	if answersFile != "" {
+		data, err := os.ReadFile(answersFile)
+		if err != nil {
+			return nil, fmt.Errorf("read answers file: %w", err)
+		}
+		if out, err = run.ParseAnswers(data); err != nil {
+			return nil, err
+		}
+	}
+	for _, a := range assignments {
+		node, route, err := run.ParseAnswer(a)
+		if err != nil {
+			return nil, err
+		}
+		out[node] = route
+	}
+	return out, nil
+}
+
+// approvalTimeout reads APPROVAL_TIMEOUT (seconds to wait for an answer at an approval node; 0 or
+// unset waits indefinitely).
+func approvalTimeout(effective settings.Settings) (time.Duration, error) {
+	v := strings.TrimSpace(effective["APPROVAL_TIMEOUT"])
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("APPROVAL_TIMEOUT: want seconds, got %q", v)
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+// redactorFromSettings masks the secret settings values (see settings.SecretValues) and the
+// REDACT_PATTERNS regular expressions, in addition to redact.DefaultPatterns.
+func redactorFromSettings(effective settings.Settings) (*redact.Redactor, error) {
+	patterns, err := redact.ParsePatterns(effective["REDACT_PATTERNS"])
+	if err != nil {
+		return nil, fmt.Errorf("REDACT_PATTERNS: %w", err)
+	}
+	r, err := redact.New(settings.SecretValues(effective), patterns)
+	if err != nil {
+		return nil, fmt.Errorf("REDACT_PATTERNS: %w", err)
+	}
+	return r, nil
+}
+
+// splitSetting splits a comma-separated setting, dropping empty entries.
+func splitSetting(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// modelsFromSettings reads DEFAULT_MODEL_<CODENAME> and MODELS_<CODENAME> (comma-separated) for every CLI.
+func modelsFromSettings(effective settings.Settings) (map[string]string, map[string][]string) {
+	defaults := map[string]string{}
+	extra := map[string][]string{}
+	for _, c := range types.AllCLIs {
+		if v := strings.TrimSpace(effective["DEFAULT_MODEL_"+c.Codename]); v != "" {
+			defaults[c.Codename] = v
+		}
+		if models := splitSetting(effective["MODELS_"+c.Codename]); len(models) > 0 {
+			extra[c.Codename] = models
+		}
+	}
+	return defaults, extra
+}
+
+// varsFromFlags merges --vars-file and --var values; --var wins on conflicts.
+func varsFromFlags(varsFile string, assignments []string) (map[string]string, error) {
+	out := map[string]string{}
+	if varsFile != "" {
+		data, err := os.ReadFile(varsFile)
+		if err != nil {
+			return nil, fmt.Errorf("read vars file: %w", err)
+		}
+		out, err = types.ParseVarsFile(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, a := range assignments {
+		k, v, err := types.ParseVarAssignment(a)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/cli"
+	"github.com/ryanmontgomery/MonadsCLI/internal/document"
+	"github.com/ryanmontgomery/MonadsCLI/internal/run"
+	"github.com/ryanmontgomery/MonadsCLI/internal/settings"
+	"github.com/ryanmontgomery/MonadsCLI/internal/treetest"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// testSettingKeys are the settings a test spec starts from: their built-in defaults, never the
+// user's settings.
+var testSettingKeys = []string{"DEFAULT_CLI", "DEFAULT_VALIDATE_CLI", "DEFAULT_RETRY_CLI", "DEFAULT_RETRY_COUNT", "DEFAULT_TIMEOUT"}
+
+func testCommand() cli.Command {
+	var junitPath string
+	var workDir string
+
+	return cli.Command{
+		Name:        "test",
+		Description: "Test a tree offline against scripted agent responses: test <tree.csv> <spec.json>",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&junitPath, "junit", "", "Also write the results as JUnit XML to this path")
+			fs.StringVar(&workDir, "workdir", "", "Working directory for prompt files and overrides (default: current dir)")
+		},
+		Run: func(fs *flag.FlagSet) error {
+			if fs.NArg() != 2 {
+				return fmt.Errorf("usage: monadscli test [options] <tree.csv> <spec.json>")
+			}
+			treePath, specPath := fs.Arg(0), fs.Arg(1)
+			data, err := os.ReadFile(treePath)
+			if err != nil {
+				return fmt.Errorf("read CSV: %w", err)
+			}
+			doc, err := document.TransformFromCSV(data)
+			if err != nil {
+				return fmt.Errorf("transform CSV: %w", err)
+			}
+			if doc.Root == nil {
+				return fmt.Errorf("CSV produced no root node")
+			}
+			spec, err := treetest.LoadSpec(specPath)
+			if err != nil {
+				return err
+			}
+
+			effective := settings.Settings{}
+			for _, key := range testSettingKeys {
+				effective[key] = settings.DefaultFor(key)
+			}
+			for k, v := range spec.Settings {
+				effective[k] = v
+			}
+			runDir := workDirOrCwd(workDir)
+			if err := loadPromptOverrides(effective, runDir); err != nil {
+				return err
+			}
+
+			results := make([]treetest.Result, 0, len(spec.Tests))
+			for _, c := range spec.Tests {
+				root, opts, err := testTree(doc, c, effective, runDir, filepath.Dir(treePath))
+				if err != nil {
+					results = append(results, treetest.Result{Name: c.Name, Err: err})
+					continue
+				}
+				results = append(results, treetest.RunCase(c, root, opts))
+			}
+
+			treetest.WriteText(os.Stdout, results)
+			if junitPath != "" {
+				if err := writeJUnit(junitPath, filepath.Base(treePath), results); err != nil {
+					return err
+				}
+			}
+			for _, r := range results {
+				if !r.Passed() {
+					return cli.ExitError{Code: 1}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// testTree builds a fresh tree for one case, as run-tree would with the case's vars.
+func testTree(doc *types.Document, c treetest.Case, effective settings.Settings, runDir, treeDir string) (*types.ProcessedNode, run.RunOptions, error) {
+	var opts run.RunOptions
+	resolvedVars, err := types.ResolveVars(doc.Inputs, c.Vars)
+	if err != nil {
+		return nil, opts, fmt.Errorf("tree inputs: %w", err)
+	}
+	defaults := processedDefaultsFromSettings(effective)
+	defaults.Vars = resolvedVars
+	defaults.LookupEnv = settings.TemplateLookupEnv
+	defaults.LookupEnvMetadata = settings.EnvMetadataLookupEnv(effective)
+	defaults.Metadata = doc.Metadata
+	root := types.NodeToProcessedNodeWithDefaults(doc.Root, defaults)
+
+	opts = run.RunOptions{
+		DefaultCLI:         effective["DEFAULT_CLI"],
+		DefaultValidateCLI: effective["DEFAULT_VALIDATE_CLI"],
+		DefaultRetryCLI:    effective["DEFAULT_RETRY_CLI"],
+		WorkDir:            runDir,
+	}
+	opts.DefaultModels, opts.ExtraModels = modelsFromSettings(effective)
+	if err := run.LoadOutputSchemas(root, runDir, treeDir); err != nil {
+		return nil, opts, err
+	}
+	fileOpts, err := fileOptionsFromSettings(effective)
+	if err != nil {
+		return nil, opts, fmt.Errorf("settings: %w", err)
+	}
+	fileOpts.Dirs = []string{runDir, treeDir}
+	fileOpts.Vars = resolvedVars
+	fileOpts.LookupEnv = defaults.LookupEnv
+	warnings, err := run.LoadNodeFiles(root, fileOpts)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s: %s\n", c.Name, w)
+	}
+	if err != nil {
+		return nil, opts, err
+	}
+	return root, opts, nil
+}
+
+func writeJUnit(path, suite string, results []treetest.Result) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := treetest.WriteJUnit(f, suite, results); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
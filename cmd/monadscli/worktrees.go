@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/cli"
+	"github.com/ryanmontgomery/MonadsCLI/internal/gitops"
+)
+
+func worktreesCommand() cli.Command {
+	return cli.Command{
+		Name:        "worktrees",
+		Description: "List or clean up worktrees left by run-tree --isolate (list|prune)",
+		Run: func(fs *flag.FlagSet) error {
+			args := fs.Args()
+			if len(args) == 0 {
+				return fmt.Errorf("missing worktrees subcommand")
+			}
+			switch args[0] {
+			case "list":
+				return worktreesList(args[1:])
+			case "prune":
+				return worktreesPrune(args[1:])
+			default:
+				return fmt.Errorf("unknown worktrees subcommand: %s", args[0])
+			}
+		},
+	}
+}
+
+func worktreesList(args []string) error {
+	fs := flag.NewFlagSet("worktrees list", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	var workDir string
+	fs.StringVar(&workDir, "workdir", "", "Directory inside the repository (default: current dir)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	repo, err := gitops.Open(workDirOrCwd(workDir))
+	if err != nil {
+		return err
+	}
+	list, err := repo.Worktrees()
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Fprintln(os.Stdout, "No isolated worktrees")
+	}
+	for _, w := range list {
+		state := "abandoned"
+		if !w.Abandoned() && w.PID == 0 {
+			state = "locked"
+		} else if !w.Abandoned() {
+			state = fmt.Sprintf("in use (pid %d)", w.PID)
+		}
+		fmt.Fprintf(os.Stdout, "%s\t%s\t%s\n", w.Branch, state, w.Path)
+	}
+	return nil
+}
+
+func worktreesPrune(args []string) error {
+	fs := flag.NewFlagSet("worktrees prune", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	var workDir string
+	var deleteBranches bool
+	fs.StringVar(&workDir, "workdir", "", "Directory inside the repository (default: current dir)")
+	fs.BoolVar(&deleteBranches, "delete-branches", false, "Also delete the monads/* branches of removed worktrees")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	repo, err := gitops.Open(workDirOrCwd(workDir))
+	if err != nil {
+		return err
+	}
+	removed, err := repo.PruneWorktrees(deleteBranches)
+	for _, w := range removed {
+		fmt.Fprintf(os.Stdout, "Removed %s (%s)\n", w.Path, w.Branch)
+	}
+	if err == nil && len(removed) == 0 {
+		fmt.Fprintln(os.Stdout, "No abandoned worktrees")
+	}
+	return err
+}
+
+// isolation is a run-tree --isolate run: nodes run in wt, on its own branch of repo.
+type isolation struct {
+	repo    *gitops.Repo
+	wt      *gitops.Worktree
+	workDir string    // The run's workdir inside wt (same position relative to the repo root).
+	out     io.Writer // Status messages.
+}
+
+// startIsolation creates a worktree and branch for the run from the HEAD of the repo containing workDir.
+// Status messages are written to out.
+func startIsolation(workDir, chartName string, out io.Writer) (*isolation, error) {
+	repo, err := gitops.Open(workDir)
+	if err != nil {
+		return nil, fmt.Errorf("--isolate: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(workDir); err == nil {
+		workDir = resolved
+	}
+	rel, err := filepath.Rel(repo.Dir, workDir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = "."
+	}
+	// Runs of the same chart started in the same second get a -2, -3, ... suffix.
+	name := isolationName(chartName, time.Now())
+	var wt *gitops.Worktree
+	for n := 1; ; n++ {
+		try := name
+		if n > 1 {
+			try = fmt.Sprintf("%s-%d", name, n)
+		}
+		wt, err = repo.AddWorktree(try, "")
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, gitops.ErrWorktreeExists) {
+			return nil, fmt.Errorf("--isolate: %w", err)
+		}
+	}
+	dir := filepath.Join(wt.Dir, rel)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(out, "Isolated run on branch %s in %s\n", wt.Branch, wt.Dir)
+	return &isolation{repo: repo, wt: wt, workDir: dir, out: out}, nil
+}
+
+// finish commits what the run left uncommitted to the branch and removes the worktree. With
+// merge the branch is merged back and deleted; otherwise it is kept for review. A branch
+// without changes is always deleted.
+func (i *isolation) finish(merge bool, chartName string) error {
+	message := "monadscli: " + chartName
+	if chartName == "" {
+		message = "monadscli: isolated run"
+	}
+	if _, err := i.wt.Commit(message); err != nil {
+		return fmt.Errorf("commit isolated run (worktree kept at %s): %w", i.wt.Dir, err)
+	}
+	changed, err := i.wt.Changed()
+	if err != nil {
+		return err
+	}
+	if err := i.repo.RemoveWorktree(i.wt.Dir); err != nil {
+		return err
+	}
+	if !changed {
+		fmt.Fprintf(i.out, "Isolated run made no changes; deleted branch %s\n", i.wt.Branch)
+		return i.repo.DeleteBranch(i.wt.Branch)
+	}
+	if !merge {
+		fmt.Fprintf(i.out, "Branch %s kept for review (git diff HEAD...%s)\n", i.wt.Branch, i.wt.Branch)
+		return nil
+	}
+	if err := i.repo.Merge(i.wt.Branch, "Merge "+i.wt.Branch); err != nil {
+		return fmt.Errorf("merge %s (branch kept for review): %w", i.wt.Branch, err)
+	}
+	fmt.Fprintf(i.out, "Merged %s\n", i.wt.Branch)
+	return i.repo.DeleteBranch(i.wt.Branch)
+}
+
+// isolationName returns the worktree name for a run: the chart title as a lowercase slug
+// (at most 40 characters, "run" when empty) followed by the start time.
+func isolationName(chartName string, t time.Time) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(chartName) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= 40 {
+			break
+		}
+	}
+	slug := strings.Trim(b.String(), "-")
+	if slug == "" {
+		slug = "run"
+	}
+	return slug + "-" + t.Format("20060102-150405")
+}
@@ -0,0 +1,212 @@
+package adapter
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// Message is the final assistant message and run metadata unwrapped from a CLI's
+// machine-readable output envelope.
+type Message struct {
+	Text         string
+	Model        string
+	SessionID    string
+	CostUSD      float64
+	InputTokens  int
+	OutputTokens int
+	IsError      bool
+	ErrorText    string // The CLI's error message when IsError.
+}
+
+// Command returns cli with Prompt switched to NativePrompt when native is true and the
+// CLI has a machine-readable mode; otherwise the text Prompt is kept and OutputFormat is
+// cleared so Apply leaves stdout alone.
+func Command(cli types.CLI, native bool) types.CLI {
+	if native && strings.TrimSpace(cli.NativePrompt) != "" {
+		cli.Prompt = cli.NativePrompt
+		return cli
+	}
+	cli.OutputFormat = ""
+	return cli
+}
+
+// Unwrap decodes stdout as the given output format. ok is false when the format is
+// unknown or stdout is not such an envelope (e.g. the CLI printed plain text).
+func Unwrap(format, stdout string) (Message, bool) {
+	switch format {
+	case types.OutputFormatResultJSON:
+		return unwrapResultJSON(stdout)
+	case types.OutputFormatGeminiJSON:
+		return unwrapGeminiJSON(stdout)
+	default:
+		return Message{}, false
+	}
+}
+
+// Apply unwraps res.Stdout using format. On success Stdout becomes the assistant message,
+// RawStdout keeps the envelope, and model, session, cost, and token fields are filled. An error
+// result fails res with the CLI's message. When stdout is not an envelope res is returned unchanged.
+// Output spilled past the capture limit (res.StdoutFile) is unwrapped from the file, since the
+// truncated Stdout is not valid JSON; RawStdout then keeps the truncated envelope.
+func Apply(format string, res runner.Result) runner.Result {
+	if format == "" {
+		return res
+	}
+	stdout := res.Stdout
+	if res.StdoutFile != "" {
+		if data, err := os.ReadFile(res.StdoutFile); err == nil {
+			stdout = string(data)
+		}
+	}
+	msg, ok := Unwrap(format, stdout)
+	if !ok {
+		return res
+	}
+	res.RawStdout = res.Stdout
+	res.Stdout = msg.Text
+	res.Model = msg.Model
+	res.SessionID = msg.SessionID
+	res.CostUSD = msg.CostUSD
+	res.InputTokens = msg.InputTokens
+	res.OutputTokens = msg.OutputTokens
+	if msg.IsError {
+		res.Success = false
+		if res.Error == "" {
+			res.Error = "agent reported an error result"
+			if text := strings.TrimSpace(msg.ErrorText); text != "" {
+				res.Error += ": " + text
+			}
+		}
+	}
+	return res
+}
+
+// resultEvent is one {"type": ...} object printed by Claude or Cursor in json or stream-json mode.
+type resultEvent struct {
+	Type         string                      `json:"type"`
+	IsError      bool                        `json:"is_error"`
+	Result       *string                     `json:"result"`
+	SessionID    string                      `json:"session_id"`
+	Model        string                      `json:"model"`
+	TotalCostUSD float64                     `json:"total_cost_usd"`
+	Usage        *resultUsage                `json:"usage"`
+	ModelUsage   map[string]resultModelUsage `json:"modelUsage"`
+}
+
+type resultUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+}
+
+type resultModelUsage struct {
+	OutputTokens int `json:"outputTokens"`
+}
+
+// unwrapResultJSON handles a single result object (json mode) or one object per line
+// (stream-json mode), where a system/init event carries the model and the last result
+// event carries the final message, cost, and usage.
+func unwrapResultJSON(stdout string) (Message, bool) {
+	var events []resultEvent
+	var single resultEvent
+	if err := json.Unmarshal([]byte(strings.TrimSpace(stdout)), &single); err == nil {
+		events = append(events, single)
+	} else {
+		for _, line := range strings.Split(stdout, "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "{") {
+				continue
+			}
+			var ev resultEvent
+			if err := json.Unmarshal([]byte(line), &ev); err == nil && ev.Type != "" {
+				events = append(events, ev)
+			}
+		}
+	}
+	var msg Message
+	found := false
+	for _, ev := range events {
+		if ev.Type == "system" && ev.Model != "" {
+			msg.Model = ev.Model
+		}
+		if ev.Type != "result" || ev.Result == nil {
+			continue
+		}
+		found = true
+		msg.Text = *ev.Result
+		msg.IsError = ev.IsError
+		if ev.IsError {
+			msg.ErrorText = *ev.Result
+		}
+		if ev.SessionID != "" {
+			msg.SessionID = ev.SessionID
+		}
+		msg.CostUSD = ev.TotalCostUSD
+		if ev.Usage != nil {
+			msg.InputTokens = ev.Usage.InputTokens + ev.Usage.CacheCreationInputTokens + ev.Usage.CacheReadInputTokens
+			msg.OutputTokens = ev.Usage.OutputTokens
+		}
+		if ev.Model != "" {
+			msg.Model = ev.Model
+		}
+		if m := busiestModel(ev.ModelUsage); m != "" && msg.Model == "" {
+			msg.Model = m
+		}
+	}
+	return msg, found
+}
+
+func busiestModel(usage map[string]resultModelUsage) string {
+	best, bestTokens := "", -1
+	for name, u := range usage {
+		if u.OutputTokens > bestTokens || (u.OutputTokens == bestTokens && name < best) {
+			best, bestTokens = name, u.OutputTokens
+		}
+	}
+	return best
+}
+
+// geminiEnvelope is printed by gemini --output-format json.
+type geminiEnvelope struct {
+	Response *string `json:"response"`
+	Stats    struct {
+		Models map[string]struct {
+			Tokens struct {
+				Prompt     int `json:"prompt"`
+				Candidates int `json:"candidates"`
+				Total      int `json:"total"`
+			} `json:"tokens"`
+		} `json:"models"`
+	} `json:"stats"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func unwrapGeminiJSON(stdout string) (Message, bool) {
+	var env geminiEnvelope
+	if err := json.Unmarshal([]byte(strings.TrimSpace(stdout)), &env); err != nil || (env.Response == nil && env.Error == nil) {
+		return Message{}, false
+	}
+	var msg Message
+	if env.Response != nil {
+		msg.Text = *env.Response
+	}
+	if env.Error != nil {
+		msg.IsError, msg.ErrorText = true, env.Error.Message
+	}
+	bestTotal := -1
+	for name, m := range env.Stats.Models {
+		msg.InputTokens += m.Tokens.Prompt
+		msg.OutputTokens += m.Tokens.Candidates
+		if m.Tokens.Total > bestTotal || (m.Tokens.Total == bestTotal && name < msg.Model) {
+			msg.Model, bestTotal = name, m.Tokens.Total
+		}
+	}
+	return msg, true
+}
@@ -0,0 +1,103 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func TestCommand(t *testing.T) {
+	native := Command(types.ClaudeCLI, true)
+	if !strings.Contains(native.Prompt, "--output-format json") {
+		t.Errorf("Command(CLAUDE, native) Prompt = %q", native.Prompt)
+	}
+	if native.OutputFormat != types.OutputFormatResultJSON {
+		t.Errorf("OutputFormat = %q", native.OutputFormat)
+	}
+	text := Command(types.ClaudeCLI, false)
+	if text.Prompt != types.ClaudeCLI.Prompt || text.OutputFormat != "" {
+		t.Errorf("Command(CLAUDE, text) = %q / %q", text.Prompt, text.OutputFormat)
+	}
+	aider := Command(types.AiderCLI, true)
+	if aider.Prompt != types.AiderCLI.Prompt || aider.OutputFormat != "" {
+		t.Errorf("Command(AIDER, native) should fall back to text mode: %q / %q", aider.Prompt, aider.OutputFormat)
+	}
+}
+
+func TestUnwrapResultJSON(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		stdout := `{"type":"result","subtype":"success","is_error":false,"result":"{\"completed\": true}","session_id":"s-1","total_cost_usd":0.0123,"usage":{"input_tokens":10,"cache_read_input_tokens":5,"output_tokens":7},"modelUsage":{"claude-haiku":{"outputTokens":1},"claude-sonnet":{"outputTokens":6}}}`
+		msg, ok := Unwrap(types.OutputFormatResultJSON, stdout)
+		if !ok {
+			t.Fatal("Unwrap ok = false")
+		}
+		if msg.Text != `{"completed": true}` || msg.SessionID != "s-1" || msg.CostUSD != 0.0123 {
+			t.Errorf("msg = %+v", msg)
+		}
+		if msg.InputTokens != 15 || msg.OutputTokens != 7 || msg.Model != "claude-sonnet" {
+			t.Errorf("usage = %+v", msg)
+		}
+	})
+	t.Run("stream_json", func(t *testing.T) {
+		stdout := strings.Join([]string{
+			`{"type":"system","subtype":"init","model":"claude-opus","session_id":"s-2"}`,
+			`{"type":"assistant","message":{"content":[{"type":"text","text":"working"}]}}`,
+			`{"type":"result","subtype":"success","result":"done","session_id":"s-2","usage":{"input_tokens":3,"output_tokens":4}}`,
+		}, "\n")
+		msg, ok := Unwrap(types.OutputFormatResultJSON, stdout)
+		if !ok {
+			t.Fatal("Unwrap ok = false")
+		}
+		if msg.Text != "done" || msg.Model != "claude-opus" || msg.SessionID != "s-2" || msg.OutputTokens != 4 {
+			t.Errorf("msg = %+v", msg)
+		}
+	})
+	t.Run("plain_text", func(t *testing.T) {
+		if _, ok := Unwrap(types.OutputFormatResultJSON, `{"completed": true}`); ok {
+			t.Error("Unwrap(plain response) ok = true, want false")
+		}
+	})
+}
+
+func TestUnwrapGeminiJSON(t *testing.T) {
+	stdout := `{"response":"{\"answer\":\"Yes\"}","stats":{"models":{"gemini-2.5-pro":{"tokens":{"prompt":100,"candidates":20,"total":120}},"gemini-2.5-flash":{"tokens":{"prompt":5,"candidates":1,"total":6}}}}}`
+	msg, ok := Unwrap(types.OutputFormatGeminiJSON, stdout)
+	if !ok {
+		t.Fatal("Unwrap ok = false")
+	}
+	if msg.Text != `{"answer":"Yes"}` || msg.Model != "gemini-2.5-pro" || msg.InputTokens != 105 || msg.OutputTokens != 21 {
+		t.Errorf("msg = %+v", msg)
+	}
+}
+
+func TestApply(t *testing.T) {
+	res := Apply(types.OutputFormatResultJSON, runner.Result{Stdout: `{"type":"result","is_error":true,"result":"boom","session_id":"x"}`, Success: true})
+	if res.Stdout != "boom" || res.RawStdout == "" || res.SessionID != "x" || res.Success || !strings.Contains(res.Error, "boom") {
+		t.Errorf("Apply = %+v", res)
+	}
+	gemini := Apply(types.OutputFormatGeminiJSON, runner.Result{Stdout: `{"error":{"type":"ApiError","message":"quota exceeded"}}`, Success: true})
+	if gemini.Success || !strings.Contains(gemini.Error, "quota exceeded") || gemini.RawStdout == "" {
+		t.Errorf("Apply(gemini error) = %+v", gemini)
+	}
+	plain := Apply(types.OutputFormatResultJSON, runner.Result{Stdout: "hello"})
+	if plain.Stdout != "hello" || plain.RawStdout != "" {
+		t.Errorf("Apply(plain) = %+v", plain)
+	}
+}
+
+func TestApply_spilledOutput(t *testing.T) {
+	envelope := `{"type":"result","result":"done","usage":{"input_tokens":10,"output_tokens":` + strings.Repeat(" ", 100) + `5}}`
+	spill := filepath.Join(t.TempDir(), "stdout")
+	if err := os.WriteFile(spill, []byte(envelope), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	truncated := runner.TruncateMiddle(envelope, 40)
+	res := Apply(types.OutputFormatResultJSON, runner.Result{Stdout: truncated, StdoutFile: spill, Success: true})
+	if res.Stdout != "done" || res.InputTokens != 10 || res.OutputTokens != 5 || res.RawStdout != truncated {
+		t.Errorf("Apply(spilled) = %+v", res)
+	}
+}
@@ -0,0 +1,269 @@
+// Package analyze enumerates the ways a tree can execute and measures which routes past runs
+// have taken (monadscli analyze).
+package analyze
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/run"
+	"github.com/ryanmontgomery/MonadsCLI/internal/runlog"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// MaxPaths bounds path enumeration; larger trees report Truncated.
+const MaxPaths = 10000
+
+// Step is one node on a path and the route taken out of it ("" for an unlabeled route and for
+// the last node).
+type Step struct {
+	Node  string `json:"node"`
+	Route string `json:"route,omitempty"`
+}
+
+// Path is one root-to-leaf execution of the tree.
+type Path struct {
+	Steps []Step `json:"steps"`
+	Calls int    `json:"worst_case_calls"` // Sum of run.WorstCaseCalls over the path.
+	Loop  bool   `json:"loop,omitempty"`   // The path returns to a node already on it (its last step) and is cut there.
+}
+
+// Analysis lists every path of a tree.
+type Analysis struct {
+	Paths     []Path `json:"paths"`
+	MaxCalls  int    `json:"worst_case_calls"` // Most agent calls of any path.
+	Worst     int    `json:"worst_path"`       // Index in Paths of a path with MaxCalls.
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// Paths enumerates the root-to-leaf paths of root, routes in sorted order, with the worst-case
+// agent calls of each (guard adds the run's path guardrails, see run.WorstCaseCalls).
+func Paths(root *types.ProcessedNode, guard *run.PathGuard) Analysis {
+	var a Analysis
+	if root == nil {
+		return a
+	}
+	var steps []Step
+	onPath := map[*types.ProcessedNode]bool{}
+	var walk func(node *types.ProcessedNode, calls int)
+	walk = func(node *types.ProcessedNode, calls int) {
+		if len(a.Paths) >= MaxPaths {
+			a.Truncated = true
+			return
+		}
+		if onPath[node] {
+			a.add(append(steps, Step{Node: node.Name}), calls, true)
+			return
+		}
+		calls += run.WorstCaseCalls(node, guard)
+		if len(node.Children) == 0 {
+			a.add(append(steps, Step{Node: node.Name}), calls, false)
+			return
+		}
+		onPath[node] = true
+		for _, route := range sortedRoutes(node.Children) {
+			steps = append(steps, Step{Node: node.Name, Route: route})
+			walk(node.Children[route], calls)
+			steps = steps[:len(steps)-1]
+		}
+		onPath[node] = false
+	}
+	walk(root, 0)
+	return a
+}
+
+func (a *Analysis) add(steps []Step, calls int, loop bool) {
+	a.Paths = append(a.Paths, Path{Steps: append([]Step(nil), steps...), Calls: calls, Loop: loop})
+	if calls > a.MaxCalls {
+		a.MaxCalls = calls
+		a.Worst = len(a.Paths) - 1
+	}
+}
+
+// FormatPath renders a path as "A -> B -[route]-> C".
+func FormatPath(steps []Step) string {
+	var b strings.Builder
+	for i, s := range steps {
+		b.WriteString(s.Node)
+		if i == len(steps)-1 {
+			break
+		}
+		if s.Route == "" {
+			b.WriteString(" -> ")
+		} else {
+			b.WriteString(" -[" + s.Route + "]-> ")
+		}
+	}
+	return b.String()
+}
+
+// Route is one branch of a decision or approval node.
+type Route struct {
+	From  string `json:"from"`
+	Route string `json:"route"`
+	To    string `json:"to"`
+	Via   []Step `json:"via"`   // Path from the root to From (first occurrence).
+	Taken int    `json:"taken"` // Runs that took this route.
+}
+
+// Coverage reports which branch routes the short logs of past runs have taken.
+type Coverage struct {
+	Logs    int      `json:"logs"`              // Short logs that matched the tree.
+	Skipped []string `json:"skipped,omitempty"` // Short logs of another chart, or that do not fit the tree.
+	Routes  []Route  `json:"routes"`
+}
+
+// Untaken returns the routes no run has taken.
+func (c Coverage) Untaken() []Route {
+	var out []Route
+	for _, r := range c.Routes {
+		if r.Taken == 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+type routeKey struct {
+	node  *types.ProcessedNode
+	route string
+}
+
+// LoadCoverage reads the short logs in dir (short.json in each run_<time> directory, and the
+// run_<time>.json files of older versions) and traces each through root.
+// Logs of another chart (when chart is set) or whose nodes do not follow the tree are skipped.
+// Branch routes are those of decision nodes (two or more routes) and approval nodes.
+func LoadCoverage(root *types.ProcessedNode, dir, chart string) (Coverage, error) {
+	var c Coverage
+	index := map[routeKey]int{}
+	var steps []Step
+	seen := map[*types.ProcessedNode]bool{}
+	var walk func(*types.ProcessedNode)
+	walk = func(node *types.ProcessedNode) {
+		if node == nil || seen[node] {
+			return
+		}
+		seen[node] = true
+		for _, route := range sortedRoutes(node.Children) {
+			if isBranch(node) {
+				index[routeKey{node, route}] = len(c.Routes)
+				c.Routes = append(c.Routes, Route{From: node.Name, Route: route, To: node.Children[route].Name, Via: append([]Step(nil), steps...)})
+			}
+			steps = append(steps, Step{Node: node.Name, Route: route})
+			walk(node.Children[route])
+			steps = steps[:len(steps)-1]
+		}
+	}
+	walk(root)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return c, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "run_") {
+			continue
+		}
+		if e.IsDir() {
+			// A run directory; runs without a short log (WRITE_LOG_SHORT off) have nothing to trace.
+			name = filepath.Join(name, runlog.ShortLogFile)
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				continue
+			}
+		} else if !strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".state.json") {
+			continue
+		}
+		logChart, nodes, err := runlog.ReadShortLog(filepath.Join(dir, name))
+		if err != nil || (chart != "" && logChart != chart) {
+			c.Skipped = append(c.Skipped, name)
+			continue
+		}
+		taken, ok := trace(root, nodes)
+		if !ok {
+			c.Skipped = append(c.Skipped, name)
+			continue
+		}
+		c.Logs++
+		for _, k := range taken {
+			if i, ok := index[k]; ok {
+				c.Routes[i].Taken++
+			}
+		}
+	}
+	return c, nil
+}
+
+// trace follows a logged run through the tree and returns the routes it took. It reports false
+// when the logged nodes do not match the tree.
+func trace(root *types.ProcessedNode, nodes []runlog.ShortEntry) ([]routeKey, bool) {
+	var taken []routeKey
+	node := root
+	for i, e := range nodes {
+		if node == nil || e.NodeName != node.Name {
+			return nil, false
+		}
+		if len(node.Children) == 0 || i == len(nodes)-1 {
+			break
+		}
+		route, ok := routeTaken(node, e, nodes[i+1].NodeName)
+		if !ok {
+			return nil, false
+		}
+		taken = append(taken, routeKey{node, route})
+		node = node.Children[route]
+	}
+	return taken, true
+}
+
+// routeTaken returns the route a logged node took: from its recorded approval or decision
+// answer, else the only route, else the only route to a node named next.
+func routeTaken(node *types.ProcessedNode, e runlog.ShortEntry, next string) (string, bool) {
+	if node.Approval {
+		if a, err := run.ParseApproval(e.Response); err == nil {
+			if child, err := run.ApprovalChild(node, a); err == nil && child != nil {
+				for route, c := range node.Children {
+					if c == child {
+						return route, true
+					}
+				}
+			}
+		}
+	} else if len(node.Children) > 1 {
+		if d, err := types.ParseDecisionResponse(e.Response); err == nil {
+			if _, ok := node.Children[d.Answer]; ok {
+				return d.Answer, true
+			}
+			for route := range node.Children {
+				if strings.EqualFold(strings.TrimSpace(route), strings.TrimSpace(d.Answer)) {
+					return route, true
+				}
+			}
+		}
+	}
+	var match []string
+	for _, route := range sortedRoutes(node.Children) {
+		if len(node.Children) == 1 || node.Children[route].Name == next {
+			match = append(match, route)
+		}
+	}
+	if len(match) != 1 {
+		return "", false
+	}
+	return match[0], true
+}
+
+func isBranch(node *types.ProcessedNode) bool {
+	return len(node.Children) > 1 || (node.Approval && len(node.Children) > 0)
+}
+
+func sortedRoutes(children map[string]*types.ProcessedNode) []string {
+	routes := make([]string, 0, len(children))
+	for route := range children {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
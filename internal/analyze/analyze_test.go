@@ -0,0 +1,85 @@
+package analyze
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func newTree() *types.ProcessedNode {
+	fix := &types.ProcessedNode{Name: "Fix", Prompt: "Fix the bug", ValidatePrompt: "Fixed?", Retries: 2}
+	done := &types.ProcessedNode{Name: "Done", Prompt: "Write notes"}
+	review := &types.ProcessedNode{Name: "Review", Approval: true, Children: map[string]*types.ProcessedNode{"approved": done}}
+	fix.Children = map[string]*types.ProcessedNode{"": review}
+	return &types.ProcessedNode{Name: "Broken?", Prompt: "Is the build broken?", Children: map[string]*types.ProcessedNode{
+		"yes": fix,
+		"no":  done,
+	}}
+}
+
+func TestPaths(t *testing.T) {
+	a := Paths(newTree(), nil)
+	if len(a.Paths) != 2 {
+		t.Fatalf("paths = %+v", a.Paths)
+	}
+	if got := FormatPath(a.Paths[0].Steps); got != "Broken? -[no]-> Done" || a.Paths[0].Calls != 2 {
+		t.Errorf("path 0 = %s, %d calls", got, a.Paths[0].Calls)
+	}
+	// Broken? 1, Fix (run + validation) x 3 attempts, Review 0, Done 1.
+	if got := FormatPath(a.Paths[1].Steps); got != "Broken? -[yes]-> Fix -> Review -[approved]-> Done" || a.Paths[1].Calls != 8 {
+		t.Errorf("path 1 = %s, %d calls", got, a.Paths[1].Calls)
+	}
+	if a.MaxCalls != 8 || a.Worst != 1 {
+		t.Errorf("worst = %d calls on path %d", a.MaxCalls, a.Worst)
+	}
+
+	loop := &types.ProcessedNode{Name: "Again?"}
+	loop.Children = map[string]*types.ProcessedNode{"yes": loop, "no": {Name: "End"}}
+	a = Paths(loop, nil)
+	if len(a.Paths) != 2 || !a.Paths[1].Loop || FormatPath(a.Paths[1].Steps) != "Again? -[yes]-> Again?" {
+		t.Errorf("loop paths = %+v", a.Paths)
+	}
+}
+
+func TestLoadCoverage(t *testing.T) {
+	dir := t.TempDir()
+	logs := map[string]string{
+		"run_1/short.json": `{"chart": "Triage", "nodes": [
+			{"node_name": "Broken?", "response": "{\"choices\": [\"yes\", \"no\"], \"answer\": \"Yes\"}"},
+			{"node_name": "Fix", "response": "{\"completed\": true}"},
+			{"node_name": "Review", "response": "{\"decision\": \"approve\"}"},
+			{"node_name": "Done", "response": "{\"completed\": true}"}
+		]}`,
+		"run_2.json":       `{"chart": "Other", "nodes": [{"node_name": "Broken?", "response": "{\"answer\": \"no\"}"}]}`,
+		"run_3.json":       `{"chart": "Triage", "nodes": [{"node_name": "Deploy"}]}`,
+		"run_4.state.json": `{"chart": "Triage", "completed": []}`,
+		"run_5/state.json": `{"chart": "Triage", "completed": []}`,
+	}
+	for name, body := range logs {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := LoadCoverage(newTree(), dir, "Triage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Logs != 1 || len(c.Skipped) != 2 {
+		t.Errorf("logs = %d, skipped = %v", c.Logs, c.Skipped)
+	}
+	if len(c.Routes) != 3 {
+		t.Fatalf("routes = %+v", c.Routes)
+	}
+	untaken := c.Untaken()
+	if len(untaken) != 1 || untaken[0].From != "Broken?" || untaken[0].Route != "no" {
+		t.Errorf("untaken = %+v", untaken)
+	}
+	if r := c.Routes[2]; r.From != "Review" || r.Taken != 1 || len(r.Via) != 2 || r.Via[1].Node != "Fix" {
+		t.Errorf("review route = %+v", r)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/ryanmontgomery/MonadsCLI/types"
@@ -218,7 +219,7 @@ func TransformFromCSV(data []byte) (*types.Document, error) {
 	idxStatus := col("Status")
 	idxText1 := col("Text Area 1")
 	idxComments := col("Comments")
-	idxTestprop := col("testprop")
+	metadataCols := customColumns(header)
 
 	if idxID < 0 || idxName < 0 {
 		return nil, fmt.Errorf("CSV missing required columns (Id, Name)")
@@ -245,11 +246,13 @@ func TransformFromCSV(data []byte) (*types.Document, error) {
 			if s := strings.TrimSpace(safeAt(row, idxStatus)); s != "" {
 				doc.Status = s
 			}
+			doc.Metadata = mergeMetadata(rowMetadata(row, metadataCols), doc.Metadata)
 			continue
 		}
 
-		// Page row - skip
+		// Page row: custom data adds to document metadata (the Document row wins)
 		if name == "Page" {
+			doc.Metadata = mergeMetadata(doc.Metadata, rowMetadata(row, metadataCols))
 			continue
 		}
 
@@ -298,15 +301,16 @@ func TransformFromCSV(data []byte) (*types.Document, error) {
 				n.Tags = []string{tags}
 			}
 		}
-		if idxTestprop >= 0 {
-			tp := strings.TrimSpace(safeAt(row, idxTestprop))
-			if tp != "" {
-				n.Metadata = map[string]string{"testprop": tp}
-			}
-		}
+		n.Metadata = rowMetadata(row, metadataCols)
 		nodes[id] = n
 	}
 
+	inputs, err := types.ParseInputs(doc.Metadata[types.DocumentInputsKey])
+	if err != nil {
+		return nil, fmt.Errorf("document inputs: %w", err)
+	}
+	doc.Inputs = inputs
+
 	// Build outEdges from lines (use row Id for shapes, Line Source/Dest reference shape Id from CSV)
 	// In CSV, Line Source and Line Destination are the Id values (3,4,5,6,7)
 	outEdges := make(map[string][]struct{ route string; destID string })
@@ -330,6 +334,56 @@ func TransformFromCSV(data []byte) (*types.Document, error) {
 	return doc, nil
 }
 
+// standardColumns are the Lucid CSV export columns with a fixed meaning. Every other
+// column (e.g. testprop, model, inputs) is custom data and becomes metadata.
+var standardColumns = map[string]bool{
+	"Id": true, "Name": true, "Shape Library": true, "Page ID": true, "Contained By": true,
+	"Group": true, "Line Source": true, "Line Destination": true, "Source Arrow": true,
+	"Destination Arrow": true, "Tags": true, "Status": true, "Comments": true,
+}
+
+// customColumns returns column index -> name for the non-standard columns in header.
+func customColumns(header []string) map[int]string {
+	out := make(map[int]string)
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		if h == "" || standardColumns[h] || strings.HasPrefix(h, "Text Area ") {
+			continue
+		}
+		out[i] = h
+	}
+	return out
+}
+
+// rowMetadata returns the non-empty custom column values of row, or nil when there are none.
+func rowMetadata(row []string, cols map[int]string) map[string]string {
+	var out map[string]string
+	for i, name := range cols {
+		v := strings.TrimSpace(safeAt(row, i))
+		if v == "" {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[name] = v
+	}
+	return out
+}
+
+// mergeMetadata returns base with the keys of extra that base does not set.
+func mergeMetadata(base, extra map[string]string) map[string]string {
+	for k, v := range extra {
+		if base == nil {
+			base = make(map[string]string)
+		}
+		if _, ok := base[k]; !ok {
+			base[k] = v
+		}
+	}
+	return base
+}
+
 func safeAt(row []string, i int) string {
 	if i < 0 || i >= len(row) {
 		return ""
@@ -355,9 +409,21 @@ func TransformToCSV(doc *types.Document) ([]byte, error) {
 
 	var buf strings.Builder
 	w := csv.NewWriter(&buf)
-	if err := w.Write(strings.Split(csvHeader, ",")); err != nil {
+	header := strings.Split(csvHeader, ",")
+	extraCols := extraMetadataColumns(doc)
+	header = append(header, extraCols...)
+	if err := w.Write(header); err != nil {
 		return nil, err
 	}
+	// metadataCells returns the testprop cell followed by one cell per extra column.
+	metadataCells := func(metadata map[string]string) []string {
+		cells := []string{metadata["testprop"]}
+		for _, c := range extraCols {
+			cells = append(cells, metadata[c])
+		}
+		return cells
+	}
+	blankCells := metadataCells(nil)
 
 	nextID := 1
 	nodeToID := make(map[*types.Node]int)
@@ -385,11 +451,12 @@ func TransformToCSV(doc *types.Document) ([]byte, error) {
 	if status == "" {
 		status = "Draft"
 	}
-	if err := w.Write([]string{"1", "Document", "", "", "", "", "", "", "", "", "", status, doc.Title, "", ""}); err != nil {
+	docRow := []string{"1", "Document", "", "", "", "", "", "", "", "", "", status, doc.Title, ""}
+	if err := w.Write(append(docRow, metadataCells(documentMetadata(doc))...)); err != nil {
 		return nil, err
 	}
 	// Page row (Id=2)
-	if err := w.Write([]string{"2", "Page", "", "", "", "", "", "", "", "", "", "", "Page 1", "", ""}); err != nil {
+	if err := w.Write(append([]string{"2", "Page", "", "", "", "", "", "", "", "", "", "", "Page 1", ""}, blankCells...)); err != nil {
 		return nil, err
 	}
 
@@ -404,15 +471,11 @@ func TransformToCSV(doc *types.Document) ([]byte, error) {
 		if len(n.Tags) > 0 {
 			tags = n.Tags[0]
 		}
-		testprop := ""
-		if n.Metadata != nil {
-			testprop = n.Metadata["testprop"]
-		}
 		row := []string{
 			fmt.Sprint(id), n.Label, n.ShapeLibrary, "2", "", "",
-			"", "", "", "", tags, n.Status, n.Text, n.Comments, testprop,
+			"", "", "", "", tags, n.Status, n.Text, n.Comments,
 		}
-		if err := w.Write(row); err != nil {
+		if err := w.Write(append(row, metadataCells(n.Metadata)...)); err != nil {
 			panic(err)
 		}
 		for _, child := range n.Children {
@@ -427,9 +490,9 @@ func TransformToCSV(doc *types.Document) ([]byte, error) {
 		row := []string{
 			fmt.Sprint(nextID), "Line", "", "2", "", "",
 			fmt.Sprint(e.srcID), fmt.Sprint(e.dstID), "None", "Arrow",
-			tags, "", "", "", "",
+			tags, "", "", "",
 		}
-		if err := w.Write(row); err != nil {
+		if err := w.Write(append(row, blankCells...)); err != nil {
 			return nil, err
 		}
 		nextID++
@@ -441,3 +504,49 @@ func TransformToCSV(doc *types.Document) ([]byte, error) {
 	}
 	return []byte(strings.TrimSpace(buf.String())), nil
 }
+
+// documentMetadata returns doc.Metadata with doc.Inputs encoded under the "inputs" key.
+func documentMetadata(doc *types.Document) map[string]string {
+	out := make(map[string]string, len(doc.Metadata)+1)
+	for k, v := range doc.Metadata {
+		out[k] = v
+	}
+	if len(doc.Inputs) > 0 {
+		if b, err := json.Marshal(doc.Inputs); err == nil {
+			out[types.DocumentInputsKey] = string(b)
+		}
+	}
+	return out
+}
+
+// extraMetadataColumns returns the sorted metadata keys used by the document or any node,
+// other than testprop, which is already part of csvHeader.
+func extraMetadataColumns(doc *types.Document) []string {
+	seen := make(map[string]bool)
+	for k := range documentMetadata(doc) {
+		seen[k] = true
+	}
+	var walk func(n *types.Node, visited map[*types.Node]bool)
+	walk = func(n *types.Node, visited map[*types.Node]bool) {
+		if n == nil || visited[n] {
+			return
+		}
+		visited[n] = true
+		for k := range n.Metadata {
+			seen[k] = true
+		}
+		for _, child := range n.Children {
+			walk(child, visited)
+		}
+	}
+	walk(doc.Root, make(map[*types.Node]bool))
+	delete(seen, "testprop")
+	cols := make([]string, 0, len(seen))
+	for k := range seen {
+		if !standardColumns[k] && !strings.HasPrefix(k, "Text Area ") {
+			cols = append(cols, k)
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
@@ -119,6 +119,43 @@ func TestTransformFromCSV(t *testing.T) {
 	}
 }
 
+func TestTransformCSV_customColumnsAndInputs(t *testing.T) {
+	data := strings.Join([]string{
+		"Id,Name,Shape Library,Page ID,Contained By,Group,Line Source,Line Destination,Source Arrow,Destination Arrow,Tags,Status,Text Area 1,Comments,testprop,model,inputs",
+		`1,Document,,,,,,,,,,Draft,Tree,,,,"[{""name"":""ticket"",""required"":true}]"`,
+		"2,Page,,,,,,,,,,,Page 1,,,sonnet,",
+		"3,Process,,2,,,,,,,,,Fix {{vars.ticket}},,,haiku,",
+	}, "\n")
+	doc, err := TransformFromCSV([]byte(data))
+	if err != nil {
+		t.Fatalf("TransformFromCSV: %v", err)
+	}
+	if len(doc.Inputs) != 1 || doc.Inputs[0].Name != "ticket" || !doc.Inputs[0].Required {
+		t.Errorf("doc.Inputs = %+v", doc.Inputs)
+	}
+	if doc.Metadata["model"] != "sonnet" {
+		t.Errorf("doc.Metadata = %v, want model=sonnet from the Page row", doc.Metadata)
+	}
+	if want := map[string]string{"model": "haiku"}; !reflect.DeepEqual(doc.Root.Metadata, want) {
+		t.Errorf("root.Metadata = %v, want %v", doc.Root.Metadata, want)
+	}
+	out, err := TransformToCSV(doc)
+	if err != nil {
+		t.Fatalf("TransformToCSV: %v", err)
+	}
+	doc2, err := TransformFromCSV(out)
+	if err != nil {
+		t.Fatalf("TransformFromCSV (roundtrip): %v", err)
+	}
+	if !reflect.DeepEqual(doc.Inputs, doc2.Inputs) || !reflect.DeepEqual(doc.Metadata, doc2.Metadata) || !nodeEqual(doc.Root, doc2.Root) {
+		t.Errorf("roundtrip lost custom columns:\n%s", out)
+	}
+	bad := strings.Replace(data, `""required"":true}]`, `""type"":""date""}]`, 1)
+	if _, err := TransformFromCSV([]byte(bad)); err == nil {
+		t.Error("TransformFromCSV(bad inputs) err = nil")
+	}
+}
+
 func TestTransformFromLucidJSON_Empty(t *testing.T) {
 	doc, err := TransformFromLucidJSON([]byte(`{"id":"x","title":"Empty","pages":[{"items":{"shapes":[],"lines":[]}}]}`))
 	if err != nil {
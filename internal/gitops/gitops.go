@@ -0,0 +1,284 @@
+package gitops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotRepo is returned by Open when the directory is not inside a git worktree.
+var ErrNotRepo = errors.New("not a git repository")
+
+// Repo runs git in one worktree.
+type Repo struct {
+	Dir     string   // Worktree root.
+	Exclude []string // Paths (relative to Dir) left out of snapshots and commits, e.g. the log dir.
+}
+
+// Snapshot is the state of the worktree at one point: HEAD plus a tree object holding every
+// tracked and untracked (not ignored) file. Creating it does not touch the index or worktree.
+type Snapshot struct {
+	Head string `json:"head,omitempty"` // Empty in a repository without commits.
+	Tree string `json:"tree"`
+}
+
+// Open returns the Repo for the worktree containing dir.
+func Open(dir string) (*Repo, error) {
+	if dir == "" {
+		dir = "."
+	}
+	out, err := git(dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotRepo, dir)
+	}
+	return &Repo{Dir: strings.TrimSpace(out)}, nil
+}
+
+// Snapshot records the current worktree as a tree object using a temporary index.
+func (r *Repo) Snapshot() (Snapshot, error) {
+	head, _ := r.run(nil, "rev-parse", "--verify", "-q", "HEAD")
+	tree, err := r.writeTree()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{Head: strings.TrimSpace(head), Tree: tree}, nil
+}
+
+// Diff returns the unified diff from s to the current worktree.
+func (r *Repo) Diff(s Snapshot) (string, error) {
+	tree, err := r.writeTree()
+	if err != nil {
+		return "", err
+	}
+	return r.run(nil, "diff", "--no-color", "--binary", s.Tree, tree)
+}
+
+// Reset restores the worktree to s: changed and deleted files are checked out from the
+// snapshot, files created since are removed, and HEAD is moved back if it changed.
+// Excluded paths are left alone.
+func (r *Repo) Reset(s Snapshot) error {
+	current, err := r.writeTree()
+	if err != nil {
+		return err
+	}
+	added, err := r.run(nil, "diff-tree", "-r", "-z", "--name-only", "--no-renames", "--diff-filter=A", s.Tree, current)
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Split(added, "\x00") {
+		if name == "" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.Dir, filepath.FromSlash(name))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := r.withTempIndex(func(env []string) error {
+		if _, err := r.run(env, "read-tree", s.Tree); err != nil {
+			return err
+		}
+		_, err := r.run(env, "checkout-index", "-a", "-f")
+		return err
+	}); err != nil {
+		return err
+	}
+	if s.Head != "" {
+		head, _ := r.run(nil, "rev-parse", "--verify", "-q", "HEAD")
+		if strings.TrimSpace(head) != s.Head {
+			if _, err := r.run(nil, "reset", "-q", s.Head); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ChangedFiles returns the paths (slash-separated, relative to Dir) added, modified, or
+// deleted since s. Ignored and excluded files are not reported.
+func (r *Repo) ChangedFiles(s Snapshot) ([]string, error) {
+	current, err := r.writeTree()
+	if err != nil {
+		return nil, err
+	}
+	out, err := r.run(nil, "diff-tree", "-r", "-z", "--name-only", "--no-renames", s.Tree, current)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range strings.Split(out, "\x00") {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// IgnoredFiles returns the untracked files git ignores (.gitignore and friends), slash-separated
+// and relative to Dir. Snapshots leave them out. Excluded paths are not reported.
+func (r *Repo) IgnoredFiles() ([]string, error) {
+	args := append([]string{"ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--", "."}, r.excludeSpecs()...)
+	out, err := r.run(nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range strings.Split(out, "\x00") {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// RestorePaths returns the given paths (relative to Dir) to their state in s: files that
+// existed are checked out from the snapshot and files created since are removed.
+func (r *Repo) RestorePaths(s Snapshot, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	out, err := r.run([]string{"GIT_LITERAL_PATHSPECS=1"}, append([]string{"ls-tree", "-r", "-z", "--name-only", s.Tree, "--"}, paths...)...)
+	if err != nil {
+		return err
+	}
+	existed := make(map[string]bool)
+	for _, name := range strings.Split(out, "\x00") {
+		existed[name] = true
+	}
+	var restore []string
+	for _, p := range paths {
+		if existed[p] {
+			restore = append(restore, p)
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.Dir, filepath.FromSlash(p))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if len(restore) == 0 {
+		return nil
+	}
+	return r.withTempIndex(func(env []string) error {
+		if _, err := r.run(env, "read-tree", s.Tree); err != nil {
+			return err
+		}
+		_, err := r.run(env, append([]string{"checkout-index", "-f", "--"}, restore...)...)
+		return err
+	})
+}
+
+// Commit stages every change (except Exclude) and commits it with message. It returns the
+// new commit hash, or "" when there was nothing to commit.
+func (r *Repo) Commit(message string) (string, error) {
+	args := append([]string{"add", "-A", "--", "."}, r.excludeSpecs()...)
+	if _, err := r.run(nil, args...); err != nil {
+		return "", err
+	}
+	if _, err := r.run(nil, "diff", "--cached", "--quiet"); err == nil {
+		return "", nil
+	}
+	if _, err := r.run(nil, "commit", "-q", "--no-verify", "-m", message); err != nil {
+		return "", err
+	}
+	hash, err := r.run(nil, "rev-parse", "HEAD")
+	return strings.TrimSpace(hash), err
+}
+
+// CommitSince commits only the files changed since s (ChangedFiles) with message; other changes
+// in the worktree and index are left as they are. It returns the new commit hash, or "" when
+// there was nothing to commit.
+func (r *Repo) CommitSince(s Snapshot, message string) (string, error) {
+	files, err := r.ChangedFiles(s)
+	if err != nil || len(files) == 0 {
+		return "", err
+	}
+	env := []string{"GIT_LITERAL_PATHSPECS=1"}
+	if _, err := r.run(env, append([]string{"add", "-A", "--"}, files...)...); err != nil {
+		return "", err
+	}
+	if _, err := r.run(env, append([]string{"diff", "--cached", "--quiet", "--"}, files...)...); err == nil {
+		return "", nil
+	}
+	if _, err := r.run(env, append([]string{"commit", "-q", "--no-verify", "-m", message, "--only", "--"}, files...)...); err != nil {
+		return "", err
+	}
+	hash, err := r.run(nil, "rev-parse", "HEAD")
+	return strings.TrimSpace(hash), err
+}
+
+// Dirty reports whether the worktree has uncommitted changes or untracked files, staged or
+// not. Ignored and excluded files do not count.
+func (r *Repo) Dirty() (bool, error) {
+	args := append([]string{"status", "--porcelain", "-z", "--", "."}, r.excludeSpecs()...)
+	out, err := r.run(nil, args...)
+	return out != "", err
+}
+
+// writeTree adds the whole worktree to a temporary index and writes it as a tree object.
+func (r *Repo) writeTree() (string, error) {
+	var tree string
+	err := r.withTempIndex(func(env []string) error {
+		args := append([]string{"add", "-A", "--", "."}, r.excludeSpecs()...)
+		if _, err := r.run(env, args...); err != nil {
+			return err
+		}
+		out, err := r.run(env, "write-tree")
+		tree = strings.TrimSpace(out)
+		return err
+	})
+	return tree, err
+}
+
+// withTempIndex runs f with GIT_INDEX_FILE pointing at a fresh index seeded from HEAD.
+func (r *Repo) withTempIndex(f func(env []string) error) error {
+	tmp, err := os.CreateTemp("", "monads-index-*")
+	if err != nil {
+		return err
+	}
+	path := tmp.Name()
+	tmp.Close()
+	os.Remove(path) // git creates the index itself; an empty file is not a valid index
+	defer os.Remove(path)
+	env := []string{"GIT_INDEX_FILE=" + path}
+	if _, err := r.run(env, "rev-parse", "--verify", "-q", "HEAD"); err == nil {
+		if _, err := r.run(env, "read-tree", "HEAD"); err != nil {
+			return err
+		}
+	}
+	return f(env)
+}
+
+func (r *Repo) excludeSpecs() []string {
+	var specs []string
+	for _, p := range r.Exclude {
+		p = strings.Trim(filepath.ToSlash(strings.TrimSpace(p)), "/")
+		if p != "" && p != "." {
+			specs = append(specs, ":(exclude)"+p)
+		}
+	}
+	return specs
+}
+
+func (r *Repo) run(env []string, args ...string) (string, error) {
+	return git(r.Dir, env, args...)
+}
+
+func git(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return stdout.String(), fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,216 @@
+package gitops
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newRepo creates a temporary repository with one commit containing a.txt.
+func newRepo(t *testing.T) *Repo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	dir := t.TempDir()
+	if _, err := git(dir, nil, "init", "-q"); err != nil {
+		t.Fatal(err)
+	}
+	write(t, dir, "a.txt", "one\n")
+	if _, err := git(dir, nil, "add", "-A"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git(dir, nil, "commit", "-q", "-m", "init"); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func write(t *testing.T, dir, name, content string) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, dir, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "<missing>"
+	}
+	return string(b)
+}
+
+func TestOpen_notRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_CEILING_DIRECTORIES", os.TempDir())
+	if _, err := Open(t.TempDir()); err == nil {
+		t.Error("Open(non-repo) err = nil")
+	}
+}
+
+func TestSnapshotDiffReset(t *testing.T) {
+	repo := newRepo(t)
+	write(t, repo.Dir, "dirty.txt", "uncommitted before node\n")
+	snap, err := repo.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := repo.run(nil, "status", "--porcelain"); !strings.Contains(status, "?? dirty.txt") {
+		t.Errorf("Snapshot changed the index: %q", status)
+	}
+
+	write(t, repo.Dir, "a.txt", "two\n")
+	write(t, repo.Dir, "new/b.txt", "created\n")
+	os.Remove(filepath.Join(repo.Dir, "dirty.txt"))
+	diff, err := repo.Diff(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"-one", "+two", "new/b.txt", "deleted file mode"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("Diff missing %q:\n%s", want, diff)
+		}
+	}
+
+	if err := repo.Reset(snap); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, repo.Dir, "a.txt"); got != "one\n" {
+		t.Errorf("a.txt = %q, want restored", got)
+	}
+	if got := read(t, repo.Dir, "dirty.txt"); got != "uncommitted before node\n" {
+		t.Errorf("dirty.txt = %q, want restored", got)
+	}
+	if got := read(t, repo.Dir, "new/b.txt"); got != "<missing>" {
+		t.Errorf("new/b.txt = %q, want removed", got)
+	}
+	if diff, _ := repo.Diff(snap); diff != "" {
+		t.Errorf("Diff after Reset = %q, want empty", diff)
+	}
+}
+
+func TestReset_movesHeadBack(t *testing.T) {
+	repo := newRepo(t)
+	snap, err := repo.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, repo.Dir, "a.txt", "agent commit\n")
+	if _, err := repo.Commit("agent"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Reset(snap); err != nil {
+		t.Fatal(err)
+	}
+	head, _ := repo.run(nil, "rev-parse", "HEAD")
+	if strings.TrimSpace(head) != snap.Head || read(t, repo.Dir, "a.txt") != "one\n" {
+		t.Errorf("HEAD = %s (want %s), a.txt = %q", head, snap.Head, read(t, repo.Dir, "a.txt"))
+	}
+}
+
+func TestCommit_excludes(t *testing.T) {
+	repo := newRepo(t)
+	repo.Exclude = []string{"_logs"}
+	write(t, repo.Dir, "_logs/run.json", "{}")
+	snap, err := repo.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := repo.Commit("nothing"); err != nil || hash != "" {
+		t.Errorf("Commit(no changes) = %q, %v; want no commit", hash, err)
+	}
+	write(t, repo.Dir, "a.txt", "two\n")
+	write(t, repo.Dir, "_logs/run2.json", "{}")
+	if diff, _ := repo.Diff(snap); strings.Contains(diff, "_logs") {
+		t.Errorf("Diff includes excluded path:\n%s", diff)
+	}
+	hash, err := repo.Commit("Process: edit a")
+	if err != nil || hash == "" {
+		t.Fatalf("Commit = %q, %v", hash, err)
+	}
+	files, _ := repo.run(nil, "show", "--name-only", "--format=%s", hash)
+	if !strings.Contains(files, "Process: edit a") || !strings.Contains(files, "a.txt") || strings.Contains(files, "_logs") {
+		t.Errorf("commit contents = %q", files)
+	}
+}
+
+func TestCommitSince_onlyNodeChanges(t *testing.T) {
+	repo := newRepo(t)
+	if dirty, err := repo.Dirty(); err != nil || dirty {
+		t.Fatalf("Dirty(clean) = %v, %v", dirty, err)
+	}
+	write(t, repo.Dir, "user.txt", "uncommitted\n")
+	if dirty, err := repo.Dirty(); err != nil || !dirty {
+		t.Fatalf("Dirty(untracked file) = %v, %v", dirty, err)
+	}
+	snap, err := repo.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := repo.CommitSince(snap, "nothing"); err != nil || hash != "" {
+		t.Errorf("CommitSince(no changes) = %q, %v; want no commit", hash, err)
+	}
+	write(t, repo.Dir, "a.txt", "two\n")
+	write(t, repo.Dir, "dir/new.txt", "new\n")
+	hash, err := repo.CommitSince(snap, "Process: edit a")
+	if err != nil || hash == "" {
+		t.Fatalf("CommitSince = %q, %v", hash, err)
+	}
+	files, _ := repo.run(nil, "show", "--name-only", "--format=", hash)
+	if strings.Fields(files)[0] != "a.txt" || !strings.Contains(files, "dir/new.txt") || strings.Contains(files, "user.txt") {
+		t.Errorf("commit files = %q, want a.txt and dir/new.txt only", files)
+	}
+	status, _ := repo.run(nil, "status", "--porcelain")
+	if strings.TrimSpace(status) != "?? user.txt" {
+		t.Errorf("status after CommitSince = %q, want only user.txt untracked", status)
+	}
+}
+
+func TestChangedFilesRestorePaths(t *testing.T) {
+	repo := newRepo(t)
+	write(t, repo.Dir, "keep.txt", "keep\n")
+	snap, err := repo.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, repo.Dir, "a.txt", "two\n")
+	write(t, repo.Dir, "keep.txt", "changed\n")
+	write(t, repo.Dir, "dir/new.txt", "new\n")
+	files, err := repo.ChangedFiles(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a.txt,dir/new.txt,keep.txt"; strings.Join(files, ",") != want {
+		t.Errorf("ChangedFiles = %v, want %s", files, want)
+	}
+	if err := repo.RestorePaths(snap, []string{"a.txt", "dir/new.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, repo.Dir, "a.txt"); got != "one\n" {
+		t.Errorf("a.txt = %q, want restored", got)
+	}
+	if got := read(t, repo.Dir, "dir/new.txt"); got != "<missing>" {
+		t.Errorf("dir/new.txt = %q, want removed", got)
+	}
+	if got := read(t, repo.Dir, "keep.txt"); got != "changed\n" {
+		t.Errorf("keep.txt = %q, want untouched", got)
+	}
+}
@@ -0,0 +1,212 @@
+package gitops
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// BranchPrefix starts the name of every branch created by AddWorktree.
+const BranchPrefix = "monads/"
+
+// worktreesDirName is the directory inside the git common dir that holds isolated worktrees,
+// so they never show up as untracked files in the main worktree.
+const worktreesDirName = "monads-worktrees"
+
+// lockPrefix starts the lock reason of a worktree in use; it is followed by the owning pid.
+const lockPrefix = "monadscli pid "
+
+// ErrWorktreeExists is returned by AddWorktree when the branch or directory for the name exists.
+var ErrWorktreeExists = errors.New("worktree exists")
+
+// Worktree is a linked worktree checked out on its own branch.
+type Worktree struct {
+	*Repo         // Repo rooted at the worktree.
+	Name   string // Directory name under WorktreesDir; the branch is BranchPrefix+Name.
+	Branch string
+	Base   string // Commit the branch was created from.
+}
+
+// WorktreeInfo describes one worktree listed by Worktrees.
+type WorktreeInfo struct {
+	Path   string
+	Branch string // Short branch name; empty when detached.
+	Head   string
+	Locked bool
+	PID    int // Process that locked the worktree, or 0.
+}
+
+// WorktreesDir returns the directory holding isolated worktrees: <git common dir>/monads-worktrees.
+func (r *Repo) WorktreesDir() (string, error) {
+	out, err := r.run(nil, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", err
+	}
+	common := strings.TrimSpace(out)
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(r.Dir, common)
+	}
+	return filepath.Join(common, worktreesDirName), nil
+}
+
+// AddWorktree creates branch BranchPrefix+name at base (HEAD when empty) and checks it out in
+// WorktreesDir/name; it returns ErrWorktreeExists when either exists. The worktree is locked
+// with the current pid until RemoveWorktree so PruneWorktrees leaves it alone while the run is
+// alive. Only committed files are checked out.
+func (r *Repo) AddWorktree(name, base string) (*Worktree, error) {
+	if base == "" {
+		base = "HEAD"
+	}
+	out, err := r.run(nil, "rev-parse", "--verify", "-q", base+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("worktree base %s: no commit (isolated runs need at least one commit)", base)
+	}
+	base = strings.TrimSpace(out)
+	dir, err := r.WorktreesDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, name)
+	branch := BranchPrefix + name
+	exists := func() bool {
+		_, statErr := os.Stat(path)
+		_, refErr := r.run(nil, "rev-parse", "--verify", "-q", "refs/heads/"+branch)
+		return statErr == nil || refErr == nil
+	}
+	if exists() {
+		return nil, fmt.Errorf("%w: %s", ErrWorktreeExists, branch)
+	}
+	if _, err := r.run(nil, "worktree", "add", "-q", "--lock", "--reason", lockPrefix+strconv.Itoa(os.Getpid()), "-b", branch, path, base); err != nil {
+		if exists() { // Created by another run in the meantime.
+			return nil, fmt.Errorf("%w: %s", ErrWorktreeExists, branch)
+		}
+		return nil, err
+	}
+	return &Worktree{Repo: &Repo{Dir: path}, Name: name, Branch: branch, Base: base}, nil
+}
+
+// Changed reports whether the worktree's branch has commits beyond Base.
+func (w *Worktree) Changed() (bool, error) {
+	out, err := w.run(nil, "rev-parse", "HEAD")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) != w.Base, nil
+}
+
+// RemoveWorktree deletes the worktree at path, discarding uncommitted changes. Its branch is kept.
+func (r *Repo) RemoveWorktree(path string) error {
+	_, err := r.run(nil, "worktree", "remove", "--force", "--force", path)
+	return err
+}
+
+// DeleteBranch deletes branch even when it is not merged.
+func (r *Repo) DeleteBranch(branch string) error {
+	_, err := r.run(nil, "branch", "-q", "-D", branch)
+	return err
+}
+
+// Merge merges branch into the current branch with a merge commit. On conflict the merge is
+// aborted so the worktree is left as it was, and the error lists the git output.
+func (r *Repo) Merge(branch, message string) error {
+	if _, err := r.run(nil, "merge", "-q", "--no-ff", "--no-verify", "-m", message, branch); err != nil {
+		r.run(nil, "merge", "--abort")
+		return err
+	}
+	return nil
+}
+
+// Worktrees returns the linked worktrees under WorktreesDir.
+func (r *Repo) Worktrees() ([]WorktreeInfo, error) {
+	dir, err := r.WorktreesDir()
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	out, err := r.run(nil, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	var list []WorktreeInfo
+	for _, block := range strings.Split(out, "\n\n") {
+		var w WorktreeInfo
+		for _, line := range strings.Split(block, "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "worktree":
+				w.Path = value
+			case "HEAD":
+				w.Head = value
+			case "branch":
+				w.Branch = strings.TrimPrefix(value, "refs/heads/")
+			case "locked":
+				w.Locked = true
+				if pid, err := strconv.Atoi(strings.TrimPrefix(value, lockPrefix)); err == nil && strings.HasPrefix(value, lockPrefix) {
+					w.PID = pid
+				}
+			}
+		}
+		if w.Path != "" && filepath.Dir(filepath.Clean(w.Path)) == dir {
+			list = append(list, w)
+		}
+	}
+	return list, nil
+}
+
+// PruneWorktrees removes abandoned isolated worktrees: those not locked by a running process.
+// Their branches are kept unless deleteBranches is set. It returns the removed worktrees.
+func (r *Repo) PruneWorktrees(deleteBranches bool) ([]WorktreeInfo, error) {
+	list, err := r.Worktrees()
+	if err != nil {
+		return nil, err
+	}
+	var removed []WorktreeInfo
+	for _, w := range list {
+		if !w.Abandoned() {
+			continue
+		}
+		if err := r.RemoveWorktree(w.Path); err != nil {
+			return removed, err
+		}
+		if deleteBranches && strings.HasPrefix(w.Branch, BranchPrefix) {
+			if err := r.DeleteBranch(w.Branch); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, w)
+	}
+	_, err = r.run(nil, "worktree", "prune")
+	return removed, err
+}
+
+// Abandoned reports whether the worktree is neither in use by a running process nor locked by hand.
+func (w WorktreeInfo) Abandoned() bool {
+	return !w.Locked || (w.PID != 0 && !processAlive(w.PID))
+}
+
+// processAlive reports whether pid is a running process.
+func processAlive(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess opens a handle, which fails for processes that have exited.
+		p.Release()
+		return true
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,116 @@
+package gitops
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAddWorktreeMerge(t *testing.T) {
+	repo := newRepo(t)
+	wt, err := repo.AddWorktree("run-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wt.Branch != "monads/run-1" || read(t, wt.Dir, "a.txt") != "one\n" {
+		t.Fatalf("worktree = %+v, a.txt = %q", wt, read(t, wt.Dir, "a.txt"))
+	}
+	if status, _ := repo.run(nil, "status", "--porcelain"); status != "" {
+		t.Errorf("main worktree status = %q, want clean", status)
+	}
+	if changed, err := wt.Changed(); err != nil || changed {
+		t.Errorf("Changed() before commit = %v, %v", changed, err)
+	}
+	write(t, wt.Dir, "b.txt", "from run\n")
+	if _, err := wt.Commit("run"); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := wt.Changed(); !changed {
+		t.Error("Changed() after commit = false")
+	}
+	if got := read(t, repo.Dir, "b.txt"); got != "<missing>" {
+		t.Errorf("main worktree b.txt = %q before merge", got)
+	}
+
+	if err := repo.Merge(wt.Branch, "merge run"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, repo.Dir, "b.txt"); got != "from run\n" {
+		t.Errorf("b.txt after merge = %q", got)
+	}
+	if err := repo.RemoveWorktree(wt.Dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(wt.Dir); !os.IsNotExist(err) {
+		t.Errorf("worktree dir still exists: %v", err)
+	}
+	if err := repo.DeleteBranch(wt.Branch); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMerge_conflictAborts(t *testing.T) {
+	repo := newRepo(t)
+	wt, err := repo.AddWorktree("run-2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, wt.Dir, "a.txt", "from run\n")
+	if _, err := wt.Commit("run"); err != nil {
+		t.Fatal(err)
+	}
+	write(t, repo.Dir, "a.txt", "from main\n")
+	if _, err := repo.Commit("main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Merge(wt.Branch, "merge run"); err == nil {
+		t.Fatal("Merge(conflict) err = nil")
+	}
+	if status, _ := repo.run(nil, "status", "--porcelain"); status != "" || read(t, repo.Dir, "a.txt") != "from main\n" {
+		t.Errorf("after aborted merge: status = %q, a.txt = %q", status, read(t, repo.Dir, "a.txt"))
+	}
+}
+
+func TestAddWorktree_exists(t *testing.T) {
+	repo := newRepo(t)
+	if _, err := repo.AddWorktree("run-3", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.AddWorktree("run-3", ""); !errors.Is(err, ErrWorktreeExists) {
+		t.Errorf("AddWorktree(same name) = %v, want ErrWorktreeExists", err)
+	}
+}
+
+func TestPruneWorktrees(t *testing.T) {
+	repo := newRepo(t)
+	live, err := repo.AddWorktree("live", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, err := repo.AddWorktree("dead", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a run that exited without cleaning up: relock with a pid that is not running.
+	if _, err := repo.run(nil, "worktree", "unlock", dead.Dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.run(nil, "worktree", "lock", "--reason", lockPrefix+"999999999", dead.Dir); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := repo.PruneWorktrees(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Branch != dead.Branch {
+		t.Fatalf("removed = %+v, want only %s", removed, dead.Branch)
+	}
+	if _, err := os.Stat(live.Dir); err != nil {
+		t.Errorf("live worktree removed: %v", err)
+	}
+	branches, _ := repo.run(nil, "branch", "--list", "monads/*")
+	if strings.Contains(branches, dead.Branch) || !strings.Contains(branches, live.Branch) {
+		t.Errorf("branches = %q", branches)
+	}
+}
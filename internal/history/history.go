@@ -0,0 +1,221 @@
+// Package history keeps a local, append-only record of tree runs and summarizes it per node, per
+// CLI, and over time (monadscli history).
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/redact"
+	"github.com/ryanmontgomery/MonadsCLI/internal/run"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// FileName is the history file in the settings directory (settings.StateDir): one JSON Run per line.
+const FileName = "history.jsonl"
+
+// Run statuses.
+const (
+	StatusPassed      = "passed"      // Every node passed.
+	StatusFailed      = "failed"      // The tree finished but a node did not pass validation after its retries.
+	StatusError       = "error"       // The run stopped with an error.
+	StatusInterrupted = "interrupted" // The run was interrupted (see run.ErrInterrupted).
+)
+
+// Document identifies the tree a run executed.
+type Document struct {
+	Chart  string `json:"chart"`
+	Source string `json:"source,omitempty"` // Path of the CSV.
+	Hash   string `json:"hash,omitempty"`   // SHA-256 of the CSV (12 hex digits); changes whenever the chart does.
+}
+
+// NewDocument returns the identity of a chart exported as csv from source.
+func NewDocument(chart, source string, csv []byte) Document {
+	sum := sha256.Sum256(csv)
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+	return Document{Chart: chart, Source: source, Hash: hex.EncodeToString(sum[:])[:12]}
+}
+
+// Run is one run-tree run.
+type Run struct {
+	Document   Document  `json:"document"`
+	Started    time.Time `json:"started"`
+	DurationMs int64     `json:"duration_ms"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"` // Redacted.
+	Usage      run.Usage `json:"usage"`
+	Nodes      []Node    `json:"nodes"`
+}
+
+// Node is one executed node of a Run.
+type Node struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`            // run.ResponseKind.
+	CLI        string    `json:"cli,omitempty"`   // Codename that ran the node; empty for approval and Human nodes.
+	Route      string    `json:"route,omitempty"` // Route taken to the next node.
+	DurationMs int64     `json:"duration_ms"`
+	Retries    int       `json:"retries"`
+	Validated  bool      `json:"validated,omitempty"` // Validation ran.
+	Valid      bool      `json:"valid"`               // Passed validation (or had none).
+	Resumed    bool      `json:"resumed,omitempty"`   // Replayed by a resumed run; it ran in the interrupted one.
+	Usage      run.Usage `json:"usage"`
+}
+
+// agent reports whether the node ran an agent (not an approval or Human node).
+func (n Node) agent() bool {
+	return n.CLI != ""
+}
+
+// Recorder builds a Run from a tree run: call NodeDone from run.RunOptions.OnNodeDone and Finish
+// when the run returns. A node's duration is the time since the previous node finished.
+type Recorder struct {
+	run        Run
+	executed   []*types.ProcessedNode
+	last       time.Time
+	defaultCLI string
+}
+
+// NewRecorder starts recording a run of doc; defaultCLI is the codename of nodes without a cli.
+func NewRecorder(doc Document, defaultCLI string) *Recorder {
+	now := time.Now()
+	return &Recorder{run: Run{Document: doc, Started: now, Nodes: []Node{}}, last: now, defaultCLI: defaultCLI}
+}
+
+// NodeDone records one executed node. Nodes replayed by a resumed run are recorded for the route
+// but marked Resumed, so the stats count them only once (in the interrupted run).
+func (r *Recorder) NodeDone(node *types.ProcessedNode, res run.NodeResult) {
+	now := time.Now()
+	n := Node{
+		Name:       node.Name,
+		Type:       run.ResponseKind(node),
+		DurationMs: now.Sub(r.last).Milliseconds(),
+		Retries:    node.Retried,
+		Validated:  res.ValidationRan,
+		Valid:      res.Valid,
+		Resumed:    res.Resumed,
+		Usage:      res.Usage,
+	}
+	if !node.Approval && !node.Human {
+		if cli, err := run.ResolveCLI(node, r.defaultCLI); err == nil {
+			n.CLI = cli.Codename
+		}
+	}
+	r.last = now
+	r.run.Nodes = append(r.run.Nodes, n)
+	r.executed = append(r.executed, node)
+}
+
+// Finish returns the recorded run, given the error it stopped with (redacted with r) and its usage.
+func (r *Recorder) Finish(err error, usage run.Usage, red *redact.Redactor) Run {
+	out := r.run
+	out.DurationMs = time.Since(out.Started).Milliseconds()
+	out.Usage = usage
+	for i := 0; i+1 < len(r.executed); i++ {
+		for route, child := range r.executed[i].Children {
+			if child == r.executed[i+1] {
+				out.Nodes[i].Route = route
+			}
+		}
+	}
+	switch {
+	case errors.Is(err, run.ErrInterrupted):
+		out.Status = StatusInterrupted
+	case err != nil:
+		out.Status = StatusError
+	default:
+		out.Status = StatusPassed
+		for _, n := range out.Nodes {
+			if !n.Valid {
+				out.Status = StatusFailed
+			}
+		}
+	}
+	if err != nil {
+		out.Error = red.String(err.Error())
+	}
+	return out
+}
+
+// Append adds r to the history file at path, creating it (and its directory) when missing.
+func Append(path string, r Run) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads the history file at path, oldest run first. A missing file is an empty history.
+// Lines that do not parse (e.g. cut short by a crash) are skipped and counted.
+func Load(path string) (runs []Run, skipped int, err error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	for {
+		line, readErr := br.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var r Run
+			if json.Unmarshal(line, &r) == nil {
+				runs = append(runs, r)
+			} else {
+				skipped++
+			}
+		}
+		if readErr == io.EOF {
+			return runs, skipped, nil
+		}
+		if readErr != nil {
+			return runs, skipped, fmt.Errorf("read history: %w", readErr)
+		}
+	}
+}
+
+// Filter selects runs by chart (case-insensitive; empty = all) and start time (zero = all).
+type Filter struct {
+	Chart string
+	Since time.Time
+}
+
+// Apply returns the runs that match f.
+func (f Filter) Apply(runs []Run) []Run {
+	var out []Run
+	for _, r := range runs {
+		if f.Chart != "" && !strings.EqualFold(strings.TrimSpace(r.Document.Chart), strings.TrimSpace(f.Chart)) {
+			continue
+		}
+		if !f.Since.IsZero() && r.Started.Before(f.Since) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
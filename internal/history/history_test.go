@@ -0,0 +1,123 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/redact"
+	"github.com/ryanmontgomery/MonadsCLI/internal/run"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func TestRecorderAppendLoad(t *testing.T) {
+	fix := &types.ProcessedNode{Name: "Fix", CLI: "CLAUDE", ValidatePrompt: "Fixed?"}
+	review := &types.ProcessedNode{Name: "Review", Approval: true}
+	root := &types.ProcessedNode{Name: "Broken?", Children: map[string]*types.ProcessedNode{"yes": fix, "no": review}}
+	fix.Children = map[string]*types.ProcessedNode{"": review}
+
+	rec := NewRecorder(NewDocument("Triage", "tree.csv", []byte("csv")), "CURSOR")
+	rec.NodeDone(root, run.NodeResult{Valid: true, Usage: run.Usage{Calls: 1, CostUSD: 0.5}})
+	fix.Retried = 2
+	rec.NodeDone(fix, run.NodeResult{ValidationRan: true, Valid: false, Usage: run.Usage{Calls: 6}})
+	r := rec.Finish(nil, run.Usage{Calls: 7, CostUSD: 0.5}, nil)
+	resumed := NewRecorder(Document{Chart: "Triage"}, "CURSOR")
+	resumed.NodeDone(root, run.NodeResult{Valid: true, Resumed: true})
+	resumed.NodeDone(fix, run.NodeResult{Valid: true})
+	if rr := resumed.Finish(nil, run.Usage{}, nil); !rr.Nodes[0].Resumed || rr.Nodes[0].Route != "yes" || rr.Nodes[1].Resumed {
+		t.Errorf("resumed nodes = %+v", rr.Nodes)
+	}
+	if r.Status != StatusFailed || r.Document.Hash == "" || !filepath.IsAbs(r.Document.Source) {
+		t.Errorf("run = %+v", r)
+	}
+	if r.Nodes[0].Route != "yes" || r.Nodes[0].CLI != "CURSOR" || r.Nodes[1].CLI != "CLAUDE" || r.Nodes[1].Retries != 2 || r.Nodes[1].Route != "" {
+		t.Errorf("nodes = %+v", r.Nodes)
+	}
+
+	red, err := redact.New([]string{"sk-secret"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = NewRecorder(Document{Chart: "Triage"}, "CURSOR")
+	rec.NodeDone(review, run.NodeResult{Valid: true})
+	stopped := rec.Finish(errors.New("agent failed with sk-secret"), run.Usage{}, red)
+	if stopped.Status != StatusError || stopped.Error != "agent failed with [REDACTED]" || stopped.Nodes[0].CLI != "" {
+		t.Errorf("stopped run = %+v", stopped)
+	}
+	interrupted := rec.Finish(run.ErrInterrupted, run.Usage{}, nil)
+	if interrupted.Status != StatusInterrupted {
+		t.Errorf("interrupted status = %s", interrupted.Status)
+	}
+
+	path := filepath.Join(t.TempDir(), "state", FileName)
+	for _, r := range []Run{r, stopped} {
+		if err := Append(path, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"document": {"chart": "Tri`)
+	f.Close()
+	runs, skipped, err := Load(path)
+	if err != nil || len(runs) != 2 || skipped != 1 {
+		t.Fatalf("Load = %d runs, %d skipped, %v", len(runs), skipped, err)
+	}
+	if got := (Filter{Chart: "triage", Since: time.Now().Add(-time.Hour)}).Apply(runs); len(got) != 2 {
+		t.Errorf("filtered = %d runs", len(got))
+	}
+	if got := (Filter{Chart: "Other"}).Apply(runs); len(got) != 0 {
+		t.Errorf("other chart = %d runs", len(got))
+	}
+	if runs, _, err := Load(filepath.Join(t.TempDir(), FileName)); err != nil || runs != nil {
+		t.Errorf("missing file = %v, %v", runs, err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 12, 0, 0, 0, time.Local) }
+	doc := Document{Chart: "Triage"}
+	runs := []Run{
+		{Document: doc, Started: day(5), Nodes: []Node{
+			{Name: "Plan", CLI: "CLAUDE", Valid: true, DurationMs: 1000},
+			{Name: "Fix", CLI: "CURSOR", Retries: 2, Valid: true, DurationMs: 9000, Usage: run.Usage{CostUSD: 1}},
+		}},
+		{Document: doc, Started: day(6), Nodes: []Node{
+			{Name: "Plan", CLI: "CLAUDE", Valid: true, DurationMs: 3000},
+			{Name: "Fix", CLI: "CURSOR", Retries: 3, Valid: false, DurationMs: 12000},
+			{Name: "Review", Type: run.ResponseKindApproval, DurationMs: 60000},
+		}},
+		{Document: doc, Started: day(13), Nodes: []Node{
+			{Name: "Plan", CLI: "CLAUDE", Valid: false, Retries: 3, Resumed: true}, // Counted in its interrupted run only.
+			{Name: "Fix", CLI: "CURSOR", Valid: true, DurationMs: 3000},
+		}},
+	}
+
+	nodes := ByNode(runs)
+	if len(nodes) != 2 || nodes[0].Node != "Fix" || nodes[0].Runs != 3 || nodes[0].Flaky != 2 || nodes[0].Failed != 1 || nodes[0].AvgRetries != 5.0/3 || nodes[0].AvgDurationMs != 8000 {
+		t.Errorf("ByNode = %+v", nodes)
+	}
+	if nodes[1].Node != "Plan" || nodes[1].FlakeRate != 0 {
+		t.Errorf("ByNode[1] = %+v", nodes[1])
+	}
+
+	clis := ByCLI(runs)
+	if len(clis) != 2 || clis[0].CLI != "CLAUDE" || clis[0].SuccessRate != 1 || clis[1].Nodes != 3 || clis[1].Passed != 2 || clis[1].CostUSD != 1 {
+		t.Errorf("ByCLI = %+v", clis)
+	}
+
+	slow, err := Slowest(runs, PeriodWeek, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slow) != 2 || slow[0].Node != "Review" || slow[1].Node != "Fix" || slow[1].MaxDurationMs != 12000 {
+		t.Fatalf("Slowest = %+v", slow)
+	}
+	if p := slow[1].Periods; len(p) != 2 || p[0].Period != "2026-W41" || p[0].AvgDurationMs != 10500 || p[1].Period != "2026-W42" || p[1].Runs != 1 {
+		t.Errorf("Fix periods = %+v", p)
+	}
+	if _, err := Slowest(runs, "year", 0); err == nil {
+		t.Error("Slowest accepted an invalid period")
+	}
+}
@@ -0,0 +1,218 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+)
+
+// NodeStats summarizes the runs of one agent node of a chart.
+type NodeStats struct {
+	Chart         string  `json:"chart"`
+	Node          string  `json:"node"`
+	Runs          int     `json:"runs"`    // Times the node ran.
+	Flaky         int     `json:"flaky"`   // Runs that needed a retry or did not pass.
+	Failed        int     `json:"failed"`  // Runs that did not pass validation after their retries.
+	Retries       int     `json:"retries"` // Total retries.
+	FlakeRate     float64 `json:"flake_rate"`
+	AvgRetries    float64 `json:"avg_retries"`
+	AvgDurationMs int64   `json:"avg_duration_ms"`
+	CostUSD       float64 `json:"cost_usd"`
+	totalMs       int64
+}
+
+// ByNode summarizes agent nodes by chart and node name, flakiest first (then most retries).
+// Here and in ByCLI and Slowest, nodes replayed by a resumed run (Node.Resumed) are left out.
+func ByNode(runs []Run) []NodeStats {
+	index := map[[2]string]int{}
+	var out []NodeStats
+	for _, r := range runs {
+		for _, n := range r.Nodes {
+			if !n.agent() || n.Resumed {
+				continue
+			}
+			key := [2]string{r.Document.Chart, n.Name}
+			i, ok := index[key]
+			if !ok {
+				i = len(out)
+				index[key] = i
+				out = append(out, NodeStats{Chart: r.Document.Chart, Node: n.Name})
+			}
+			s := &out[i]
+			s.Runs++
+			s.Retries += n.Retries
+			if n.Retries > 0 || !n.Valid {
+				s.Flaky++
+			}
+			if !n.Valid {
+				s.Failed++
+			}
+			s.totalMs += n.DurationMs
+			s.CostUSD += n.Usage.CostUSD
+		}
+	}
+	for i := range out {
+		s := &out[i]
+		s.FlakeRate = float64(s.Flaky) / float64(s.Runs)
+		s.AvgRetries = float64(s.Retries) / float64(s.Runs)
+		s.AvgDurationMs = s.totalMs / int64(s.Runs)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.FlakeRate != b.FlakeRate {
+			return a.FlakeRate > b.FlakeRate
+		}
+		if a.AvgRetries != b.AvgRetries {
+			return a.AvgRetries > b.AvgRetries
+		}
+		if a.Chart != b.Chart {
+			return a.Chart < b.Chart
+		}
+		return a.Node < b.Node
+	})
+	return out
+}
+
+// CLIStats summarizes the agent nodes run by one CLI.
+type CLIStats struct {
+	CLI           string  `json:"cli"`
+	Nodes         int     `json:"nodes"`  // Node runs.
+	Passed        int     `json:"passed"` // Node runs that passed.
+	SuccessRate   float64 `json:"success_rate"`
+	AvgRetries    float64 `json:"avg_retries"`
+	AvgDurationMs int64   `json:"avg_duration_ms"`
+	CostUSD       float64 `json:"cost_usd"`
+	retries       int
+	totalMs       int64
+}
+
+// ByCLI summarizes agent nodes by the CLI that ran them, by codename.
+func ByCLI(runs []Run) []CLIStats {
+	index := map[string]int{}
+	var out []CLIStats
+	for _, r := range runs {
+		for _, n := range r.Nodes {
+			if !n.agent() || n.Resumed {
+				continue
+			}
+			i, ok := index[n.CLI]
+			if !ok {
+				i = len(out)
+				index[n.CLI] = i
+				out = append(out, CLIStats{CLI: n.CLI})
+			}
+			s := &out[i]
+			s.Nodes++
+			if n.Valid {
+				s.Passed++
+			}
+			s.retries += n.Retries
+			s.totalMs += n.DurationMs
+			s.CostUSD += n.Usage.CostUSD
+		}
+	}
+	for i := range out {
+		s := &out[i]
+		s.SuccessRate = float64(s.Passed) / float64(s.Nodes)
+		s.AvgRetries = float64(s.retries) / float64(s.Nodes)
+		s.AvgDurationMs = s.totalMs / int64(s.Nodes)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CLI < out[j].CLI })
+	return out
+}
+
+// Periods group runs by start time for Slowest.
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// PeriodStats is a step's average duration over the runs started in one period.
+type PeriodStats struct {
+	Period        string `json:"period"` // 2026-10-18, 2026-W42, or 2026-10.
+	Runs          int    `json:"runs"`
+	AvgDurationMs int64  `json:"avg_duration_ms"`
+	totalMs       int64
+}
+
+// SlowStats is the duration of one step (node, including approval and Human nodes) of a chart.
+type SlowStats struct {
+	Chart         string        `json:"chart"`
+	Node          string        `json:"node"`
+	Runs          int           `json:"runs"`
+	AvgDurationMs int64         `json:"avg_duration_ms"`
+	MaxDurationMs int64         `json:"max_duration_ms"`
+	Periods       []PeriodStats `json:"periods"` // Oldest first.
+	totalMs       int64
+}
+
+// Slowest returns the limit (<= 0 = all) steps with the longest average duration, each with its
+// average per period (PeriodDay, PeriodWeek, or PeriodMonth).
+func Slowest(runs []Run, period string, limit int) ([]SlowStats, error) {
+	key, err := periodKey(period)
+	if err != nil {
+		return nil, err
+	}
+	index := map[[2]string]int{}
+	var out []SlowStats
+	for _, r := range runs {
+		p := key(r)
+		for _, n := range r.Nodes {
+			if n.Resumed {
+				continue
+			}
+			k := [2]string{r.Document.Chart, n.Name}
+			i, ok := index[k]
+			if !ok {
+				i = len(out)
+				index[k] = i
+				out = append(out, SlowStats{Chart: r.Document.Chart, Node: n.Name})
+			}
+			s := &out[i]
+			s.Runs++
+			s.totalMs += n.DurationMs
+			if n.DurationMs > s.MaxDurationMs {
+				s.MaxDurationMs = n.DurationMs
+			}
+			j := 0
+			for j < len(s.Periods) && s.Periods[j].Period != p {
+				j++
+			}
+			if j == len(s.Periods) {
+				s.Periods = append(s.Periods, PeriodStats{Period: p})
+			}
+			ps := &s.Periods[j]
+			ps.Runs++
+			ps.totalMs += n.DurationMs
+		}
+	}
+	for i := range out {
+		s := &out[i]
+		s.AvgDurationMs = s.totalMs / int64(s.Runs)
+		for j := range s.Periods {
+			s.Periods[j].AvgDurationMs = s.Periods[j].totalMs / int64(s.Periods[j].Runs)
+		}
+		sort.Slice(s.Periods, func(a, b int) bool { return s.Periods[a].Period < s.Periods[b].Period })
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].AvgDurationMs > out[j].AvgDurationMs })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// periodKey returns the period of a run's start time; keys sort in time order.
+func periodKey(period string) (func(Run) string, error) {
+	switch period {
+	case PeriodDay:
+		return func(r Run) string { return r.Started.Local().Format("2006-01-02") }, nil
+	case PeriodWeek:
+		return func(r Run) string {
+			year, week := r.Started.Local().ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}, nil
+	case PeriodMonth:
+		return func(r Run) string { return r.Started.Local().Format("2006-01") }, nil
+	}
+	return nil, fmt.Errorf("invalid period %q: want day, week, or month", period)
+}
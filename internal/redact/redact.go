@@ -0,0 +1,113 @@
+// Package redact masks secrets in text before it is written to logs and reports.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Mask replaces every redacted secret.
+const Mask = "[REDACTED]"
+
+// MinSecretLen is the shortest value masked literally; shorter values would mask ordinary text.
+const MinSecretLen = 8
+
+// DefaultPatterns match common token formats and are always applied.
+var DefaultPatterns = []string{
+	`sk-ant-[A-Za-z0-9_-]{20,}`,             // Anthropic
+	`sk-(?:proj-)?[A-Za-z0-9_-]{32,}`,       // OpenAI
+	`gh[pousr]_[A-Za-z0-9]{36,}`,            // GitHub tokens
+	`github_pat_[A-Za-z0-9_]{22,}`,          // GitHub fine-grained tokens
+	`AIza[0-9A-Za-z_-]{35}`,                 // Google API keys
+	`AKIA[0-9A-Z]{16}`,                      // AWS access key IDs
+	`xox[abprs]-[A-Za-z0-9-]{10,}`,          // Slack
+	`(?i)bearer\s+[A-Za-z0-9._~+/-]{20,}=*`, // Authorization headers
+	// PEM private keys
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+}
+
+// Redactor masks known secret values and pattern matches. A nil Redactor leaves text unchanged.
+type Redactor struct {
+	values   []string // Longest first so a secret containing another is masked whole.
+	patterns []*regexp.Regexp
+}
+
+// New returns a Redactor for the given secret values (shorter than MinSecretLen are ignored)
+// and extra regular expressions, in addition to DefaultPatterns.
+func New(values, patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	seen := make(map[string]bool)
+	add := func(v string) {
+		if len(v) >= MinSecretLen && !seen[v] {
+			seen[v] = true
+			r.values = append(r.values, v)
+		}
+	}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		add(v)
+		// Also match the value as it appears inside JSON strings.
+		if b, err := json.Marshal(v); err == nil {
+			add(string(b[1 : len(b)-1]))
+		}
+	}
+	sort.SliceStable(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+	for _, p := range append(append([]string(nil), DefaultPatterns...), patterns...) {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// ParsePatterns parses a patterns setting: a JSON array of strings, or one pattern per line.
+func ParsePatterns(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(s, "[") {
+		var out []string
+		if err := json.Unmarshal([]byte(s), &out); err != nil {
+			return nil, fmt.Errorf("redact patterns: %w", err)
+		}
+		return out, nil
+	}
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out, nil
+}
+
+// String returns s with every secret replaced by Mask.
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, Mask)
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllLiteralString(s, Mask)
+	}
+	return s
+}
+
+// Bytes returns b with every secret replaced by Mask.
+func (r *Redactor) Bytes(b []byte) []byte {
+	if r == nil || len(b) == 0 {
+		return b
+	}
+	return []byte(r.String(string(b)))
+}
@@ -5,10 +5,12 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/ryanmontgomery/MonadsCLI/internal/redact"
 	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
 )
 
-func WriteJSON(path string, result runner.Result) error {
+// WriteJSON writes result as indented JSON to path, masking secrets with r (nil writes it as is).
+func WriteJSON(path string, result runner.Result, r *redact.Redactor) error {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return err
@@ -19,5 +21,5 @@ func WriteJSON(path string, result runner.Result) error {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0o644)
+	return os.WriteFile(path, r.Bytes(data), 0o644)
 }
@@ -0,0 +1,386 @@
+package run
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// Approval decisions.
+const (
+	ApprovalApprove = "approve"
+	ApprovalReject  = "reject"
+	ApprovalEdit    = "edit" // Approve with a note passed to later nodes as the approval node's output.
+)
+
+// Routes out of an approval node. An unlabeled single child is taken on approval.
+const (
+	RouteApproved = "approved"
+	RouteRejected = "rejected"
+)
+
+// ErrApprovalRejected is returned when an approval node is rejected (or times out) and has no
+// rejected route.
+var ErrApprovalRejected = errors.New("approval rejected")
+
+// ErrNoApprover is returned for an approval node when there is no way to ask a person.
+var ErrNoApprover = errors.New("approval required but no approver: run in a terminal or pass --approval-file")
+
+// ApprovalRequest is what a person sees at an approval node.
+type ApprovalRequest struct {
+	Node         string `json:"node"`
+	Question     string `json:"question,omitempty"`      // The approval node's text.
+	PreviousNode string `json:"previous_node,omitempty"` // The node that ran before the gate.
+	Output       string `json:"output,omitempty"`        // Its response (head and tail when long).
+	Diff         string `json:"diff,omitempty"`          // Its worktree changes (git checkpoints).
+}
+
+// Approval is a person's answer at an approval node.
+type Approval struct {
+	Decision string `json:"decision"`            // ApprovalApprove, ApprovalReject, or ApprovalEdit.
+	Note     string `json:"note,omitempty"`      // Edit text or reason.
+	TimedOut bool   `json:"timed_out,omitempty"` // No answer within the timeout; counts as rejected.
+}
+
+// Approver asks a person to answer an approval request. It returns ctx.Err() when ctx is done first.
+type Approver interface {
+	Approve(ctx context.Context, req ApprovalRequest) (Approval, error)
+}
+
+// NewApprovalRequest returns the request for an approval node reached after prev (nil at the root).
+// Output and diff longer than opts.MaxPromptOutput are cut to their head and tail.
+func NewApprovalRequest(node, prev *types.ProcessedNode, prevRes NodeResult, opts RunOptions) ApprovalRequest {
+	max := opts.MaxPromptOutput
+	if max <= 0 {
+		max = DefaultMaxPromptOutput
+	}
+	req := ApprovalRequest{Node: node.Name, Question: strings.TrimSpace(node.Prompt)}
+	if prev != nil {
+		req.PreviousNode = prev.Name
+		req.Output = runner.TruncateMiddle(strings.TrimSpace(prevRes.RunResult.Stdout), max)
+		req.Diff = runner.TruncateMiddle(prevRes.Diff, max)
+	}
+	return req
+}
+
+// ParseApproval parses an answer: a JSON object {"decision", "note"}, or text whose first word is
+// the decision (approve/a/yes/y, reject/r/no/n, edit/e) followed by the note.
+func ParseApproval(s string) (Approval, error) {
+	s = strings.TrimSpace(s)
+	var a Approval
+	if strings.HasPrefix(s, "{") {
+		if err := json.Unmarshal([]byte(s), &a); err != nil {
+			return a, fmt.Errorf("approval answer: %w", err)
+		}
+	} else {
+		word, note, _ := strings.Cut(s, " ")
+		if i := strings.IndexByte(s, '\n'); i >= 0 && i < len(word) {
+			word, note = s[:i], s[i+1:]
+		}
+		a = Approval{Decision: word, Note: strings.TrimSpace(note)}
+	}
+	switch strings.ToLower(strings.TrimSpace(a.Decision)) {
+	case "approve", "approved", "a", "yes", "y":
+		a.Decision = ApprovalApprove
+	case "reject", "rejected", "r", "no", "n":
+		a.Decision = ApprovalReject
+	case "edit", "e":
+		a.Decision = ApprovalEdit
+	default:
+		return a, fmt.Errorf("approval answer %q: want approve, reject, or edit", a.Decision)
+	}
+	return a, nil
+}
+
+// RunApproval asks opts.Approver to answer the approval node. No answer within the node's
+// approval_timeout (else opts.ApprovalTimeout; 0 waits indefinitely) counts as a rejection.
+// An interrupt returns ErrInterrupted. The answer is recorded as JSON in RunResult.Stdout and in
+// NodeResult.Approval; a note is passed to later nodes as the node's Output.
+func RunApproval(node *types.ProcessedNode, req ApprovalRequest, opts RunOptions) (NodeResult, error) {
+	var out NodeResult
+	if opts.Approver == nil {
+		return out, ErrNoApprover
+	}
+	timeout := opts.ApprovalTimeout
+	if node.ApprovalTimeout > 0 {
+		timeout = time.Duration(node.ApprovalTimeout) * time.Second
+	}
+	ctx, cancel := interruptContext(opts.Interrupts, timeout)
+	defer cancel()
+	a, err := opts.Approver.Approve(ctx, req)
+	switch {
+	case err == nil:
+	case opts.Interrupts.Interrupted():
+		out.Interrupted = true
+		return out, ErrInterrupted
+	case errors.Is(err, context.DeadlineExceeded):
+		a = Approval{Decision: ApprovalReject, Note: fmt.Sprintf("no answer within %s", timeout), TimedOut: true}
+	default:
+		return out, fmt.Errorf("approval: %w", err)
+	}
+	out.Approval = &a
+	out.Valid = a.Decision != ApprovalReject
+	data, _ := json.Marshal(a)
+	out.RunResult.Stdout = string(data)
+	if a.Decision != ApprovalReject && a.Note != "" {
+		out.Output = data
+	}
+	return out, nil
+}
+
+// ApprovalChild returns the child to run after an approval node answered with a: the approved
+// route (or the single other child) on approve and edit, the rejected route on reject. It returns
+// nil when there is nothing to run and ErrApprovalRejected for a rejection without a rejected route.
+func ApprovalChild(node *types.ProcessedNode, a Approval) (*types.ProcessedNode, error) {
+	var approved, rejected, other []*types.ProcessedNode
+	for route, child := range node.Children {
+		switch strings.ToLower(strings.TrimSpace(route)) {
+		case RouteApproved:
+			approved = append(approved, child)
+		case RouteRejected:
+			rejected = append(rejected, child)
+		default:
+			other = append(other, child)
+		}
+	}
+	if a.Decision == ApprovalReject {
+		if len(rejected) == 0 {
+			if a.Note != "" {
+				return nil, fmt.Errorf("%w at node %q: %s", ErrApprovalRejected, node.Name, a.Note)
+			}
+			return nil, fmt.Errorf("%w at node %q", ErrApprovalRejected, node.Name)
+		}
+		return rejected[0], nil
+	}
+	if len(approved) > 0 {
+		return approved[0], nil
+	}
+	if len(other) == 1 {
+		return other[0], nil
+	}
+	return nil, nil
+}
+
+// interruptContext returns a context that is cancelled on interrupt and, when timeout > 0,
+// after timeout.
+func interruptContext(interrupts *runner.Interrupts, timeout time.Duration) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	go func() {
+		select {
+		case <-interrupts.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// checkApprovalRoutes reports approval nodes whose routes are ambiguous: more than one route
+// besides "approved" and "rejected", or such a route next to "approved".
+func checkApprovalRoutes(node *types.ProcessedNode) error {
+	var approved, other int
+	for route := range node.Children {
+		switch strings.ToLower(strings.TrimSpace(route)) {
+		case RouteApproved:
+			approved++
+		case RouteRejected:
+		default:
+			other++
+		}
+	}
+	if other > 1 || (other > 0 && approved > 0) {
+		return fmt.Errorf("approval routes must be %q and %q (or one unlabeled route)", RouteApproved, RouteRejected)
+	}
+	return nil
+}
+
+// TTYApprover asks on a terminal: it writes the request to Out and reads the answer from In.
+// It also chooses routes of Human decision nodes (Chooser).
+type TTYApprover struct {
+	In  io.Reader
+	Out io.Writer
+
+	once  sync.Once
+	lines chan string
+}
+
+// Approve shows req and reads "approve", "reject", or "edit" (a note can follow on the same
+// line; after a bare "edit" the note is read up to an empty line).
+func (t *TTYApprover) Approve(ctx context.Context, req ApprovalRequest) (Approval, error) {
+	writeApprovalRequest(t.Out, req)
+	for {
+		fmt.Fprint(t.Out, "Approve, reject, or edit? [a/r/e] ")
+		line, err := t.readLine(ctx)
+		if err != nil {
+			return Approval{}, err
+		}
+		a, err := ParseApproval(line)
+		if err != nil {
+			fmt.Fprintln(t.Out, err)
+			continue
+		}
+		if a.Decision == ApprovalEdit && a.Note == "" {
+			fmt.Fprintln(t.Out, "Note for the next nodes (end with an empty line):")
+			var note []string
+			for {
+				line, err := t.readLine(ctx)
+				if err != nil {
+					return Approval{}, err
+				}
+				if strings.TrimSpace(line) == "" {
+					break
+				}
+				note = append(note, line)
+			}
+			a.Note = strings.Join(note, "\n")
+		}
+		return a, nil
+	}
+}
+
+// readLine returns the next line of In. One reader serves the whole run, so a read left
+// waiting by a timed-out question is not lost.
+func (t *TTYApprover) readLine(ctx context.Context) (string, error) {
+	t.once.Do(func() {
+		t.lines = make(chan string)
+		go func() {
+			scanner := bufio.NewScanner(t.In)
+			for scanner.Scan() {
+				t.lines <- scanner.Text()
+			}
+			close(t.lines)
+		}()
+	})
+	select {
+	case line, ok := <-t.lines:
+		if !ok {
+			return "", io.EOF
+		}
+		return line, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// FileApprover waits for the answer in a file or named pipe, for runs without a terminal. The
+// request is written as JSON to Path + ".request.json" and removed once answered. A regular file
+// is polled until it holds an answer (see ParseApproval), then removed; one that exists before the
+// request is written is stale and removed first. A named pipe is read once.
+type FileApprover struct {
+	Path   string
+	Out    io.Writer           // Where to say that an answer is awaited; nil = none.
+	Poll   time.Duration       // Interval between checks of a regular file; 0 = 500ms.
+	Redact func(string) string // Applied to the request before it is written; nil = none.
+}
+
+// Approve writes the request and waits for the answer.
+func (f *FileApprover) Approve(ctx context.Context, req ApprovalRequest) (Approval, error) {
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return Approval{}, err
+	}
+	request := string(data)
+	if f.Redact != nil {
+		request = f.Redact(request)
+	}
+	// An answer written before this request (e.g. left by an earlier run) is stale.
+	if info, err := os.Stat(f.Path); err == nil && info.Mode().IsRegular() {
+		if err := os.Remove(f.Path); err != nil {
+			return Approval{}, err
+		}
+		if f.Out != nil {
+			fmt.Fprintf(f.Out, "Removed stale answer in %s\n", f.Path)
+		}
+	}
+	requestPath := f.Path + ".request.json"
+	if err := os.WriteFile(requestPath, []byte(request), 0o644); err != nil {
+		return Approval{}, err
+	}
+	defer os.Remove(requestPath)
+	if f.Out != nil {
+		fmt.Fprintf(f.Out, "Approval required for node %q: write approve, reject, or edit <note> to %s (request in %s)\n", req.Node, f.Path, requestPath)
+	}
+	if info, err := os.Stat(f.Path); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		return f.readPipe(ctx)
+	}
+	poll := f.Poll
+	if poll <= 0 {
+		poll = 500 * time.Millisecond
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		if data, err := os.ReadFile(f.Path); err == nil && strings.TrimSpace(string(data)) != "" {
+			_ = os.Remove(f.Path)
+			a, err := ParseApproval(string(data))
+			if err == nil {
+				return a, nil
+			}
+			if f.Out != nil {
+				fmt.Fprintf(f.Out, "%v; waiting for another answer in %s\n", err, f.Path)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return Approval{}, ctx.Err()
+		}
+	}
+}
+
+// readPipe reads one answer from the named pipe at f.Path; opening blocks until a writer connects.
+func (f *FileApprover) readPipe(ctx context.Context) (Approval, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := os.ReadFile(f.Path)
+		done <- result{data, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return Approval{}, r.err
+		}
+		return ParseApproval(string(r.data))
+	case <-ctx.Done():
+		// Connect as a writer so the blocked reader returns.
+		if w, err := os.OpenFile(f.Path, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			w.Close()
+		}
+		return Approval{}, ctx.Err()
+	}
+}
+
+func writeApprovalRequest(w io.Writer, req ApprovalRequest) {
+	fmt.Fprintf(w, "\n=== Approval: %s ===\n", req.Node)
+	if req.Question != "" {
+		fmt.Fprintln(w, req.Question)
+	}
+	if req.PreviousNode != "" {
+		fmt.Fprintf(w, "\n--- Output of %s ---\n%s\n", req.PreviousNode, req.Output)
+	}
+	if req.Diff != "" {
+		fmt.Fprintf(w, "\n--- Changes ---\n%s\n", strings.TrimRight(req.Diff, "\n"))
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,158 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+type approverFunc func(ctx context.Context, req ApprovalRequest) (Approval, error)
+
+func (f approverFunc) Approve(ctx context.Context, req ApprovalRequest) (Approval, error) {
+	return f(ctx, req)
+}
+
+func TestParseApproval(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Approval
+	}{
+		{"approve", Approval{Decision: ApprovalApprove}},
+		{" Y\n", Approval{Decision: ApprovalApprove}},
+		{"reject too risky", Approval{Decision: ApprovalReject, Note: "too risky"}},
+		{"edit\nkeep the old API\nand its tests", Approval{Decision: ApprovalEdit, Note: "keep the old API\nand its tests"}},
+		{`{"decision": "e", "note": "rename it"}`, Approval{Decision: ApprovalEdit, Note: "rename it"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseApproval(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseApproval(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "maybe", `{"decision": 1}`} {
+		if _, err := ParseApproval(in); err == nil {
+			t.Errorf("ParseApproval(%q) err = nil", in)
+		}
+	}
+}
+
+func TestRunApproval(t *testing.T) {
+	node := &types.ProcessedNode{Name: "Review", Prompt: "Ship it?", Approval: true}
+	prev := &types.ProcessedNode{Name: "Change"}
+	prevRes := NodeResult{RunResult: runner.Result{Stdout: "changed a.go"}, Diff: "diff --git a/a.go b/a.go"}
+	req := NewApprovalRequest(node, prev, prevRes, RunOptions{})
+	if req.Question != "Ship it?" || req.PreviousNode != "Change" || req.Output != "changed a.go" || req.Diff == "" {
+		t.Fatalf("NewApprovalRequest = %+v", req)
+	}
+
+	if _, err := RunApproval(node, req, RunOptions{}); !errors.Is(err, ErrNoApprover) {
+		t.Errorf("RunApproval without approver err = %v, want ErrNoApprover", err)
+	}
+
+	edit := approverFunc(func(ctx context.Context, got ApprovalRequest) (Approval, error) {
+		return Approval{Decision: ApprovalEdit, Note: "keep the old name"}, nil
+	})
+	res, err := RunApproval(node, req, RunOptions{Approver: edit})
+	if err != nil || !res.Valid || res.Approval == nil || res.Approval.Decision != ApprovalEdit {
+		t.Fatalf("RunApproval(edit) = %+v, %v", res, err)
+	}
+	if !strings.Contains(string(res.Output), "keep the old name") {
+		t.Errorf("edit output = %s, want the note", res.Output)
+	}
+	if a, err := ParseApproval(res.RunResult.Stdout); err != nil || a != *res.Approval {
+		t.Errorf("recorded response %q does not parse back: %+v, %v", res.RunResult.Stdout, a, err)
+	}
+
+	wait := approverFunc(func(ctx context.Context, got ApprovalRequest) (Approval, error) {
+		<-ctx.Done()
+		return Approval{}, ctx.Err()
+	})
+	timed := &types.ProcessedNode{Name: "Review", Approval: true}
+	res, err = RunApproval(timed, req, RunOptions{Approver: wait, ApprovalTimeout: 20 * time.Millisecond})
+	if err != nil || res.Valid || !res.Approval.TimedOut || res.Approval.Decision != ApprovalReject {
+		t.Errorf("RunApproval(timeout) = %+v, %v; want a timed-out rejection", res.Approval, err)
+	}
+
+	interrupts := runner.NewInterrupts(time.Second)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		interrupts.Interrupt(os.Interrupt)
+	}()
+	res, err = RunApproval(node, req, RunOptions{Approver: wait, Interrupts: interrupts})
+	if !errors.Is(err, ErrInterrupted) || !res.Interrupted {
+		t.Errorf("RunApproval(interrupt) = %+v, %v; want ErrInterrupted", res, err)
+	}
+}
+
+func TestApprovalChild(t *testing.T) {
+	yes := &types.ProcessedNode{Name: "Merge"}
+	no := &types.ProcessedNode{Name: "Revert"}
+	node := &types.ProcessedNode{Name: "Review", Approval: true, Children: map[string]*types.ProcessedNode{"Approved": yes, "rejected": no}}
+	if got, err := ApprovalChild(node, Approval{Decision: ApprovalEdit}); err != nil || got != yes {
+		t.Errorf("ApprovalChild(edit) = %v, %v; want Merge", got, err)
+	}
+	if got, err := ApprovalChild(node, Approval{Decision: ApprovalReject}); err != nil || got != no {
+		t.Errorf("ApprovalChild(reject) = %v, %v; want Revert", got, err)
+	}
+
+	linear := &types.ProcessedNode{Name: "Review", Approval: true, Children: map[string]*types.ProcessedNode{"": yes}}
+	if got, err := ApprovalChild(linear, Approval{Decision: ApprovalApprove}); err != nil || got != yes {
+		t.Errorf("ApprovalChild(approve, one route) = %v, %v; want Merge", got, err)
+	}
+	if _, err := ApprovalChild(linear, Approval{Decision: ApprovalReject, Note: "no"}); !errors.Is(err, ErrApprovalRejected) {
+		t.Errorf("ApprovalChild(reject, no rejected route) err = %v, want ErrApprovalRejected", err)
+	}
+
+	ambiguous := &types.ProcessedNode{Name: "Review", Approval: true, Children: map[string]*types.ProcessedNode{"yes": yes, "maybe": no}}
+	err := Preflight(ambiguous, RunOptions{Approver: approverFunc(nil)})
+	if err == nil || !strings.Contains(err.Error(), "approval routes") {
+		t.Errorf("Preflight(ambiguous routes) = %v", err)
+	}
+	if err := Preflight(node, RunOptions{DefaultCLI: "CURSOR", DefaultValidateCLI: "CURSOR", DefaultRetryCLI: "CURSOR"}); !errors.Is(err, ErrNoApprover) {
+		t.Errorf("Preflight(no approver) = %v, want ErrNoApprover", err)
+	}
+}
+
+func TestFileApprover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "answer")
+	f := &FileApprover{Path: path, Poll: 5 * time.Millisecond, Redact: func(s string) string {
+		return strings.ReplaceAll(s, "hunter2", "[REDACTED]")
+	}}
+	// A stale answer from before the request must not be taken.
+	if err := os.WriteFile(path, []byte("approve\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			data, err := os.ReadFile(path + ".request.json")
+			if err == nil {
+				var req ApprovalRequest
+				if json.Unmarshal(data, &req) == nil && req.Node == "Review" && !strings.Contains(string(data), "hunter2") {
+					_ = os.WriteFile(path, []byte("reject needs tests\n"), 0o644)
+				}
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	a, err := f.Approve(ctx, ApprovalRequest{Node: "Review", Output: "password hunter2"})
+	if err != nil || a.Decision != ApprovalReject || a.Note != "needs tests" {
+		t.Fatalf("Approve = %+v, %v", a, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("answer file not removed: %v", err)
+	}
+	if _, err := os.Stat(path + ".request.json"); !os.IsNotExist(err) {
+		t.Errorf("request file not removed: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// DefaultBaseEnv lists the variables every agent invocation inherits from the process
+// environment: what shells and CLIs need to find programs, config, locale, temp dirs, and proxies.
+// A trailing * matches any suffix; "*" alone passes the whole process environment.
+var DefaultBaseEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "COLORTERM", "LANG", "LC_*", "TZ", "TMPDIR",
+	"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME", "XDG_STATE_HOME", "XDG_RUNTIME_DIR",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+	"SSL_CERT_FILE", "SSL_CERT_DIR", "NODE_EXTRA_CA_CERTS",
+	"SYSTEMROOT", "SYSTEMDRIVE", "COMSPEC", "PATHEXT", "WINDIR", "APPDATA", "LOCALAPPDATA",
+	"USERPROFILE", "PROGRAMDATA", "PROGRAMFILES", "TEMP", "TMP",
+}
+
+// EnvOptions scopes the environment of agent invocations. Each invocation receives the base
+// variables, the KeyENV keys of the CLI it runs, and the node's env metadata; nothing else.
+// Another CLI's KeyENV keys never pass, not even through Passthrough or env metadata.
+type EnvOptions struct {
+	Passthrough []string                    // Extra variable names (or PREFIX*) added to DefaultBaseEnv (setting ENV_PASSTHROUGH).
+	Secrets     map[string]string           // Stored CLI API keys (settings.CLISecrets); a CLI's KeyENV keys are taken from here first.
+	LookupEnv   func(string) (string, bool) // Process environment; nil = os.LookupEnv.
+	Environ     func() []string             // Lists the process environment for wildcard matches; nil = os.Environ.
+
+	// Audit, when set, receives one line per invocation naming the variables it received (never values).
+	Audit io.Writer
+}
+
+// EnvAudit is one agent invocation's environment, by variable name only.
+type EnvAudit struct {
+	CLI  string   `json:"cli"`
+	Vars []string `json:"vars"`
+}
+
+// NodeEnv parses the node's env metadata: a JSON object, or KEY=VALUE lines.
+func NodeEnv(node *types.ProcessedNode) (map[string]string, error) {
+	if node == nil || strings.TrimSpace(node.Env) == "" {
+		return nil, nil
+	}
+	env, err := types.ParseVarsFile([]byte(node.Env))
+	if err != nil {
+		return nil, fmt.Errorf("env: %w", err)
+	}
+	return env, nil
+}
+
+// BuildEnv returns the environment (KEY=VALUE, sorted) for running cli on node. Later sources
+// win: base variables, then the CLI's KeyENV keys (settings, else the process environment),
+// then the node's env metadata.
+func BuildEnv(cli types.CLI, node *types.ProcessedNode, opts EnvOptions) ([]string, error) {
+	lookup := opts.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	environ := opts.Environ
+	if environ == nil {
+		environ = os.Environ
+	}
+	otherKey := func(name string) bool {
+		return types.IsCLIKeyENV(name) && !slices.Contains(types.KeyENVNames(cli), name)
+	}
+	vars := make(map[string]string)
+	patterns := append(append([]string(nil), DefaultBaseEnv...), opts.Passthrough...)
+	for _, kv := range environ() {
+		k, v, ok := strings.Cut(kv, "=")
+		if ok && k != "" && matchEnvName(patterns, k) && !otherKey(k) {
+			vars[k] = v
+		}
+	}
+	for _, key := range types.KeyENVNames(cli) {
+		if v := strings.TrimSpace(opts.Secrets[key]); v != "" {
+			vars[key] = v
+		} else if v, ok := lookup(key); ok {
+			vars[key] = v
+		}
+	}
+	nodeEnv, err := NodeEnv(node)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range nodeEnv {
+		if !otherKey(k) {
+			vars[k] = v
+		}
+	}
+	out := make([]string, 0, len(vars))
+	for k, v := range vars {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func matchEnvName(patterns []string, name string) bool {
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if p != "" && p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// envNames returns the variable names of env (KEY=VALUE entries).
+func envNames(env []string) []string {
+	names := make([]string, len(env))
+	for i, kv := range env {
+		names[i], _, _ = strings.Cut(kv, "=")
+	}
+	return names
+}
+
+// recordEnvAudit writes the audit line for one invocation to EnvOptions.Audit and records it on
+// the node result, skipping repeats of the same CLI and variables.
+func recordEnvAudit(node *types.ProcessedNode, cli types.CLI, env []string, opts RunOptions) {
+	entry := EnvAudit{CLI: cli.Codename, Vars: envNames(env)}
+	if opts.envAudit != nil {
+		for _, e := range *opts.envAudit {
+			if e.CLI == entry.CLI && slices.Equal(e.Vars, entry.Vars) {
+				return
+			}
+		}
+		*opts.envAudit = append(*opts.envAudit, entry)
+	}
+	name := ""
+	if node != nil {
+		name = node.Name
+	}
+	fmt.Fprintf(opts.Env.Audit, "env audit: node %q %s: %s\n", name, entry.CLI, strings.Join(entry.Vars, ", "))
+}
@@ -0,0 +1,139 @@
+package run
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/internal/settings"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func TestBuildEnv(t *testing.T) {
+	process := map[string]string{
+		"PATH": "/bin", "HOME": "/home/u", "LC_ALL": "C", "AWS_SECRET_ACCESS_KEY": "aws",
+		"GEMINI_API_KEY": "gemini-from-env", "CI": "true",
+	}
+	opts := EnvOptions{
+		Passthrough: []string{"CI"},
+		Secrets:     map[string]string{"ANTHROPIC_API_KEY": "claude", "LUCID_OAUTH_CLIENT_SECRET": "lucid", "GEMINI_API_KEY": ""},
+		LookupEnv: func(k string) (string, bool) {
+			v, ok := process[k]
+			return v, ok
+		},
+		Environ: func() []string {
+			var out []string
+			for k, v := range process {
+				out = append(out, k+"="+v)
+			}
+			return out
+		},
+	}
+	node := &types.ProcessedNode{Env: "FEATURE=on\nHOME=/tmp/agent"}
+
+	got, err := BuildEnv(types.ClaudeCLI, node, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ANTHROPIC_API_KEY=claude", "CI=true", "FEATURE=on", "HOME=/tmp/agent", "LC_ALL=C", "PATH=/bin"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BuildEnv(CLAUDE) = %v\nwant %v", got, want)
+	}
+
+	got, err = BuildEnv(types.GeminiCLI, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"CI=true", "GEMINI_API_KEY=gemini-from-env", "HOME=/home/u", "LC_ALL=C", "PATH=/bin"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BuildEnv(GEMINI) = %v\nwant %v (key from process env when not in settings)", got, want)
+	}
+
+	if _, err := BuildEnv(types.ClaudeCLI, &types.ProcessedNode{Env: "not an assignment"}, opts); err == nil {
+		t.Error("BuildEnv(bad env metadata) err = nil")
+	}
+}
+
+// TestBuildEnv_otherCLIKeysNeverReachNode verifies that a Gemini key, stored or exported, reaches
+// neither the prompt nor the environment of a Claude node by any route: stored settings,
+// Passthrough, {{env.X}} in text or env metadata, or env metadata naming the key.
+func TestBuildEnv_otherCLIKeysNeverReachNode(t *testing.T) {
+	t.Setenv("GEMINI_API_KEY", "gemini-exported")
+	stored := settings.Settings{"GEMINI_API_KEY": "gemini-stored", "ANTHROPIC_API_KEY": "claude-stored", "LOG_DIR": "logs"}
+	node := types.NodeToProcessedNodeWithDefaults(&types.Node{
+		Text:     "Use {{env.GEMINI_API_KEY}}",
+		Metadata: map[string]string{"env": `{"G": "{{env.GEMINI_API_KEY}}", "GEMINI_API_KEY": "gemini-literal"}`},
+	}, &types.ProcessedNodeDefaults{LookupEnv: settings.TemplateLookupEnv, LookupEnvMetadata: settings.EnvMetadataLookupEnv(stored)})
+	if strings.Contains(node.Prompt, "gemini-") {
+		t.Errorf("prompt = %q", node.Prompt)
+	}
+	opts := EnvOptions{Passthrough: []string{"*"}, Secrets: settings.CLISecrets(stored)}
+	if _, ok := opts.Secrets["LOG_DIR"]; ok {
+		t.Errorf("Secrets = %v, want CLI keys only", opts.Secrets)
+	}
+	env, err := BuildEnv(types.ClaudeCLI, node, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "GEMINI_API_KEY=") || strings.Contains(kv, "gemini-") {
+			t.Errorf("Claude node env has %q", kv)
+		}
+	}
+	if !slices.Contains(env, "ANTHROPIC_API_KEY=claude-stored") {
+		t.Errorf("Claude node env lacks its own key: %v", env)
+	}
+	env, err = BuildEnv(types.GeminiCLI, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(env, "GEMINI_API_KEY=gemini-stored") || slices.Contains(env, "ANTHROPIC_API_KEY=claude-stored") {
+		t.Errorf("Gemini node env = %v", env)
+	}
+}
+
+func TestRunNodeThenValidate_ScopedEnvAudit(t *testing.T) {
+	var specs []runner.CommandSpec
+	SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+		specs = append(specs, spec)
+		return runner.Result{Stdout: `{"completed": true, "secs_taken": 1, "tokens_used": 1, "comments": []}`, Success: true}, nil
+	})
+	defer SetShellRunner(nil)
+
+	var audit bytes.Buffer
+	node := &types.ProcessedNode{Name: "Build", Prompt: "Build it", CLI: "CLAUDE", Env: `{"GOFLAGS": "-mod=mod"}`}
+	opts := RunOptions{Env: &EnvOptions{
+		Secrets:   map[string]string{"ANTHROPIC_API_KEY": "claude", "GEMINI_API_KEY": "gemini"},
+		LookupEnv: func(string) (string, bool) { return "", false },
+		Environ:   func() []string { return []string{"PATH=/bin", "OTHER_TOKEN=x"} },
+		Audit:     &audit,
+	}}
+	res, err := RunNodeThenValidate(node, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 1 {
+		t.Fatalf("calls = %d", len(specs))
+	}
+	if want := []string{"ANTHROPIC_API_KEY=claude", "GOFLAGS=-mod=mod", "PATH=/bin"}; !reflect.DeepEqual(specs[0].Env, want) {
+		t.Errorf("CommandSpec.Env = %v, want %v", specs[0].Env, want)
+	}
+	if want := []EnvAudit{{CLI: "CLAUDE", Vars: []string{"ANTHROPIC_API_KEY", "GOFLAGS", "PATH"}}}; !reflect.DeepEqual(res.Env, want) {
+		t.Errorf("NodeResult.Env = %+v, want %+v", res.Env, want)
+	}
+	line := audit.String()
+	if !strings.Contains(line, `node "Build" CLAUDE: ANTHROPIC_API_KEY, GOFLAGS, PATH`) || strings.Contains(line, "claude\n") {
+		t.Errorf("audit output = %q", line)
+	}
+
+	specs = nil
+	if _, err := RunNodeThenValidate(&types.ProcessedNode{Name: "Plain", Prompt: "x", CLI: "CLAUDE"}, RunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if specs[0].Env != nil {
+		t.Errorf("CommandSpec.Env = %v, want nil (inherit) without EnvOptions", specs[0].Env)
+	}
+}
@@ -0,0 +1,268 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// Default context_files limits, overridden by CONTEXT_MAX_FILE_BYTES and CONTEXT_MAX_BYTES.
+const (
+	DefaultContextMaxFileBytes = 64 << 10
+	DefaultContextMaxBytes     = 256 << 10
+)
+
+// FileOptions configures LoadNodeFiles.
+type FileOptions struct {
+	Dirs         []string                    // Searched in order for relative paths (e.g. workdir, then the tree file's dir).
+	Vars         map[string]string           // Tree inputs interpolated into prompt files ({{vars.name}}).
+	LookupEnv    func(string) (string, bool) // Resolves {{env.NAME}} in prompt files; nil = os.LookupEnv.
+	MaxFileBytes int                         // Per context file; larger files are truncated. 0 = DefaultContextMaxFileBytes.
+	MaxBytes     int                         // Total context per node; later files are skipped. 0 = DefaultContextMaxBytes.
+}
+
+// LoadNodeFiles walks the tree and loads each node's files: prompt_file replaces Prompt,
+// validate_prompt_file replaces ValidatePrompt (both interpolated like node text), and the
+// files matched by context_files are rendered into Context between BEGIN/END FILE delimiters.
+// Missing prompt files and bad patterns are errors; context patterns that match nothing,
+// binary files, and size limits are returned as warnings.
+func LoadNodeFiles(root *types.ProcessedNode, opts FileOptions) ([]string, error) {
+	if opts.MaxFileBytes <= 0 {
+		opts.MaxFileBytes = DefaultContextMaxFileBytes
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultContextMaxBytes
+	}
+	var warnings []string
+	var walk func(*types.ProcessedNode) error
+	walk = func(node *types.ProcessedNode) error {
+		if node == nil {
+			return nil
+		}
+		if p := strings.TrimSpace(node.PromptFile); p != "" {
+			text, err := loadPromptFile(node, p, opts)
+			if err != nil {
+				return fmt.Errorf("node %q prompt_file: %w", node.Name, err)
+			}
+			node.Prompt = text
+		}
+		if p := strings.TrimSpace(node.ValidatePromptFile); p != "" {
+			text, err := loadPromptFile(node, p, opts)
+			if err != nil {
+				return fmt.Errorf("node %q validate_prompt_file: %w", node.Name, err)
+			}
+			node.ValidatePrompt = text
+		}
+		if len(node.ContextFiles) > 0 {
+			context, warns, err := loadContextFiles(node.ContextFiles, opts)
+			for _, w := range warns {
+				warnings = append(warnings, fmt.Sprintf("node %q context_files: %s", node.Name, w))
+			}
+			if err != nil {
+				return fmt.Errorf("node %q context_files: %w", node.Name, err)
+			}
+			node.Context = context
+		}
+		for _, route := range sortedRoutes(node.Children) {
+			if err := walk(node.Children[route]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return warnings, walk(root)
+}
+
+// loadPromptFile reads a prompt file and interpolates it, recording undefined references on node.
+func loadPromptFile(node *types.ProcessedNode, p string, opts FileOptions) (string, error) {
+	resolved, err := resolveNodePath(p, opts.Dirs)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", err
+	}
+	text, undefined := types.Interpolate(strings.TrimSpace(string(data)), opts.Vars, opts.LookupEnv)
+	if len(undefined) > 0 {
+		node.UndefinedVars = append(node.UndefinedVars, undefined...)
+		sort.Strings(node.UndefinedVars)
+		node.UndefinedVars = slices.Compact(node.UndefinedVars)
+	}
+	return text, nil
+}
+
+// loadContextFiles expands the patterns and renders the matched files as one prompt section.
+func loadContextFiles(patterns []string, opts FileOptions) (string, []string, error) {
+	var warnings []string
+	type match struct{ display, path string }
+	var files []match
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, dir, err := globInDirs(pattern, opts.Dirs)
+		if err != nil {
+			return "", warnings, fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			warnings = append(warnings, fmt.Sprintf("%q matched no files", pattern))
+			continue
+		}
+		for _, rel := range matches {
+			full := filepath.Join(dir, filepath.FromSlash(rel))
+			if seen[full] {
+				continue
+			}
+			seen[full] = true
+			files = append(files, match{display: rel, path: full})
+		}
+	}
+	var b strings.Builder
+	total := 0
+	for i, f := range files {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return "", warnings, err
+		}
+		if bytes.IndexByte(data, 0) >= 0 {
+			warnings = append(warnings, fmt.Sprintf("skipped binary file %s", f.display))
+			continue
+		}
+		size := len(data)
+		if size > opts.MaxFileBytes {
+			data = data[:opts.MaxFileBytes]
+			warnings = append(warnings, fmt.Sprintf("truncated %s to %d of %d bytes", f.display, opts.MaxFileBytes, size))
+		}
+		if total+len(data) > opts.MaxBytes {
+			warnings = append(warnings, fmt.Sprintf("context limit of %d bytes reached; skipped %d file(s) from %s", opts.MaxBytes, len(files)-i, f.display))
+			break
+		}
+		total += len(data)
+		fmt.Fprintf(&b, "--- BEGIN FILE: %s ---\n%s", f.display, data)
+		if len(data) < size {
+			fmt.Fprintf(&b, "\n[truncated: %d of %d bytes]", len(data), size)
+		}
+		fmt.Fprintf(&b, "\n--- END FILE: %s ---\n\n", f.display)
+	}
+	if b.Len() == 0 {
+		return "", warnings, nil
+	}
+	return "Context files:\n\n" + strings.TrimSpace(b.String()), warnings, nil
+}
+
+// globInDirs returns the files matching pattern (slash-separated, relative to the returned
+// dir) in the first of dirs with any match. An absolute pattern is matched from its root.
+func globInDirs(pattern string, dirs []string) ([]string, string, error) {
+	pattern = filepath.ToSlash(strings.TrimSpace(pattern))
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, "", err
+	}
+	if path.IsAbs(pattern) {
+		dirs = []string{"/"}
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+	var searched []string
+	for _, dir := range dirs {
+		if strings.TrimSpace(dir) != "" {
+			searched = append(searched, dir)
+		}
+	}
+	if len(searched) == 0 {
+		searched = []string{"."}
+	}
+	for _, dir := range searched {
+		matches, err := globDir(dir, pattern)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(matches) > 0 {
+			return matches, dir, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// globDir returns the regular files under dir whose slash-separated relative path matches
+// pattern. "**" matches any number of directories; .git directories are skipped.
+func globDir(dir, pattern string) ([]string, error) {
+	var out []string
+	if !strings.Contains(pattern, "**") {
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if rel, err := filepath.Rel(dir, m); err == nil {
+				out = append(out, filepath.ToSlash(rel))
+			}
+		}
+		sort.Strings(out)
+		return out, nil
+	}
+	patSegs := strings.Split(pattern, "/")
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && p != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if matchSegments(patSegs, strings.Split(rel, "/")) {
+			out = append(out, rel)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	sort.Strings(out)
+	return out, err
+}
+
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			if len(pat) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pat[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pat[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,136 @@
+package run
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadNodeFiles(t *testing.T) {
+	work := t.TempDir()
+	tree := t.TempDir()
+	writeFiles(t, work, map[string]string{
+		"docs/a.md":        "alpha",
+		"src/x/main.go":    "package main",
+		"src/y/z/util.go":  "package z",
+		"src/y/z/notes.md": "ignored",
+		"big.txt":          strings.Repeat("b", 20),
+		"bin.dat":          "a\x00b",
+	})
+	writeFiles(t, tree, map[string]string{
+		"prompts/run.md":   "Fix {{vars.ticket}} {{vars.missing}}",
+		"prompts/check.md": "Is it fixed?",
+	})
+	child := &types.ProcessedNode{Name: "B", Prompt: "b", ContextFiles: []string{"big.txt", "bin.dat", "none/*.md"}}
+	root := &types.ProcessedNode{
+		Name: "A", Prompt: "shape text", ValidatePrompt: "default",
+		PromptFile: "prompts/run.md", ValidatePromptFile: "prompts/check.md",
+		ContextFiles: []string{"docs/*.md", "src/**/*.go", "docs/a.md"},
+		Children:     map[string]*types.ProcessedNode{"": child},
+	}
+	opts := FileOptions{Dirs: []string{work, tree}, Vars: map[string]string{"ticket": "T-1"}, MaxFileBytes: 8}
+	warnings, err := LoadNodeFiles(root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Prompt != "Fix T-1 {{vars.missing}}" || !strings.HasPrefix(root.Context, "Context files:") {
+		t.Errorf("root.Prompt = %q, Context = %q", root.Prompt, root.Context)
+	}
+	for _, want := range []string{"--- BEGIN FILE: docs/a.md ---\nalpha\n--- END FILE: docs/a.md ---", "src/x/main.go", "src/y/z/util.go"} {
+		if !strings.Contains(root.Context, want) {
+			t.Errorf("root.Context missing %q:\n%s", want, root.Context)
+		}
+	}
+	if strings.Count(root.Context, "BEGIN FILE: docs/a.md") != 1 || strings.Contains(root.Context, "notes.md") {
+		t.Errorf("root.Context has duplicate or unmatched files:\n%s", root.Context)
+	}
+	if strings.Count(BuildRunPrompt(root), "BEGIN FILE: docs/a.md") != 1 || strings.Contains(BuildValidatePrompt(root, "done"), "BEGIN FILE") {
+		t.Errorf("context files not in the run prompt exactly once, or in the validation prompt:\n%s", BuildValidatePrompt(root, "done"))
+	}
+	if root.ValidatePrompt != "Is it fixed?" {
+		t.Errorf("ValidatePrompt = %q", root.ValidatePrompt)
+	}
+	if want := []string{"vars.missing"}; !reflect.DeepEqual(root.UndefinedVars, want) {
+		t.Errorf("UndefinedVars = %v, want %v", root.UndefinedVars, want)
+	}
+	if !strings.Contains(child.Context, "bbbbbbbb\n[truncated: 8 of 20 bytes]") || strings.Contains(child.Context, "bin.dat ---") {
+		t.Errorf("child.Context = %q", child.Context)
+	}
+	joined := strings.Join(warnings, "\n")
+	for _, want := range []string{"truncated big.txt", "skipped binary file bin.dat", `"none/*.md" matched no files`} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("warnings missing %q: %v", want, warnings)
+		}
+	}
+}
+
+func TestLoadNodeFiles_errors(t *testing.T) {
+	root := &types.ProcessedNode{Name: "A", PromptFile: "missing.md"}
+	if _, err := LoadNodeFiles(root, FileOptions{Dirs: []string{t.TempDir()}}); err == nil || !strings.Contains(err.Error(), `node "A" prompt_file`) {
+		t.Errorf("LoadNodeFiles(missing) err = %v", err)
+	}
+	root = &types.ProcessedNode{Name: "A", ContextFiles: []string{"[bad"}}
+	if _, err := LoadNodeFiles(root, FileOptions{Dirs: []string{t.TempDir()}}); err == nil {
+		t.Error("LoadNodeFiles(bad pattern) err = nil")
+	}
+}
+
+func TestLoadNodeFiles_totalLimit(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "12345", "b.txt": "67890"})
+	root := &types.ProcessedNode{Name: "A", Prompt: "p", ContextFiles: []string{"*.txt"}}
+	warnings, err := LoadNodeFiles(root, FileOptions{Dirs: []string{dir}, MaxBytes: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(root.Context, "12345") || strings.Contains(root.Context, "67890") {
+		t.Errorf("Context = %q", root.Context)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "skipped 1 file(s) from b.txt") {
+		t.Errorf("warnings = %v", warnings)
+	}
+}
+
+// TestLoadNodeFiles_contextIsNotShellSource verifies that shell syntax in a context file reaches
+// the agent verbatim instead of running or expanding.
+func TestLoadNodeFiles_contextIsNotShellSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses /bin/sh")
+	}
+	dir := t.TempDir()
+	content := "run `echo PWNED` and $(echo PWNED) with $HOME, it's \"quoted\" \\ here"
+	writeFiles(t, dir, map[string]string{"notes.txt": content})
+	node := &types.ProcessedNode{Name: "A", Prompt: "p", ContextFiles: []string{"notes.txt"}}
+	if _, err := LoadNodeFiles(node, FileOptions{Dirs: []string{dir}}); err != nil {
+		t.Fatal(err)
+	}
+	shell, args := runner.DefaultShell()
+	cli := types.CLI{Command: "printf", Prompt: "printf %s \"<prompt>\""}
+	res, err := runner.RunShellCommand(runner.CommandSpec{Shell: shell, ShellArgs: args, Command: BuildCommand(cli, node.Context), Stdout: io.Discard, Stderr: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res.Stdout, content) {
+		t.Errorf("stdout = %q, want the file content verbatim", res.Stdout)
+	}
+}
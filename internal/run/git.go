@@ -0,0 +1,76 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/gitops"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// GitOptions enables git checkpoints around each node (settings GIT_CHECKPOINT,
+// GIT_RESET_ON_RETRY, GIT_COMMIT). The worktree is snapshotted before every node and the
+// node's diff is recorded in NodeResult.Diff.
+type GitOptions struct {
+	Repo         *gitops.Repo
+	ResetOnRetry bool // Restore the snapshot before each retry so it starts from a clean worktree.
+	Commit       bool // Commit the files the node changed after it passes (message from CommitMessage).
+}
+
+// maxCommitSubject caps the commit subject built from the node prompt.
+const maxCommitSubject = 72
+
+// CommitMessage returns the commit message for a node: its name and the first line of its prompt.
+func CommitMessage(node *types.ProcessedNode) string {
+	if node == nil {
+		return "monads: node"
+	}
+	subject := strings.TrimSpace(node.Name)
+	if line, _, _ := strings.Cut(strings.TrimSpace(node.Prompt), "\n"); line != "" {
+		if subject == "" {
+			subject = line
+		} else {
+			subject += ": " + line
+		}
+	}
+	if subject == "" {
+		subject = "monads: node"
+	}
+	if len(subject) > maxCommitSubject {
+		subject = strings.TrimSpace(subject[:maxCommitSubject-3]) + "..."
+	}
+	return subject
+}
+
+// recordAttemptDiff records the worktree changes since the node's snapshot on its last attempt
+// (the run or retry that just finished); a no-op without git checkpoints.
+func recordAttemptDiff(opts RunOptions, out *NodeResult) error {
+	if opts.snapshot == nil || len(out.Attempts) == 0 {
+		return nil
+	}
+	diff, err := opts.Git.Repo.Diff(*opts.snapshot)
+	if err != nil {
+		return fmt.Errorf("git diff: %w", err)
+	}
+	out.Attempts[len(out.Attempts)-1].Diff = diff
+	return nil
+}
+
+// finishGit records the node's diff in res and, when the node passed and Commit is set, commits
+// the files it changed.
+func finishGit(node *types.ProcessedNode, g *GitOptions, snap gitops.Snapshot, res *NodeResult) error {
+	diff, err := g.Repo.Diff(snap)
+	if err != nil {
+		return fmt.Errorf("git diff: %w", err)
+	}
+	res.Diff = diff
+	if !g.Commit || !res.Valid || diff == "" {
+		return nil
+	}
+	hash, err := g.Repo.CommitSince(snap, CommitMessage(node))
+	if err != nil {
+		return fmt.Errorf("git commit: %w", err)
+	}
+	res.Commit = hash
+	return nil
+}
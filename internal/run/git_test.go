@@ -0,0 +1,114 @@
+package run
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/gitops"
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func TestCommitMessage(t *testing.T) {
+	node := &types.ProcessedNode{Name: "Process", Prompt: "Add tests\nfor the parser"}
+	if got := CommitMessage(node); got != "Process: Add tests" {
+		t.Errorf("CommitMessage = %q", got)
+	}
+	long := &types.ProcessedNode{Name: "Process", Prompt: strings.Repeat("x", 100)}
+	if got := CommitMessage(long); len(got) != maxCommitSubject || !strings.HasSuffix(got, "...") {
+		t.Errorf("CommitMessage(long) = %q (%d)", got, len(got))
+	}
+}
+
+func TestRunNodeThenValidate_GitResetAndCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(k, "test")
+	}
+	for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(k, "test@example.com")
+	}
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readFile := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(b)
+	}
+	writeFile("a.txt", "one\n")
+	for _, args := range [][]string{{"init", "-q"}, {"add", "-A"}, {"commit", "-q", "-m", "init"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	repo, err := gitops.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processOut := `{"completed": true, "secs_taken": 1, "tokens_used": 1, "comments": []}`
+	calls := 0
+	SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+		calls++
+		switch calls {
+		case 1: // run: leaves a mess
+			writeFile("a.txt", "broken\n")
+			writeFile("junk.txt", "junk\n")
+			return runner.Result{Stdout: processOut, Success: true}, nil
+		case 2:
+			return runner.Result{Stdout: `{"fully_completed": false, "warnings": ["broken"]}`, Success: true}, nil
+		case 3: // retry: must start from the snapshot
+			if got := readFile("a.txt"); got != "one\n" {
+				t.Errorf("a.txt before retry = %q, want reset to snapshot", got)
+			}
+			if got := readFile("junk.txt"); got != "<missing>" {
+				t.Errorf("junk.txt before retry = %q, want removed", got)
+			}
+			writeFile("a.txt", "fixed\n")
+			return runner.Result{Stdout: processOut, Success: true}, nil
+		default:
+			return runner.Result{Stdout: `{"fully_completed": true, "warnings": []}`, Success: true}, nil
+		}
+	})
+	defer SetShellRunner(nil)
+
+	node := &types.ProcessedNode{Name: "Process", Prompt: "Fix a.txt", ValidatePrompt: "Check", Retries: 2}
+	opts := RunOptions{
+		DefaultCLI: "CURSOR", DefaultValidateCLI: "CURSOR", DefaultRetryCLI: "CURSOR", WorkDir: dir,
+		Git: &GitOptions{Repo: repo, ResetOnRetry: true, Commit: true},
+	}
+	res, err := RunNodeThenValidate(node, opts)
+	if err != nil {
+		t.Fatalf("RunNodeThenValidate: %v", err)
+	}
+	if !res.Valid || calls != 4 {
+		t.Fatalf("Valid = %v, calls = %d", res.Valid, calls)
+	}
+	if !strings.Contains(res.Diff, "+fixed") || strings.Contains(res.Diff, "junk") {
+		t.Errorf("Diff = %q", res.Diff)
+	}
+	if len(res.Attempts) != 4 || !strings.Contains(res.Attempts[0].Diff, "junk") || !strings.Contains(res.Attempts[2].Diff, "+fixed") || res.Attempts[1].Diff != "" {
+		t.Errorf("attempt diffs = %+v", res.Attempts)
+	}
+	if res.Commit == "" {
+		t.Fatal("Commit is empty")
+	}
+	cmd := exec.Command("git", "log", "-1", "--format=%s")
+	cmd.Dir = dir
+	if out, _ := cmd.Output(); strings.TrimSpace(string(out)) != "Process: Fix a.txt" {
+		t.Errorf("commit subject = %q", out)
+	}
+}
@@ -0,0 +1,426 @@
+package run
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/gitops"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// ErrPathViolation is set on NodeResult.ValidationError when an attempt changed files outside
+// allowed_paths or inside protected_paths.
+var ErrPathViolation = errors.New("path guardrails violated")
+
+// Guardrail rule names reported in PathViolation.Rule.
+const (
+	RuleProtectedPaths = "protected_paths"
+	RuleAllowedPaths   = "allowed_paths"
+)
+
+// maxRevertFileBytes caps the files whose content is kept for reverting outside a git repository.
+const maxRevertFileBytes = 1 << 20
+
+// PathGuard configures the path guardrails checked after every node attempt (settings
+// ALLOWED_PATHS, PROTECTED_PATHS, PATH_GUARD_REVERT). A node's allowed_paths replaces
+// AllowedPaths; its protected_paths are added to ProtectedPaths.
+type PathGuard struct {
+	AllowedPaths   []string // Glob patterns relative to the workdir; empty allows every path not protected.
+	ProtectedPaths []string
+	Revert         bool     // Undo the violating changes after the attempt.
+	Exclude        []string // Paths relative to the workdir that are never inspected, e.g. the log dir.
+}
+
+// PathViolation is one file changed by an attempt against the guardrails.
+type PathViolation struct {
+	Path     string `json:"path"` // Slash-separated, relative to the workdir.
+	Rule     string `json:"rule"` // RuleProtectedPaths or RuleAllowedPaths.
+	Reverted bool   `json:"reverted,omitempty"`
+}
+
+func (v PathViolation) String() string {
+	s := v.Path + " (" + v.Rule + ")"
+	if v.Reverted {
+		s += ", reverted"
+	}
+	return s
+}
+
+// guardRules returns the node's effective allowed and protected patterns.
+func guardRules(node *types.ProcessedNode, g *PathGuard) ([]string, []string) {
+	var allowed, protected []string
+	if g != nil {
+		allowed = g.AllowedPaths
+		protected = append(protected, g.ProtectedPaths...)
+	}
+	if node != nil {
+		if len(node.AllowedPaths) > 0 {
+			allowed = node.AllowedPaths
+		}
+		protected = append(protected, node.ProtectedPaths...)
+	}
+	return allowed, protected
+}
+
+// CheckPaths returns the violations among changed (slash-separated, relative to the workdir):
+// files matching a protected pattern, and, when allowed is non-empty, files matching none of it.
+// A pattern that matches a directory covers everything under it; "**" matches any directories.
+func CheckPaths(changed, allowed, protected []string) []PathViolation {
+	var out []PathViolation
+	for _, p := range changed {
+		switch {
+		case matchAnyPath(protected, p):
+			out = append(out, PathViolation{Path: p, Rule: RuleProtectedPaths})
+		case len(allowed) > 0 && !matchAnyPath(allowed, p):
+			out = append(out, PathViolation{Path: p, Rule: RuleAllowedPaths})
+		}
+	}
+	return out
+}
+
+func matchAnyPath(patterns []string, p string) bool {
+	segs := strings.Split(p, "/")
+	for _, pattern := range patterns {
+		pattern = strings.Trim(filepath.ToSlash(strings.TrimSpace(pattern)), "/")
+		pattern = strings.TrimPrefix(pattern, "./")
+		if pattern == "" {
+			continue
+		}
+		patSegs := strings.Split(pattern, "/")
+		for i := 1; i <= len(segs); i++ {
+			if matchSegments(patSegs, segs[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func pathViolationError(violations []PathViolation) error {
+	parts := make([]string, len(violations))
+	for i, v := range violations {
+		parts[i] = v.String()
+	}
+	return fmt.Errorf("%w: %s", ErrPathViolation, strings.Join(parts, "; "))
+}
+
+// FormatPathCritique returns retry feedback listing the guardrail violations of an attempt.
+func FormatPathCritique(violations []PathViolation) string {
+	var b strings.Builder
+	b.WriteString("Path guardrails: the previous attempt changed files it must not change.")
+	reverted := true
+	for _, v := range violations {
+		fmt.Fprintf(&b, "\n- %s", v)
+		reverted = reverted && v.Reverted
+	}
+	if reverted {
+		b.WriteString("\nThese changes were reverted. Do not change them again.")
+	} else {
+		b.WriteString("\nUndo these changes and only change allowed files.")
+	}
+	return b.String()
+}
+
+// pathScan records the workdir before an attempt: a git snapshot inside a repository,
+// otherwise a hash of every file. Snapshots leave gitignored files out, so inside a repository
+// the ignored files matching a protected pattern (.env, *.pem) are hashed as well.
+type pathScan struct {
+	workDir   string
+	exclude   []string // Slash-separated, relative to workDir.
+	protected []string
+
+	repo    *gitops.Repo
+	prefix  string // workDir relative to repo.Dir ("." at the root).
+	snap    gitops.Snapshot
+	ignored map[string]fileState // Protected gitignored files, relative to workDir.
+	// Set by changes: the gitignored files among the changes.
+	ignoredChanged map[string]bool
+
+	files map[string]fileState
+}
+
+type fileState struct {
+	hash    [sha256.Size]byte
+	mode    fs.FileMode
+	content []byte // Kept for reverting; nil when not kept or too large.
+}
+
+// startGuard scans the workdir before an attempt when the node has guardrails; it returns nil otherwise.
+func startGuard(node *types.ProcessedNode, opts RunOptions) (*pathScan, error) {
+	allowed, protected := guardRules(node, opts.Guard)
+	if len(allowed) == 0 && len(protected) == 0 {
+		return nil, nil
+	}
+	workDir := opts.WorkDir
+	if workDir == "" {
+		workDir, _ = os.Getwd()
+	}
+	s := &pathScan{workDir: workDir, protected: protected}
+	revert := false
+	if opts.Guard != nil {
+		revert = opts.Guard.Revert
+		for _, p := range opts.Guard.Exclude {
+			if p = strings.Trim(filepath.ToSlash(filepath.Clean(p)), "/"); p != "" && p != "." && !strings.HasPrefix(p, "..") {
+				s.exclude = append(s.exclude, p)
+			}
+		}
+	}
+	if repo, err := gitops.Open(workDir); err == nil {
+		if resolved, err := filepath.EvalSymlinks(workDir); err == nil {
+			workDir = resolved
+		}
+		prefix, err := filepath.Rel(repo.Dir, workDir)
+		if err != nil {
+			prefix = "."
+		}
+		s.prefix = filepath.ToSlash(prefix)
+		for _, p := range s.exclude {
+			repo.Exclude = append(repo.Exclude, path.Join(s.prefix, p))
+		}
+		s.repo = repo
+		if s.snap, err = repo.Snapshot(); err != nil {
+			return nil, fmt.Errorf("path guardrails: %w", err)
+		}
+		if s.ignored, err = s.hashIgnored(revert); err != nil {
+			return nil, fmt.Errorf("path guardrails: %w", err)
+		}
+		return s, nil
+	}
+	files, err := s.hashFiles(revert)
+	if err != nil {
+		return nil, fmt.Errorf("path guardrails: %w", err)
+	}
+	s.files = files
+	return s, nil
+}
+
+// finishGuard checks the attempt's changes against the node's guardrails, reverts the violating
+// files when PathGuard.Revert is set, and appends the violations to out.PathViolations.
+func finishGuard(node *types.ProcessedNode, opts RunOptions, s *pathScan, out *NodeResult) ([]PathViolation, error) {
+	if s == nil {
+		return nil, nil
+	}
+	changed, err := s.changes()
+	if err != nil {
+		return nil, fmt.Errorf("path guardrails: %w", err)
+	}
+	allowed, protected := guardRules(node, opts.Guard)
+	violations := CheckPaths(changed, allowed, protected)
+	if len(violations) > 0 && opts.Guard != nil && opts.Guard.Revert {
+		if err := s.revert(violations); err != nil {
+			out.PathViolations = append(out.PathViolations, violations...)
+			return violations, fmt.Errorf("path guardrails revert: %w", err)
+		}
+	}
+	out.PathViolations = append(out.PathViolations, violations...)
+	return violations, nil
+}
+
+// changes returns the files (slash-separated, relative to workDir) changed since the scan.
+func (s *pathScan) changes() ([]string, error) {
+	if s.repo != nil {
+		files, err := s.repo.ChangedFiles(s.snap)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]string, 0, len(files))
+		for _, f := range files {
+			out = append(out, s.fromRepo(f))
+		}
+		ignored, err := s.hashIgnored(false)
+		if err != nil {
+			return nil, err
+		}
+		s.ignoredChanged = make(map[string]bool)
+		for _, p := range changedFiles(s.ignored, ignored) {
+			s.ignoredChanged[p] = true
+			out = append(out, p)
+		}
+		sort.Strings(out)
+		return out, nil
+	}
+	now, err := s.hashFiles(false)
+	if err != nil {
+		return nil, err
+	}
+	return changedFiles(s.files, now), nil
+}
+
+// changedFiles returns the paths added, modified, or deleted between two hashes, sorted.
+func changedFiles(before, now map[string]fileState) []string {
+	var out []string
+	for p, st := range now {
+		if b, ok := before[p]; !ok || b.hash != st.hash {
+			out = append(out, p)
+		}
+	}
+	for p := range before {
+		if _, ok := now[p]; !ok {
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// revert restores the violating files to their state at the scan and marks them Reverted.
+// Outside git (and for gitignored files), modified files larger than maxRevertFileBytes cannot
+// be restored.
+func (s *pathScan) revert(violations []PathViolation) error {
+	if s.repo == nil {
+		return restoreFiles(s.workDir, s.files, violations, nil)
+	}
+	var paths []string
+	var tracked []int
+	for i, v := range violations {
+		if !s.ignoredChanged[v.Path] {
+			paths = append(paths, path.Join(s.prefix, v.Path))
+			tracked = append(tracked, i)
+		}
+	}
+	if err := s.repo.RestorePaths(s.snap, paths); err != nil {
+		return err
+	}
+	for _, i := range tracked {
+		violations[i].Reverted = true
+	}
+	return restoreFiles(s.workDir, s.ignored, violations, s.ignoredChanged)
+}
+
+// restoreFiles restores the violating files (only those in only, when set) from their hashed
+// state in files: files absent from it are removed, the others rewritten when their content was kept.
+func restoreFiles(workDir string, files map[string]fileState, violations []PathViolation, only map[string]bool) error {
+	for i, v := range violations {
+		if only != nil && !only[v.Path] {
+			continue
+		}
+		full := filepath.Join(workDir, filepath.FromSlash(v.Path))
+		before, existed := files[v.Path]
+		switch {
+		case !existed:
+			if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		case before.content != nil:
+			if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(full, before.content, before.mode.Perm()); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		violations[i].Reverted = true
+	}
+	return nil
+}
+
+// fromRepo converts a repository-relative path to one relative to the workdir.
+func (s *pathScan) fromRepo(p string) string {
+	if s.prefix == "." || s.prefix == "" {
+		return p
+	}
+	if strings.HasPrefix(p, s.prefix+"/") {
+		return strings.TrimPrefix(p, s.prefix+"/")
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(s.prefix), filepath.FromSlash(p))
+	if err != nil {
+		return p
+	}
+	return filepath.ToSlash(rel)
+}
+
+// hashFiles hashes every regular file under workDir except .git directories and excluded paths.
+// With keep, file contents up to maxRevertFileBytes are kept for revert.
+func (s *pathScan) hashFiles(keep bool) (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.WalkDir(s.workDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == s.workDir {
+				return err
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(s.workDir, p)
+		if err != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if d.Name() == ".git" || s.excluded(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || s.excluded(rel) {
+			return nil
+		}
+		if st, err := readFileState(p, keep); err == nil {
+			files[rel] = st
+		}
+		return nil
+	})
+	return files, err
+}
+
+// hashIgnored hashes the gitignored files under workDir that match a protected pattern.
+func (s *pathScan) hashIgnored(keep bool) (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	if len(s.protected) == 0 {
+		return files, nil
+	}
+	names, err := s.repo.IgnoredFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if s.prefix != "." && s.prefix != "" && !strings.HasPrefix(name, s.prefix+"/") {
+			continue
+		}
+		rel := s.fromRepo(name)
+		if s.excluded(rel) || !matchAnyPath(s.protected, rel) {
+			continue
+		}
+		if st, err := readFileState(filepath.Join(s.workDir, filepath.FromSlash(rel)), keep); err == nil {
+			files[rel] = st
+		}
+	}
+	return files, nil
+}
+
+// readFileState hashes a regular file; with keep, contents up to maxRevertFileBytes are kept.
+func readFileState(p string, keep bool) (fileState, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return fileState{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return fileState{}, fmt.Errorf("%s: not a regular file", p)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return fileState{}, err
+	}
+	st := fileState{hash: sha256.Sum256(data), mode: info.Mode()}
+	if keep && len(data) <= maxRevertFileBytes {
+		st.content = data
+	}
+	return st, nil
+}
+
+func (s *pathScan) excluded(rel string) bool {
+	for _, p := range s.exclude {
+		if rel == p || strings.HasPrefix(rel, p+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package run
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func TestCheckPaths(t *testing.T) {
+	changed := []string{"src/a.go", "src/gen/b.go", "go.mod", ".github/workflows/ci.yml", "docs/x.md", "_logs/run.json"}
+	got := CheckPaths(changed, []string{"src/**", "docs"}, []string{".github", "src/gen"})
+	want := []PathViolation{
+		{Path: "src/gen/b.go", Rule: RuleProtectedPaths},
+		{Path: "go.mod", Rule: RuleAllowedPaths},
+		{Path: ".github/workflows/ci.yml", Rule: RuleProtectedPaths},
+		{Path: "_logs/run.json", Rule: RuleAllowedPaths},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckPaths = %+v\nwant %+v", got, want)
+	}
+	if got := CheckPaths(changed, nil, []string{"*.mod"}); len(got) != 1 || got[0].Path != "go.mod" {
+		t.Errorf("CheckPaths(protected only) = %+v", got)
+	}
+}
+
+func TestGuardRules(t *testing.T) {
+	g := &PathGuard{AllowedPaths: []string{"src"}, ProtectedPaths: []string{".env"}}
+	node := &types.ProcessedNode{AllowedPaths: []string{"docs"}, ProtectedPaths: []string{"go.mod"}}
+	allowed, protected := guardRules(node, g)
+	if !reflect.DeepEqual(allowed, []string{"docs"}) || !reflect.DeepEqual(protected, []string{".env", "go.mod"}) {
+		t.Errorf("guardRules = %v, %v", allowed, protected)
+	}
+	if allowed, _ := guardRules(&types.ProcessedNode{}, g); !reflect.DeepEqual(allowed, []string{"src"}) {
+		t.Errorf("guardRules(no node paths) allowed = %v", allowed)
+	}
+}
+
+// TestRunNodeThenValidate_PathGuard runs in a plain directory (file hash scan): the first
+// attempt edits a protected file, which is reverted and fed back as critique.
+func TestRunNodeThenValidate_PathGuard(t *testing.T) {
+	t.Setenv("GIT_CEILING_DIRECTORIES", os.TempDir())
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readFile := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(b)
+	}
+	writeFile("go.mod", "module x\n")
+	writeFile("src/a.go", "package a\n")
+
+	processOut := `{"completed": true, "secs_taken": 1, "tokens_used": 1, "comments": []}`
+	var retryPrompt string
+	calls := 0
+	SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+		calls++
+		switch calls {
+		case 1:
+			writeFile("go.mod", "module hacked\n")
+			writeFile("src/a.go", "package a // edited\n")
+			writeFile("_logs/run.json", "{}")
+		case 2:
+			retryPrompt = spec.Command
+			writeFile("src/a.go", "package a // fixed\n")
+		}
+		return runner.Result{Stdout: processOut, Success: true}, nil
+	})
+	defer SetShellRunner(nil)
+
+	node := &types.ProcessedNode{Name: "Edit", Prompt: "Edit src", CLI: "CLAUDE", RetryCLI: "CLAUDE", Retries: 2, ProtectedPaths: []string{"go.mod"}}
+	opts := RunOptions{WorkDir: dir, Guard: &PathGuard{AllowedPaths: []string{"src/**", "go.mod"}, Revert: true, Exclude: []string{"_logs"}}}
+	res, err := RunNodeThenValidate(node, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Valid || calls != 2 || node.Retried != 1 {
+		t.Fatalf("Valid = %v, calls = %d, retried = %d; want pass after one retry", res.Valid, calls, node.Retried)
+	}
+	want := []PathViolation{{Path: "go.mod", Rule: RuleProtectedPaths, Reverted: true}}
+	if !reflect.DeepEqual(res.PathViolations, want) {
+		t.Errorf("PathViolations = %+v, want %+v", res.PathViolations, want)
+	}
+	if got := readFile("go.mod"); got != "module x\n" {
+		t.Errorf("go.mod = %q, want reverted", got)
+	}
+	if got := readFile("src/a.go"); got != "package a // fixed\n" {
+		t.Errorf("src/a.go = %q, want allowed change kept", got)
+	}
+	if !strings.Contains(retryPrompt, "Path guardrails") || !strings.Contains(retryPrompt, "go.mod (protected_paths)") {
+		t.Errorf("retry prompt missing path critique:\n%s", retryPrompt)
+	}
+}
+
+func TestRunNodeThenValidate_PathGuardExhausted(t *testing.T) {
+	t.Setenv("GIT_CEILING_DIRECTORIES", os.TempDir())
+	dir := t.TempDir()
+	calls := 0
+	SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+		calls++
+		if err := os.WriteFile(filepath.Join(dir, "stray.txt"), []byte(strings.Repeat("x", calls)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return runner.Result{Stdout: `{"completed": true, "secs_taken": 1, "tokens_used": 1, "comments": []}`, Success: true}, nil
+	})
+	defer SetShellRunner(nil)
+
+	node := &types.ProcessedNode{Name: "Edit", Prompt: "Edit", CLI: "CLAUDE", RetryCLI: "CLAUDE", Retries: 1, AllowedPaths: []string{"src"}}
+	res, err := RunNodeThenValidate(node, RunOptions{WorkDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Valid || !strings.Contains(res.ValidationError.Error(), "max retries reached") {
+		t.Errorf("Valid = %v, ValidationError = %v; want path violation after retries", res.Valid, res.ValidationError)
+	}
+	want := PathViolation{Path: "stray.txt", Rule: RuleAllowedPaths}
+	if !reflect.DeepEqual(res.PathViolations, []PathViolation{want, want}) {
+		t.Errorf("PathViolations = %+v, want one per attempt, not reverted", res.PathViolations)
+	}
+}
+
+// TestRunNodeThenValidate_PathGuardGitignored verifies that inside a git repository changes to
+// protected gitignored files (left out of snapshots) are caught and reverted.
+func TestRunNodeThenValidate_PathGuardGitignored(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	files := map[string]string{".gitignore": ".env\nsecrets/\n", ".env": "TOKEN=old\n", "secrets/id.pem": "key\n", "a.txt": "a\n"}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{{"init", "-q"}, {"add", "-A"}, {"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "-m", "init"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+
+	calls := 0
+	SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+		calls++
+		if calls == 1 {
+			os.WriteFile(filepath.Join(dir, ".env"), []byte("TOKEN=stolen\n"), 0o644)
+			os.Remove(filepath.Join(dir, "secrets", "id.pem"))
+			os.WriteFile(filepath.Join(dir, "secrets", "new.pem"), []byte("new\n"), 0o644)
+		}
+		return runner.Result{Stdout: `{"completed": true, "secs_taken": 1, "tokens_used": 1, "comments": []}`, Success: true}, nil
+	})
+	defer SetShellRunner(nil)
+
+	node := &types.ProcessedNode{Name: "Edit", Prompt: "Edit", CLI: "CLAUDE", RetryCLI: "CLAUDE", Retries: 1, ProtectedPaths: []string{".env", "secrets"}}
+	res, err := RunNodeThenValidate(node, RunOptions{WorkDir: dir, Guard: &PathGuard{Revert: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PathViolation{
+		{Path: ".env", Rule: RuleProtectedPaths, Reverted: true},
+		{Path: "secrets/id.pem", Rule: RuleProtectedPaths, Reverted: true},
+		{Path: "secrets/new.pem", Rule: RuleProtectedPaths, Reverted: true},
+	}
+	if !res.Valid || !reflect.DeepEqual(res.PathViolations, want) {
+		t.Fatalf("Valid = %v, PathViolations = %+v, want %+v", res.Valid, res.PathViolations, want)
+	}
+	for name, content := range map[string]string{".env": "TOKEN=old\n", "secrets/id.pem": "key\n"} {
+		if got, _ := os.ReadFile(filepath.Join(dir, name)); string(got) != content {
+			t.Errorf("%s = %q, want reverted", name, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "secrets", "new.pem")); !os.IsNotExist(err) {
+		t.Error("secrets/new.pem was not removed")
+	}
+}
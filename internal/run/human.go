@@ -0,0 +1,175 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// ErrNoChooser is returned for a Human decision node without an answer when there is no way to
+// ask a person.
+var ErrNoChooser = errors.New("human decision but no answer: run in a terminal or pass --answer node=route")
+
+// ChoiceRequest is what a person sees at a Human decision node.
+type ChoiceRequest struct {
+	Node     string   `json:"node"`
+	Question string   `json:"question,omitempty"` // The decision node's text.
+	Routes   []string `json:"routes"`             // Route labels, sorted.
+}
+
+// Chooser asks a person to pick one of req.Routes. It returns ctx.Err() when ctx is done first.
+type Chooser interface {
+	Choose(ctx context.Context, req ChoiceRequest) (string, error)
+}
+
+// NewChoiceRequest returns the request for a Human decision node.
+func NewChoiceRequest(node *types.ProcessedNode) ChoiceRequest {
+	return ChoiceRequest{Node: node.Name, Question: strings.TrimSpace(node.Prompt), Routes: sortedRoutes(node.Children)}
+}
+
+// RunHumanDecision picks the route of a Human decision node: from opts.Answers when it has one
+// for the node, otherwise through opts.Chooser. The choice is recorded in RunResult.Stdout as a
+// decision response, so the tree routes and resumes as for an agent's decision. An interrupt
+// while asking returns ErrInterrupted.
+func RunHumanDecision(node *types.ProcessedNode, req ChoiceRequest, opts RunOptions) (NodeResult, error) {
+	var out NodeResult
+	answer, ok := opts.Answers[node.Name]
+	reason := "answered ahead of time (--answer)"
+	if !ok {
+		if opts.Chooser == nil {
+			return out, fmt.Errorf("node %q: %w", node.Name, ErrNoChooser)
+		}
+		ctx, cancel := interruptContext(opts.Interrupts, 0)
+		defer cancel()
+		var err error
+		answer, err = opts.Chooser.Choose(ctx, req)
+		if err != nil {
+			if opts.Interrupts.Interrupted() {
+				out.Interrupted = true
+				return out, ErrInterrupted
+			}
+			return out, fmt.Errorf("node %q: choose route: %w", node.Name, err)
+		}
+		reason = "chosen by a person"
+	}
+	route, ok := matchRoute(req.Routes, answer)
+	if !ok {
+		return out, fmt.Errorf("node %q: no route %q (routes: %s)", node.Name, answer, strings.Join(quoteRoutes(req.Routes), ", "))
+	}
+	data, _ := json.Marshal(types.DecisionResponse{Choices: req.Routes, Answer: route, Reasons: []string{reason}})
+	out.RunResult.Stdout = string(data)
+	out.RunResult.Success = true
+	out.Valid = true
+	return out, nil
+}
+
+// matchRoute returns the route named by answer: exact, else case-insensitive.
+func matchRoute(routes []string, answer string) (string, bool) {
+	for _, r := range routes {
+		if r == answer {
+			return r, true
+		}
+	}
+	for _, r := range routes {
+		if strings.EqualFold(strings.TrimSpace(r), strings.TrimSpace(answer)) {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+func quoteRoutes(routes []string) []string {
+	out := make([]string, len(routes))
+	for i, r := range routes {
+		out[i] = strconv.Quote(r)
+	}
+	return out
+}
+
+// ParseAnswer parses a --answer value: node=route. The node name is everything before the first "=".
+func ParseAnswer(s string) (node, route string, err error) {
+	node, route, ok := strings.Cut(s, "=")
+	node = strings.TrimSpace(node)
+	if !ok || node == "" {
+		return "", "", fmt.Errorf("invalid answer %q: want node=route", s)
+	}
+	return node, strings.TrimSpace(route), nil
+}
+
+// ParseAnswers parses an answers file: either a JSON object of node name to route, or node=route
+// lines where blank lines and lines starting with # are ignored.
+func ParseAnswers(data []byte) (map[string]string, error) {
+	text := strings.TrimSpace(string(data))
+	out := make(map[string]string)
+	if strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal([]byte(text), &out); err != nil {
+			return nil, fmt.Errorf("invalid answers file: %w", err)
+		}
+		return out, nil
+	}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		node, route, err := ParseAnswer(line)
+		if err != nil {
+			return nil, fmt.Errorf("answers file line %d: %w", i+1, err)
+		}
+		out[node] = route
+	}
+	return out, nil
+}
+
+// checkHumanDecision reports a Human node that is not a decision, has an answer naming no route,
+// or has no answer and no Chooser.
+func checkHumanDecision(node *types.ProcessedNode, opts RunOptions) error {
+	if len(node.Children) < 2 {
+		return fmt.Errorf("the %s tag needs a decision node (two or more routes)", types.TagHuman)
+	}
+	routes := sortedRoutes(node.Children)
+	if answer, ok := opts.Answers[node.Name]; ok {
+		if _, ok := matchRoute(routes, answer); !ok {
+			return fmt.Errorf("answer %q names no route (routes: %s)", answer, strings.Join(quoteRoutes(routes), ", "))
+		}
+		return nil
+	}
+	if opts.Chooser == nil {
+		return ErrNoChooser
+	}
+	return nil
+}
+
+// Choose shows the routes of req and reads a route label or its number.
+func (t *TTYApprover) Choose(ctx context.Context, req ChoiceRequest) (string, error) {
+	fmt.Fprintf(t.Out, "\n=== Decision: %s ===\n", req.Node)
+	if req.Question != "" {
+		fmt.Fprintln(t.Out, req.Question)
+	}
+	for i, r := range req.Routes {
+		if r == "" {
+			r = "(unlabeled)"
+		}
+		fmt.Fprintf(t.Out, "  %d) %s\n", i+1, r)
+	}
+	for {
+		fmt.Fprintf(t.Out, "Route? [1-%d] ", len(req.Routes))
+		line, err := t.readLine(ctx)
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimSpace(line)
+		if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= len(req.Routes) {
+			return req.Routes[n-1], nil
+		}
+		if route, ok := matchRoute(req.Routes, line); ok {
+			return route, nil
+		}
+		fmt.Fprintf(t.Out, "no route %q\n", line)
+	}
+}
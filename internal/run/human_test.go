@@ -0,0 +1,68 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func TestParseAnswers(t *testing.T) {
+	got, err := ParseAnswers([]byte("# routes\nWhich approach? = rewrite\n\nDeploy=no=never\n"))
+	if err != nil || got["Which approach?"] != "rewrite" || got["Deploy"] != "no=never" {
+		t.Errorf("ParseAnswers(lines) = %v, %v", got, err)
+	}
+	got, err = ParseAnswers([]byte(`{"Which approach?": "patch"}`))
+	if err != nil || got["Which approach?"] != "patch" {
+		t.Errorf("ParseAnswers(JSON) = %v, %v", got, err)
+	}
+	if _, err := ParseAnswers([]byte("no separator")); err == nil {
+		t.Error("ParseAnswers(invalid line) err = nil")
+	}
+}
+
+func TestRunHumanDecision(t *testing.T) {
+	node := &types.ProcessedNode{Name: "Pick", Prompt: "Which approach?", Human: true, Children: map[string]*types.ProcessedNode{
+		"Patch":   {Name: "Patch"},
+		"Rewrite": {Name: "Rewrite"},
+	}}
+	req := NewChoiceRequest(node)
+
+	res, err := RunHumanDecision(node, req, RunOptions{Answers: map[string]string{"Pick": "rewrite"}})
+	if err != nil || !res.Valid {
+		t.Fatalf("RunHumanDecision(answer) = %+v, %v", res, err)
+	}
+	d, err := types.ParseDecisionResponse(res.RunResult.Stdout)
+	if err != nil || d.Answer != "Rewrite" || len(d.Choices) != 2 {
+		t.Errorf("recorded decision = %+v, %v; want answer Rewrite of 2 choices", d, err)
+	}
+
+	var out bytes.Buffer
+	tty := &TTYApprover{In: strings.NewReader("3\nmaybe\n1\n"), Out: &out}
+	res, err = RunHumanDecision(node, req, RunOptions{Chooser: tty})
+	if err != nil {
+		t.Fatalf("RunHumanDecision(terminal): %v", err)
+	}
+	if d, _ := types.ParseDecisionResponse(res.RunResult.Stdout); d.Answer != "Patch" || d.Reasons[0] != "chosen by a person" {
+		t.Errorf("terminal decision = %+v, want Patch chosen by a person", d)
+	}
+	if !strings.Contains(out.String(), "2) Rewrite") || !strings.Contains(out.String(), `no route "maybe"`) {
+		t.Errorf("terminal output:\n%s", out.String())
+	}
+
+	if _, err := RunHumanDecision(node, req, RunOptions{}); !errors.Is(err, ErrNoChooser) {
+		t.Errorf("RunHumanDecision(no answer) err = %v, want ErrNoChooser", err)
+	}
+
+	opts := RunOptions{Answers: map[string]string{"Pick": "Retry", "Other": "x"}}
+	err = Preflight(node, opts)
+	if err == nil || !strings.Contains(err.Error(), `answer "Retry" names no route`) || !strings.Contains(err.Error(), `answer for "Other"`) {
+		t.Errorf("Preflight(bad answers) = %v", err)
+	}
+	linear := &types.ProcessedNode{Name: "Pick", Human: true, Children: map[string]*types.ProcessedNode{"": {Name: "Next"}}}
+	if err := Preflight(linear, RunOptions{Chooser: tty, DefaultCLI: "CURSOR"}); err == nil || !strings.Contains(err.Error(), "needs a decision node") {
+		t.Errorf("Preflight(Human without routes) = %v", err)
+	}
+}
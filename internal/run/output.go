@@ -0,0 +1,157 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/schema"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// LoadOutputSchemas walks the tree and resolves each node's OutputSchema: inline JSON is
+// kept as-is, any other value is read as a file path (absolute, or relative to the first
+// of dirs where it exists). Every schema is parsed so problems surface before the run.
+func LoadOutputSchemas(root *types.ProcessedNode, dirs ...string) error {
+	var walk func(*types.ProcessedNode) error
+	walk = func(node *types.ProcessedNode) error {
+		if node == nil {
+			return nil
+		}
+		if raw := strings.TrimSpace(node.OutputSchema); raw != "" {
+			text, err := loadOutputSchema(raw, dirs)
+			if err != nil {
+				return fmt.Errorf("node %q output_schema: %w", node.Name, err)
+			}
+			node.OutputSchema = text
+		}
+		for _, child := range node.Children {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root)
+}
+
+func loadOutputSchema(raw string, dirs []string) (string, error) {
+	data := []byte(raw)
+	if !strings.HasPrefix(raw, "{") {
+		path, err := resolveNodePath(raw, dirs)
+		if err != nil {
+			return "", err
+		}
+		if data, err = os.ReadFile(path); err != nil {
+			return "", err
+		}
+	}
+	if _, err := schema.Parse(data); err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := json.Compact(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// resolveNodePath returns path when absolute, otherwise the first existing join of a dir
+// and path. When nothing exists the error names every location tried.
+func resolveNodePath(path string, dirs []string) (string, error) {
+	if filepath.IsAbs(path) {
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	var tried []string
+	for _, dir := range dirs {
+		if strings.TrimSpace(dir) == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, path)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+		tried = append(tried, candidate)
+	}
+	if len(tried) == 0 {
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("file %q not found (tried %s)", path, strings.Join(tried, ", "))
+}
+
+// HasOutputSchema reports whether the node's output is checked against an output schema.
+// Only process nodes carry structured output; decision nodes ignore output_schema.
+func HasOutputSchema(node *types.ProcessedNode) bool {
+	return node != nil && strings.TrimSpace(node.OutputSchema) != "" && ResponseKind(node) == ResponseKindProcess
+}
+
+// CheckOutput parses stdout as a ProcessResponse and validates its output against the
+// node's OutputSchema. It returns the output and the schema violations (empty when valid); a
+// response that is not a ProcessResponse is a violation too. A non-nil error means the schema
+// could not be parsed.
+// Nodes without an output schema return nil output and no violations.
+func CheckOutput(node *types.ProcessedNode, stdout string) (json.RawMessage, []string, error) {
+	if !HasOutputSchema(node) {
+		return nil, nil, nil
+	}
+	s, err := schema.Parse([]byte(node.OutputSchema))
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := types.ParseProcessResponse(stdout)
+	if err != nil {
+		return nil, []string{"response is not a JSON process response: " + err.Error()}, nil
+	}
+	if len(p.Output) == 0 {
+		return nil, []string{"response has no output key"}, nil
+	}
+	violations, err := s.ValidateJSON(p.Output)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(violations) > 0 {
+		return nil, violations, nil
+	}
+	return p.Output, nil, nil
+}
+
+// ErrOutputSchema is wrapped by NodeResult.ValidationError when the node's output did not match its output schema.
+var ErrOutputSchema = errors.New("output does not match output_schema")
+
+// FormatSchemaCritique turns schema violations into a critique string for the retry prompt.
+func FormatSchemaCritique(violations []string) string {
+	var b strings.Builder
+	b.WriteString("The output key did not match the required JSON Schema:\n")
+	for _, v := range violations {
+		b.WriteString("- ")
+		b.WriteString(v)
+		b.WriteString("\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// formatInputs renders the structured outputs of earlier nodes as a prompt section.
+func formatInputs(inputs []types.NodeOutput) string {
+	if len(inputs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("---\nStructured output from previous steps:\n")
+	for _, in := range inputs {
+		b.WriteString(in.Node)
+		b.WriteString(": ")
+		b.Write(in.Output)
+		b.WriteString("\n")
+	}
+	return strings.TrimSpace(b.String())
+}
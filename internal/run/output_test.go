@@ -0,0 +1,181 @@
+package run
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+const severitySchema = `{"type": "object", "required": ["severity"], "properties": {"severity": {"enum": ["low", "high"]}}}`
+
+func TestLoadOutputSchemas(t *testing.T) {
+	t.Run("inline_and_file", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "out.json"), []byte(severitySchema), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		child := &types.ProcessedNode{Name: "Child", OutputSchema: "out.json"}
+		root := &types.ProcessedNode{Name: "Root", OutputSchema: `{"type": "object"}`, Children: map[string]*types.ProcessedNode{"": child}}
+		if err := LoadOutputSchemas(root, t.TempDir(), dir); err != nil {
+			t.Fatalf("LoadOutputSchemas: %v", err)
+		}
+		if root.OutputSchema != `{"type":"object"}` {
+			t.Errorf("root OutputSchema = %q", root.OutputSchema)
+		}
+		if !strings.Contains(child.OutputSchema, `"severity"`) {
+			t.Errorf("child OutputSchema not loaded from file: %q", child.OutputSchema)
+		}
+	})
+	t.Run("missing_file", func(t *testing.T) {
+		root := &types.ProcessedNode{Name: "Root", OutputSchema: "nope.json"}
+		err := LoadOutputSchemas(root, t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "nope.json") {
+			t.Errorf("LoadOutputSchemas(missing) err = %v, want file not found", err)
+		}
+	})
+	t.Run("invalid_schema", func(t *testing.T) {
+		root := &types.ProcessedNode{Name: "Root", OutputSchema: `{"type": 5}`}
+		if err := LoadOutputSchemas(root); err == nil {
+			t.Error("LoadOutputSchemas(invalid) want error")
+		}
+	})
+}
+
+func TestCheckOutput(t *testing.T) {
+	node := &types.ProcessedNode{Prompt: "P", OutputSchema: severitySchema}
+	t.Run("valid", func(t *testing.T) {
+		out, violations, err := CheckOutput(node, `{"completed": true, "output": {"severity": "low"}}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(violations) != 0 {
+			t.Errorf("violations = %v", violations)
+		}
+		if string(out) != `{"severity": "low"}` {
+			t.Errorf("output = %s", out)
+		}
+	})
+	t.Run("violation", func(t *testing.T) {
+		out, violations, err := CheckOutput(node, `{"completed": true, "output": {"severity": "urgent"}}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != nil || len(violations) == 0 {
+			t.Errorf("CheckOutput = %s, %v; want violations", out, violations)
+		}
+	})
+	t.Run("missing_output", func(t *testing.T) {
+		_, violations, err := CheckOutput(node, `{"completed": true}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(violations) != 1 {
+			t.Errorf("violations = %v, want missing output", violations)
+		}
+	})
+	t.Run("not_json", func(t *testing.T) {
+		out, violations, err := CheckOutput(node, "I rated it high.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != nil || len(violations) != 1 {
+			t.Errorf("CheckOutput(not json) = %s, %v; want one violation", out, violations)
+		}
+	})
+	t.Run("no_schema", func(t *testing.T) {
+		out, violations, err := CheckOutput(&types.ProcessedNode{}, "not json")
+		if out != nil || violations != nil || err != nil {
+			t.Errorf("CheckOutput(no schema) = %s, %v, %v", out, violations, err)
+		}
+	})
+}
+
+func TestBuildRunPrompt_OutputSchemaAndInputs(t *testing.T) {
+	node := &types.ProcessedNode{
+		Prompt:       "Review the code",
+		OutputSchema: severitySchema,
+		Inputs:       []types.NodeOutput{{Node: "List", Output: []byte(`{"files":["a.go"]}`)}},
+	}
+	got := BuildRunPrompt(node)
+	if !strings.Contains(got, "conforms to this JSON Schema") || !strings.Contains(got, `"severity"`) {
+		t.Errorf("BuildRunPrompt missing schema instruction: %q", got)
+	}
+	if !strings.Contains(got, `List: {"files":["a.go"]}`) {
+		t.Errorf("BuildRunPrompt missing previous outputs: %q", got)
+	}
+}
+
+func TestRunNodeThenValidate_SchemaViolationRetries(t *testing.T) {
+	bad := `{"completed": true, "output": {"severity": "urgent"}}`
+	good := `{"completed": true, "output": {"severity": "high"}}`
+	var calls []string
+	SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+		calls = append(calls, spec.Command)
+		if len(calls) == 1 {
+			return runner.Result{Stdout: bad, Success: true}, nil
+		}
+		return runner.Result{Stdout: good, Success: true}, nil
+	})
+	defer SetShellRunner(nil)
+
+	node := &types.ProcessedNode{Prompt: "Rate it", OutputSchema: severitySchema, Retries: 2}
+	opts := RunOptions{DefaultCLI: "CURSOR", DefaultValidateCLI: "CURSOR", DefaultRetryCLI: "CURSOR"}
+	res, err := RunNodeThenValidate(node, opts)
+	if err != nil {
+		t.Fatalf("RunNodeThenValidate: %v", err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("shell calls = %d, want 2 (run + retry, no validation)", len(calls))
+	}
+	if !strings.Contains(calls[1], "did not match the required JSON Schema") {
+		t.Errorf("retry prompt missing schema critique: %q", calls[1])
+	}
+	if !res.Valid || res.ValidationError != nil {
+		t.Errorf("Valid = %v, ValidationError = %v; want valid after retry", res.Valid, res.ValidationError)
+	}
+	if string(res.Output) != `{"severity": "high"}` {
+		t.Errorf("Output = %s", res.Output)
+	}
+
+	t.Run("not_json", func(t *testing.T) {
+		replies := []string{"I rated it high.", "still prose", good}
+		var retries []string
+		SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+			retries = append(retries, spec.Command)
+			return runner.Result{Stdout: replies[len(retries)-1], Success: true}, nil
+		})
+		node := &types.ProcessedNode{Prompt: "Rate it", OutputSchema: severitySchema, Retries: 2}
+		res, err := RunNodeThenValidate(node, opts)
+		if err != nil {
+			t.Fatalf("RunNodeThenValidate: %v", err)
+		}
+		if len(retries) != 3 || !strings.Contains(retries[1], "not a JSON process response") {
+			t.Fatalf("calls = %d, want run + 2 retries with the parse error as critique", len(retries))
+		}
+		if !res.Valid || string(res.Output) != `{"severity": "high"}` {
+			t.Errorf("Valid = %v, Output = %s", res.Valid, res.Output)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+			return runner.Result{Stdout: bad, Success: true}, nil
+		})
+		node := &types.ProcessedNode{Prompt: "Rate it", OutputSchema: severitySchema, Retries: 1}
+		res, err := RunNodeThenValidate(node, opts)
+		if err != nil {
+			t.Fatalf("RunNodeThenValidate: %v", err)
+		}
+		if res.Valid || !errors.Is(res.ValidationError, ErrOutputSchema) {
+			t.Errorf("Valid = %v, ValidationError = %v; want ErrOutputSchema", res.Valid, res.ValidationError)
+		}
+		if res.Output != nil {
+			t.Errorf("Output = %s, want nil", res.Output)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// Preflight checks the tree before any agent runs: references must have had a value, CLIs and
+// models must resolve (retry ones only when the node canRetry), and path patterns and env
+// metadata must parse. Approval nodes need an Approver and Human nodes an answer or a Chooser,
+// both with unambiguous routes. All problems are returned together (errors.Join), one per node
+// and phase.
+func Preflight(root *types.ProcessedNode, opts RunOptions) error {
+	var errs []error
+	check := func(node *types.ProcessedNode, phase string, cli types.CLI, err error, model string) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("node %q %s: %w", node.Name, phase, err))
+			return
+		}
+		if err := types.CheckModel(cli, model, opts.ExtraModels[cli.Codename]); err != nil {
+			errs = append(errs, fmt.Errorf("node %q %s: %w", node.Name, phase, err))
+		}
+	}
+	humans := map[string]bool{} // names of Human decision nodes, to check opts.Answers against
+	var walk func(*types.ProcessedNode)
+	walk = func(node *types.ProcessedNode) {
+		if node == nil {
+			return
+		}
+		if len(node.UndefinedVars) > 0 {
+			errs = append(errs, fmt.Errorf("node %q: undefined variable(s): %s", node.Name, strings.Join(node.UndefinedVars, ", ")))
+		}
+		if _, err := NodeEnv(node); err != nil {
+			errs = append(errs, fmt.Errorf("node %q: %w", node.Name, err))
+		}
+		allowed, protected := guardRules(node, opts.Guard)
+		for _, p := range append(append([]string(nil), allowed...), protected...) {
+			if _, err := path.Match(filepath.ToSlash(p), ""); err != nil {
+				errs = append(errs, fmt.Errorf("node %q: invalid path pattern %q: %w", node.Name, p, err))
+			}
+		}
+		if node.Approval {
+			if opts.Approver == nil {
+				errs = append(errs, fmt.Errorf("node %q: %w", node.Name, ErrNoApprover))
+			}
+			if err := checkApprovalRoutes(node); err != nil {
+				errs = append(errs, fmt.Errorf("node %q: %w", node.Name, err))
+			}
+			for _, route := range sortedRoutes(node.Children) {
+				walk(node.Children[route])
+			}
+			return
+		}
+		if node.Human {
+			humans[node.Name] = true
+			if err := checkHumanDecision(node, opts); err != nil {
+				errs = append(errs, fmt.Errorf("node %q: %w", node.Name, err))
+			}
+			for _, route := range sortedRoutes(node.Children) {
+				walk(node.Children[route])
+			}
+			return
+		}
+		cli, err := ResolveCLI(node, opts.DefaultCLI)
+		check(node, "run", cli, err, ModelFor(node, cli, opts))
+		if ShouldValidate(node) {
+			vcli, err := ResolveValidateCLI(node, opts.DefaultValidateCLI)
+			check(node, "validate", vcli, err, strings.TrimSpace(opts.DefaultModels[vcli.Codename]))
+		}
+		if canRetry(node, opts.Guard) {
+			rcli, err := ResolveRetryCLI(node, opts.DefaultRetryCLI)
+			check(node, "retry", rcli, err, ModelFor(node, rcli, opts))
+		}
+		for _, route := range sortedRoutes(node.Children) {
+			walk(node.Children[route])
+		}
+	}
+	walk(root)
+	var answered []string
+	for name := range opts.Answers {
+		answered = append(answered, name)
+	}
+	sort.Strings(answered)
+	for _, name := range answered {
+		if !humans[name] {
+			errs = append(errs, fmt.Errorf("answer for %q: no %s decision node with that name", name, types.TagHuman))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sortedRoutes returns the route names of children in a stable order.
+func sortedRoutes(children map[string]*types.ProcessedNode) []string {
+	routes := make([]string, 0, len(children))
+	for route := range children {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
@@ -0,0 +1,57 @@
+package run
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func TestPreflight(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		root := &types.ProcessedNode{Name: "A", Prompt: "a", CLI: "CLAUDE", Model: "haiku", ValidatePrompt: "check"}
+		opts := RunOptions{DefaultValidateCLI: "GEMINI", DefaultRetryCLI: "CLAUDE"}
+		if err := Preflight(root, opts); err != nil {
+			t.Errorf("Preflight = %v, want nil", err)
+		}
+	})
+	t.Run("reports_every_problem", func(t *testing.T) {
+		child := &types.ProcessedNode{Name: "B", Prompt: "b", CLI: "QODO", Model: "gpt-5"}
+		root := &types.ProcessedNode{
+			Name: "A", Prompt: "a", CLI: "CLAUDE", Model: "gpt-5", ValidatePrompt: "check",
+			Children: map[string]*types.ProcessedNode{"": child},
+		}
+		opts := RunOptions{DefaultValidateCLI: "NOPE", DefaultRetryCLI: "CLAUDE"}
+		err := Preflight(root, opts)
+		if err == nil {
+			t.Fatal("Preflight = nil, want error")
+		}
+		for _, want := range []string{`node "A" run`, `node "A" validate`, `node "A" retry`, `node "B" run`, "MODELS_CLAUDE"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("Preflight error missing %q:\n%v", want, err)
+			}
+		}
+	})
+	t.Run("guarded_retry_cli", func(t *testing.T) {
+		// Path guardrails can retry a node without validation, so its retry CLI must resolve too.
+		root := &types.ProcessedNode{Name: "A", Prompt: "a", CLI: "CLAUDE", ProtectedPaths: []string{".env"}}
+		err := Preflight(root, RunOptions{DefaultRetryCLI: "NOPE"})
+		if err == nil || !strings.Contains(err.Error(), `node "A" retry`) {
+			t.Errorf("Preflight = %v, want retry CLI error", err)
+		}
+	})
+	t.Run("undefined_vars", func(t *testing.T) {
+		root := &types.ProcessedNode{Name: "A", Prompt: "a {{vars.ticket}}", CLI: "CLAUDE", UndefinedVars: []string{"vars.ticket"}}
+		err := Preflight(root, RunOptions{})
+		if err == nil || !strings.Contains(err.Error(), `node "A": undefined variable(s): vars.ticket`) {
+			t.Errorf("Preflight = %v, want undefined variable error", err)
+		}
+	})
+	t.Run("extra_models", func(t *testing.T) {
+		root := &types.ProcessedNode{Name: "A", Prompt: "a", CLI: "CLAUDE", Model: "proxy-large"}
+		opts := RunOptions{ExtraModels: map[string][]string{"CLAUDE": {"proxy-*"}}}
+		if err := Preflight(root, opts); err != nil {
+			t.Errorf("Preflight = %v, want nil", err)
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/redact"
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+)
+
+// Invocation phases.
+const (
+	PhaseRun      = "run"
+	PhaseValidate = "validate"
+	PhaseRetry    = "retry"
+)
+
+// Invocation identifies one agent call of a run.
+type Invocation struct {
+	Node    string `json:"node"`
+	Phase   string `json:"phase"`   // PhaseRun, PhaseValidate, or PhaseRetry.
+	Attempt int    `json:"attempt"` // 0 for the run and its validation; n for retry n and its validation.
+	CLI     string `json:"cli"`
+	Model   string `json:"model,omitempty"`
+	Prompt  string `json:"prompt"`
+}
+
+// Executor runs an agent invocation (RunOptions.Executor).
+type Executor interface {
+	Execute(inv Invocation, spec runner.CommandSpec) (runner.Result, error)
+}
+
+// ShellExecutor runs invocations with runner.RunShellCommand; it is the default Executor.
+type ShellExecutor struct{}
+
+// Execute runs spec.
+func (ShellExecutor) Execute(_ Invocation, spec runner.CommandSpec) (runner.Result, error) {
+	return runner.RunShellCommand(spec)
+}
+
+var (
+	// ErrNoRecording is returned by Replayer when an invocation was not recorded.
+	ErrNoRecording = errors.New("no recorded invocation")
+	// ErrReplayMismatch is returned by a strict Replayer when the prompt differs from the recording.
+	ErrReplayMismatch = errors.New("prompt differs from the recording")
+)
+
+// Recording is one recorded invocation: what was asked and what the agent returned.
+type Recording struct {
+	Invocation
+	Env    []string      `json:"env,omitempty"` // Names of the variables the agent received.
+	Result runner.Result `json:"result"`
+}
+
+// Recorder is an Executor that runs invocations with Next and writes each to Dir as
+// NNNNNN-<node>-<phase>-<attempt>.json (see Recording), redacted. Interrupted invocations are not
+// recorded. Numbering continues after recordings already in Dir, so a resumed run appends.
+type Recorder struct {
+	Dir      string
+	Next     Executor // nil = ShellExecutor
+	Redactor *redact.Redactor
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewRecorder creates dir if needed and returns a Recorder writing to it.
+func NewRecorder(dir string, next Executor, r *redact.Redactor) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("record dir: %w", err)
+	}
+	existing, err := recordingFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{Dir: dir, Next: next, Redactor: r, seq: len(existing)}, nil
+}
+
+// Execute runs the invocation and records it. A recording that cannot be written fails the
+// invocation.
+func (r *Recorder) Execute(inv Invocation, spec runner.CommandSpec) (runner.Result, error) {
+	next := r.Next
+	if next == nil {
+		next = ShellExecutor{}
+	}
+	res, err := next.Execute(inv, spec)
+	if errors.Is(err, ErrInterrupted) {
+		return res, err
+	}
+	data, jsonErr := json.MarshalIndent(Recording{Invocation: inv, Env: envNames(spec.Env), Result: res}, "", "  ")
+	if jsonErr != nil {
+		return res, fmt.Errorf("record: %w", jsonErr)
+	}
+	r.mu.Lock()
+	r.seq++
+	name := fmt.Sprintf("%06d-%s-%s-%d.json", r.seq, FileSlug(inv.Node), inv.Phase, inv.Attempt)
+	r.mu.Unlock()
+	if writeErr := os.WriteFile(filepath.Join(r.Dir, name), r.Redactor.Bytes(data), 0o644); writeErr != nil && err == nil {
+		err = fmt.Errorf("record: %w", writeErr)
+	}
+	return res, err
+}
+
+// Replayer is an Executor that returns recorded results instead of running agents. Recordings are
+// matched by node, phase, and attempt, in recording order when a key repeats. Strict also
+// requires the (redacted) prompt to equal the recorded one; otherwise prompt changes are ignored.
+// The recorded stdout is written to the spec's Stdout as if the agent had printed it.
+type Replayer struct {
+	Strict   bool
+	Redactor *redact.Redactor
+
+	mu      sync.Mutex
+	pending map[replayKey][]Recording
+}
+
+type replayKey struct {
+	node, phase string
+	attempt     int
+}
+
+// NewReplayer loads the recordings in dir (written by Recorder).
+func NewReplayer(dir string, strict bool, r *redact.Redactor) (*Replayer, error) {
+	files, err := recordingFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("replay dir %s holds no recordings", dir)
+	}
+	p := &Replayer{Strict: strict, Redactor: r, pending: map[replayKey][]Recording{}}
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		var rec Recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("recording %s: %w", name, err)
+		}
+		k := replayKey{rec.Node, rec.Phase, rec.Attempt}
+		p.pending[k] = append(p.pending[k], rec)
+	}
+	return p, nil
+}
+
+// Execute returns the next recording for the invocation; a recorded failure is returned as error.
+func (p *Replayer) Execute(inv Invocation, spec runner.CommandSpec) (runner.Result, error) {
+	k := replayKey{inv.Node, inv.Phase, inv.Attempt}
+	p.mu.Lock()
+	queue := p.pending[k]
+	if len(queue) > 0 {
+		p.pending[k] = queue[1:]
+	}
+	p.mu.Unlock()
+	if len(queue) == 0 {
+		return runner.Result{}, fmt.Errorf("%w for node %q %s attempt %d", ErrNoRecording, inv.Node, inv.Phase, inv.Attempt)
+	}
+	rec := queue[0]
+	if p.Strict {
+		if line, ok := firstDifference(rec.Prompt, p.Redactor.String(inv.Prompt)); !ok {
+			return runner.Result{}, fmt.Errorf("node %q %s attempt %d: %w (first difference on line %d)", inv.Node, inv.Phase, inv.Attempt, ErrReplayMismatch, line)
+		}
+	}
+	stdout := spec.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	_, _ = io.WriteString(stdout, rec.Result.Stdout)
+	if rec.Result.Error != "" {
+		return rec.Result, errors.New(rec.Result.Error)
+	}
+	return rec.Result, nil
+}
+
+// firstDifference reports whether a and b are equal, and otherwise the first line (1-based) where
+// they differ.
+func firstDifference(a, b string) (int, bool) {
+	if a == b {
+		return 0, true
+	}
+	al, bl := strings.Split(a, "\n"), strings.Split(b, "\n")
+	for i := range al {
+		if i >= len(bl) || al[i] != bl[i] {
+			return i + 1, false
+		}
+	}
+	return len(al) + 1, false
+}
+
+// recordingFiles returns the recording file names in dir, in recording order.
+func recordingFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// FileSlug makes a node name safe for a file name.
+func FileSlug(name string) string {
+	slug := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(name))
+	if len(slug) > 40 {
+		slug = slug[:40]
+	}
+	if slug == "" {
+		slug = "node"
+	}
+	return slug
+}
@@ -0,0 +1,95 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/redact"
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+type executorFunc func(Invocation, runner.CommandSpec) (runner.Result, error)
+
+func (f executorFunc) Execute(inv Invocation, spec runner.CommandSpec) (runner.Result, error) {
+	return f(inv, spec)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	validations := 0
+	var calls []Invocation
+	agent := executorFunc(func(inv Invocation, spec runner.CommandSpec) (runner.Result, error) {
+		calls = append(calls, inv)
+		stdout := `{"completed": true, "secs_taken": 0, "tokens_used": 0, "comments": ["token sk-secret-value"]}`
+		if inv.Phase == PhaseValidate {
+			validations++
+			stdout = `{"fully_completed": false, "partially_completed": true, "should_retry": true, "comments": []}`
+			if validations > 1 {
+				stdout = `{"fully_completed": true, "partially_completed": false, "should_retry": false, "comments": []}`
+			}
+		}
+		return runner.Result{Stdout: stdout, Success: true}, nil
+	})
+	newNode := func(prompt string) *types.ProcessedNode {
+		return &types.ProcessedNode{Name: "Fix bug", Prompt: prompt, ValidatePrompt: "Was it fixed?", Retries: 1}
+	}
+	r, err := redact.New([]string{"sk-secret-value"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, agent, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := RunOptions{DefaultCLI: "CURSOR", DefaultValidateCLI: "CURSOR", DefaultRetryCLI: "CURSOR", AgentStdout: io.Discard, Redactor: r, Executor: recorder}
+	res, err := RunNodeThenValidate(newNode("Fix it"), opts)
+	if err != nil || !res.Valid {
+		t.Fatalf("recorded run = %+v, %v", res, err)
+	}
+	var keys []string
+	for _, inv := range calls {
+		keys = append(keys, fmt.Sprintf("%s/%d", inv.Phase, inv.Attempt))
+	}
+	if got := strings.Join(keys, " "); got != "run/0 validate/0 retry/1 validate/1" {
+		t.Errorf("invocations = %s", got)
+	}
+	files, _ := recordingFiles(dir)
+	if len(files) != 4 || files[2] != "000003-Fix_bug-retry-1.json" {
+		t.Fatalf("recordings = %v", files)
+	}
+	data, _ := os.ReadFile(dir + "/" + files[0])
+	if strings.Contains(string(data), "sk-secret-value") {
+		t.Errorf("recording not redacted:\n%s", data)
+	}
+
+	calls = nil
+	replayer, err := NewReplayer(dir, true, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Executor = replayer
+	res, err = RunNodeThenValidate(newNode("Fix it"), opts)
+	if err != nil || !res.Valid || len(calls) != 0 {
+		t.Fatalf("strict replay = %+v, %v (agent calls %d)", res, err, len(calls))
+	}
+
+	replayer, _ = NewReplayer(dir, true, r)
+	opts.Executor = replayer
+	if _, err := RunNodeThenValidate(newNode("Fix it differently"), opts); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("strict replay of a changed prompt err = %v, want ErrReplayMismatch", err)
+	}
+	replayer, _ = NewReplayer(dir, false, r)
+	opts.Executor = replayer
+	if res, err := RunNodeThenValidate(newNode("Fix it differently"), opts); err != nil || !res.Valid {
+		t.Errorf("lenient replay of a changed prompt = %+v, %v", res, err)
+	}
+	other := &types.ProcessedNode{Name: "Other", Prompt: "x"}
+	if _, err := RunNodeThenValidate(other, opts); !errors.Is(err, ErrNoRecording) {
+		t.Errorf("replay of an unrecorded node err = %v, want ErrNoRecording", err)
+	}
+}
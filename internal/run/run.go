@@ -1,10 +1,18 @@
 package run
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"os"
+	"runtime"
 	"strings"
+	"time"
 
+	"github.com/ryanmontgomery/MonadsCLI/internal/adapter"
+	"github.com/ryanmontgomery/MonadsCLI/internal/gitops"
+	"github.com/ryanmontgomery/MonadsCLI/internal/redact"
 	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
 	"github.com/ryanmontgomery/MonadsCLI/prompts"
 	"github.com/ryanmontgomery/MonadsCLI/types"
@@ -20,14 +28,25 @@ const (
 	ResponseKindProcess = "process"
 	// ResponseKindDecision is used for nodes with multiple children (branching choice).
 	ResponseKindDecision = "decision"
+	// ResponseKindApproval is used for human approval gates (types.TagApproval); no agent runs.
+	ResponseKindApproval = "approval"
+	// ResponseKindHuman is used for decision nodes whose route a person chooses (types.TagHuman).
+	ResponseKindHuman = "human_decision"
 )
 
 // ResponseKind returns "process" for childless nodes and for nodes with exactly one child;
-// returns "decision" only for nodes with multiple children.
+// returns "decision" only for nodes with multiple children, "approval" for approval gates, and
+// "human_decision" for Human nodes.
 func ResponseKind(node *types.ProcessedNode) string {
 	if node == nil {
 		return ResponseKindProcess
 	}
+	if node.Approval {
+		return ResponseKindApproval
+	}
+	if node.Human {
+		return ResponseKindHuman
+	}
 	if len(node.Children) > 1 {
 		return ResponseKindDecision
 	}
@@ -59,8 +78,8 @@ func BuildRunPrompt(node *types.ProcessedNode) string {
 	if node == nil {
 		return ""
 	}
-	base := strings.TrimSpace(node.Prompt)
-	instruction := ProcessResponseInstructionForKind(ResponseKind(node))
+	base := promptWithInputs(node)
+	instruction := responseInstruction(node)
 	if base == "" {
 		return instruction
 	}
@@ -70,6 +89,58 @@ func BuildRunPrompt(node *types.ProcessedNode) string {
 	return base + "\n\n" + instruction
 }
 
+// promptWithInputs returns the node's preamble, prompt, and context files followed by the
+// structured outputs of earlier nodes, if any.
+func promptWithInputs(node *types.ProcessedNode) string {
+	return joinSections(node.Preamble, node.Prompt, node.Context, formatInputs(node.Inputs))
+}
+
+// joinSections joins the non-empty trimmed sections with blank lines.
+func joinSections(sections ...string) string {
+	var parts []string
+	for _, s := range sections {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// responseInstruction returns the response-type instruction for the node, plus the
+// output schema instruction when the node declares an output_schema.
+func responseInstruction(node *types.ProcessedNode) string {
+	data := promptData(node)
+	name := prompts.NameProcessResponse
+	if data.Kind == ResponseKindDecision {
+		name = prompts.NameDecisionResponse
+	}
+	instruction := prompts.Render(name, data)
+	if HasOutputSchema(node) {
+		instruction += "\n" + prompts.Render(prompts.NameOutputSchema, data)
+	}
+	return instruction
+}
+
+// promptData returns the node fields available to prompt overrides.
+func promptData(node *types.ProcessedNode) prompts.Data {
+	if node == nil {
+		return prompts.Data{Kind: ResponseKindProcess}
+	}
+	return prompts.Data{
+		Name:         node.Name,
+		Prompt:       node.Prompt,
+		Kind:         ResponseKind(node),
+		CLI:          node.CLI,
+		Model:        node.Model,
+		ValidateCLI:  node.ValidateCLI,
+		RetryCLI:     node.RetryCLI,
+		Retries:      node.Retries,
+		Retried:      node.Retried,
+		Timeout:      node.Timeout,
+		OutputSchema: strings.TrimSpace(node.OutputSchema),
+	}
+}
+
 // ProcessResponseInstructionForKind returns the prompt instruction for the given kind.
 func ProcessResponseInstructionForKind(kind string) string {
 	switch kind {
@@ -83,16 +154,36 @@ func ProcessResponseInstructionForKind(kind string) string {
 }
 
 // BuildCommand substitutes the full prompt into the CLI's Prompt template.
-// The template uses "<prompt>" as the placeholder. The prompt is escaped for safe use inside double quotes in a shell command.
+// The template uses "<prompt>" (optionally double-quoted) as the placeholder. The prompt is
+// single-quoted, so the shell expands nothing in it.
 func BuildCommand(cli types.CLI, fullPrompt string) string {
-	escaped := escapeForShellPrompt(fullPrompt)
-	return strings.Replace(cli.Prompt, "<prompt>", escaped, 1)
+	return BuildCommandWithModel(cli, "", fullPrompt)
 }
 
-// escapeForShellPrompt escapes fullPrompt for embedding inside double-quoted string in a shell -c command.
-func escapeForShellPrompt(s string) string {
-	s = strings.ReplaceAll(s, `\`, `\\`)
-	return strings.ReplaceAll(s, `"`, `\"`)
+// BuildCommandWithModel is BuildCommand plus the CLI's ModelFlag and model, inserted after the
+// command name (or appended when the template does not start with it). An empty model, or a CLI
+// without a ModelFlag, renders the plain template.
+func BuildCommandWithModel(cli types.CLI, model, fullPrompt string) string {
+	command := strings.Replace(cli.Prompt, `"<prompt>"`, "<prompt>", 1)
+	model = strings.TrimSpace(model)
+	if model != "" && cli.ModelFlag != "" {
+		selector := cli.ModelFlag + " " + shellQuote(model)
+		if cli.Command != "" && strings.HasPrefix(command, cli.Command+" ") {
+			command = cli.Command + " " + selector + command[len(cli.Command):]
+		} else {
+			command += " " + selector
+		}
+	}
+	return strings.Replace(command, "<prompt>", shellQuote(fullPrompt), 1)
+}
+
+// shellQuote single-quotes s for the shell of runner.DefaultShell: prompts carry file contents
+// and variables, and nothing in them may run or expand (backticks, $(...), $VAR).
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
 
 // RunOptions configures RunNode, validation, and retries.
@@ -101,25 +192,189 @@ type RunOptions struct {
 	DefaultValidateCLI string // Codename when node.ValidateCLI is empty (e.g. from settings DEFAULT_VALIDATE_CLI).
 	DefaultRetryCLI    string // Codename when node.RetryCLI is empty (e.g. from settings DEFAULT_RETRY_CLI).
 	WorkDir            string // Working directory for the shell command; empty means current dir.
+	NativeOutput       bool   // Use each CLI's machine-readable output mode when it has one (settings NATIVE_OUTPUT).
+
+	DefaultModels map[string]string   // Codename -> model when the node sets none (settings DEFAULT_MODEL_<CODENAME>).
+	ExtraModels   map[string][]string // Codename -> extra accepted model names (settings MODELS_<CODENAME>).
+
 	// LogLongWriter, when set, receives each LLM stdout (run, validate, retry) for long log.
 	LogLongWriter io.Writer
+	// Ledger, when set, accumulates usage of every invocation and enforces the run budget.
+	Ledger *Ledger
+	// Git, when set, snapshots the worktree before each node and records its diff (see GitOptions).
+	Git *GitOptions
+	// Guard holds the settings-level path guardrails; nodes may add their own (see PathGuard).
+	Guard *PathGuard
+	// Env, when set, gives each agent invocation a scoped environment instead of the process
+	// environment (see EnvOptions); nil inherits everything.
+	Env *EnvOptions
+	// Redactor, when set, masks secrets in the run logs before they are written.
+	Redactor *redact.Redactor
+	// Interrupts, when set, stops the running agent on interrupt; no further invocation starts
+	// once it is interrupted (ErrInterrupted).
+	Interrupts *runner.Interrupts
+	// AgentStdout and AgentStderr receive the live output of agent invocations (nil = os.Stdout /
+	// os.Stderr; io.Discard for quiet). With PrefixAgentOutput each line starts with "[node name] ".
+	AgentStdout       io.Writer
+	AgentStderr       io.Writer
+	PrefixAgentOutput bool
+	// Capture bounds the agent output kept in memory; longer output spills to files, filtered by
+	// Redactor (see runner.CaptureOptions).
+	Capture runner.CaptureOptions
+	// MaxPromptOutput caps the node output embedded in the validation prompt (head and tail
+	// around a marker); <= 0 uses DefaultMaxPromptOutput.
+	MaxPromptOutput int
+	// OnNodeDone, when set, is called by runlog.ExecuteTree with each executed node's result.
+	OnNodeDone func(*types.ProcessedNode, NodeResult)
+	// Approver answers approval nodes (see RunApproval); nil fails them with ErrNoApprover.
+	// ApprovalTimeout applies when the node sets no approval_timeout; 0 waits indefinitely.
+	Approver        Approver
+	ApprovalTimeout time.Duration
+	// Answers holds the routes chosen ahead of time for Human decision nodes, by node name
+	// (run-tree --answer / --answers); nodes without one are asked through Chooser.
+	Answers map[string]string
+	Chooser Chooser
+	// Executor runs agent invocations; nil runs them with runner.RunShellCommand. Recorder and
+	// Replayer record a run and serve it again without calling agents.
+	Executor Executor
+
+	// Set by RunNodeThenValidate so runCLI can count the node's calls against max_calls.
+	node      *types.ProcessedNode
+	nodeUsage *Usage
+	// Set by RunNodeThenValidate when Git is enabled: the worktree before the node ran.
+	snapshot *gitops.Snapshot
+	// Set by RunNodeThenValidate: where env audit entries of the node's invocations are recorded.
+	envAudit *[]EnvAudit
+	// Set by RunNodeThenValidate: where the node's invocations are recorded (NodeResult.Attempts).
+	attempts *[]Attempt
 }
 
-// shellRunner is set by tests to fake shell execution; when nil, the real runner is used.
+// ErrInterrupted is returned when the run was interrupted (RunOptions.Interrupts) during or
+// before an agent invocation.
+var ErrInterrupted = runner.ErrInterrupted
+
+// shellRunner is set by tests to fake shell execution; when nil, opts.Executor is used.
 var shellRunner func(runner.CommandSpec) (runner.Result, error)
 
-// SetShellRunner sets the shell runner used by RunNode, RunValidation, and RunRetry (for tests). Pass nil to restore default.
+// SetShellRunner sets the shell runner used by RunNode, RunValidation, and RunRetry (for tests),
+// in place of RunOptions.Executor. Pass nil to restore default.
 func SetShellRunner(f func(runner.CommandSpec) (runner.Result, error)) {
 	shellRunner = f
 }
 
-func runShell(spec runner.CommandSpec) (runner.Result, error) {
+func runShell(inv Invocation, spec runner.CommandSpec, opts RunOptions) (runner.Result, error) {
 	if shellRunner != nil {
 		return shellRunner(spec)
 	}
+	if opts.Executor != nil {
+		return opts.Executor.Execute(inv, spec)
+	}
 	return runner.RunShellCommand(spec)
 }
 
+// runCLI renders prompt into the CLI's command (native output mode when enabled), runs it,
+// unwraps the native envelope into the final assistant message, and appends stdout to the long log.
+// Budgets are checked before the invocation and its usage is recorded after. With opts.Env set,
+// the command gets only the scoped environment from BuildEnv. phase (PhaseRun, PhaseValidate,
+// PhaseRetry) identifies the invocation to opts.Executor.
+func runCLI(node *types.ProcessedNode, phase string, cli types.CLI, model, prompt string, opts RunOptions) (runner.Result, error) {
+	if opts.nodeUsage != nil {
+		if err := checkNodeCalls(opts.node, *opts.nodeUsage); err != nil {
+			return runner.Result{}, err
+		}
+	}
+	if err := opts.Ledger.Check(); err != nil {
+		return runner.Result{}, err
+	}
+	if opts.Interrupts.Interrupted() {
+		return runner.Result{}, ErrInterrupted
+	}
+	var env []string
+	if opts.Env != nil {
+		var err error
+		if env, err = BuildEnv(cli, node, *opts.Env); err != nil {
+			return runner.Result{}, err
+		}
+		if opts.Env.Audit != nil {
+			recordEnvAudit(node, cli, env, opts)
+		}
+	}
+	cli = adapter.Command(cli, opts.NativeOutput)
+	command := BuildCommandWithModel(cli, model, prompt)
+	shell, shellArgs := runner.DefaultShell()
+	stdout, stderr := agentOutput(node, cli, opts)
+	inv := Invocation{Phase: phase, CLI: cli.Codename, Model: model, Prompt: prompt}
+	if node != nil {
+		inv.Node, inv.Attempt = node.Name, node.Retried
+	}
+	res, err := runShell(inv, runner.CommandSpec{
+		Shell:      shell,
+		ShellArgs:  shellArgs,
+		Command:    command,
+		WorkDir:    opts.WorkDir,
+		Env:        env,
+		Interrupts: opts.Interrupts,
+		Stdout:     stdout,
+		Stderr:     stderr,
+		Capture:    captureOptions(opts),
+	}, opts)
+	flushAgentOutput(stdout, stderr)
+	res = adapter.Apply(cli.OutputFormat, res)
+	if err == nil && !res.Success && res.Error != "" {
+		// The CLI exited cleanly but reported an error result (e.g. rate limited).
+		err = errors.New(res.Error)
+	}
+	if opts.attempts != nil {
+		*opts.attempts = append(*opts.attempts, newAttempt(inv, res, err))
+	}
+	opts.Ledger.Record(cli.Codename, &res)
+	if opts.nodeUsage != nil {
+		opts.nodeUsage.Add(UsageOf(res))
+	}
+	if err == nil || errors.Is(err, ErrInterrupted) {
+		// An interrupted agent's partial output is kept for the long log.
+		appendLongLog(opts.LogLongWriter, res.Stdout)
+	}
+	return res, err
+}
+
+// captureOptions returns opts.Capture with the redactor as spill filter.
+func captureOptions(opts RunOptions) runner.CaptureOptions {
+	c := opts.Capture
+	if c.Filter == nil && opts.Redactor != nil {
+		c.Filter = opts.Redactor.Bytes
+	}
+	return c
+}
+
+// agentOutput returns the live output writers for one invocation (see RunOptions.AgentStdout).
+func agentOutput(node *types.ProcessedNode, cli types.CLI, opts RunOptions) (io.Writer, io.Writer) {
+	if !opts.PrefixAgentOutput {
+		return opts.AgentStdout, opts.AgentStderr
+	}
+	stdout, stderr := opts.AgentStdout, opts.AgentStderr
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	name := cli.Codename
+	if node != nil && strings.TrimSpace(node.Name) != "" {
+		name = strings.TrimSpace(node.Name)
+	}
+	prefix := "[" + name + "] "
+	return runner.NewPrefixWriter(stdout, prefix), runner.NewPrefixWriter(stderr, prefix)
+}
+
+func flushAgentOutput(writers ...io.Writer) {
+	for _, w := range writers {
+		if p, ok := w.(*runner.PrefixWriter); ok {
+			_ = p.Flush()
+		}
+	}
+}
+
 func appendLongLog(w io.Writer, stdout string) {
 	if w == nil || stdout == "" {
 		return
@@ -138,19 +393,18 @@ func RunNode(node *types.ProcessedNode, opts RunOptions) (runner.Result, error)
 	if err != nil {
 		return runner.Result{}, err
 	}
-	fullPrompt := BuildRunPrompt(node)
-	command := BuildCommand(cli, fullPrompt)
-	shell, shellArgs := runner.DefaultShell()
-	res, err := runShell(runner.CommandSpec{
-		Shell:     shell,
-		ShellArgs: shellArgs,
-		Command:   command,
-		WorkDir:   opts.WorkDir,
-	})
-	if err == nil {
-		appendLongLog(opts.LogLongWriter, res.Stdout)
+	return runCLI(node, PhaseRun, cli, ModelFor(node, cli, opts), BuildRunPrompt(node), opts)
+}
+
+// ModelFor returns the model for invoking cli on behalf of node: node.Model when cli is the
+// node's own CLI (run and retries on the same CLI), otherwise DEFAULT_MODEL_<CODENAME> from opts.
+func ModelFor(node *types.ProcessedNode, cli types.CLI, opts RunOptions) string {
+	if node != nil && strings.TrimSpace(node.Model) != "" {
+		if own, err := ResolveCLI(node, opts.DefaultCLI); err == nil && own.Codename == cli.Codename {
+			return strings.TrimSpace(node.Model)
+		}
 	}
-	return res, err
+	return strings.TrimSpace(opts.DefaultModels[cli.Codename])
 }
 
 // ShouldValidate reports whether the node should be validated after it runs.
@@ -225,7 +479,7 @@ func BuildRetryPrompt(node *types.ProcessedNode, priorCritiques []string) string
 	if node == nil {
 		return ""
 	}
-	base := strings.TrimSpace(node.Prompt)
+	base := promptWithInputs(node)
 	for _, c := range priorCritiques {
 		if strings.TrimSpace(c) == "" {
 			continue
@@ -233,7 +487,7 @@ func BuildRetryPrompt(node *types.ProcessedNode, priorCritiques []string) string
 		base += "\n\n---\nPrevious validation feedback:\n"
 		base += strings.TrimSpace(c)
 	}
-	instruction := ProcessResponseInstructionForKind(ResponseKind(node))
+	instruction := responseInstruction(node)
 	if instruction == "" {
 		return base
 	}
@@ -280,8 +534,12 @@ func BuildValidatePrompt(node *types.ProcessedNode, nodeOutput string) string {
 	if validateText == "" {
 		return ""
 	}
-	instruction := prompts.ValidationResponseInstruction()
+	instruction := prompts.Render(prompts.NameValidationResponse, promptData(node))
 	var b strings.Builder
+	if preamble := strings.TrimSpace(node.Preamble); preamble != "" {
+		b.WriteString(preamble)
+		b.WriteString("\n\n")
+	}
 	b.WriteString(validateText)
 	b.WriteString("\n\n---\nOriginal task:\n")
 	b.WriteString(strings.TrimSpace(node.Prompt))
@@ -299,30 +557,28 @@ type ValidationResult struct {
 	Valid        bool // true when response was parsed and fully_completed is true
 }
 
+// DefaultMaxPromptOutput is the default cap on node output embedded in the validation prompt.
+const DefaultMaxPromptOutput = 64 << 10
+
 // RunValidation runs the validation prompt for the node using the validate CLI, then parses and verifies
 // the response matches ValidationResponse. Valid is true only when fully_completed is true.
+// Output longer than opts.MaxPromptOutput is embedded as its head and tail.
 func RunValidation(node *types.ProcessedNode, opts RunOptions, nodeOutput string) (ValidationResult, error) {
 	var out ValidationResult
 	cli, err := ResolveValidateCLI(node, opts.DefaultValidateCLI)
 	if err != nil {
 		return out, err
 	}
-	fullPrompt := BuildValidatePrompt(node, nodeOutput)
+	maxOutput := opts.MaxPromptOutput
+	if maxOutput <= 0 {
+		maxOutput = DefaultMaxPromptOutput
+	}
+	fullPrompt := BuildValidatePrompt(node, runner.TruncateMiddle(nodeOutput, maxOutput))
 	if fullPrompt == "" {
 		return out, errors.New("validation prompt is empty")
 	}
-	command := BuildCommand(cli, fullPrompt)
-	shell, shellArgs := runner.DefaultShell()
-	res, err := runShell(runner.CommandSpec{
-		Shell:     shell,
-		ShellArgs: shellArgs,
-		Command:   command,
-		WorkDir:   opts.WorkDir,
-	})
+	res, err := runCLI(node, PhaseValidate, cli, strings.TrimSpace(opts.DefaultModels[cli.Codename]), fullPrompt, opts)
 	out.RunnerResult = res
-	if err == nil {
-		appendLongLog(opts.LogLongWriter, res.Stdout)
-	}
 	if err != nil {
 		return out, err
 	}
@@ -342,22 +598,140 @@ type NodeResult struct {
 	ValidationRan   bool              // true when validation was run (even if parse failed)
 	Valid          bool              // true when no validation or validation passed (fully_completed)
 	ValidationError error             // set when validation was run but failed (parse or not fully_completed)
+	Output          json.RawMessage   // structured output that matched the node's output schema; nil otherwise
+	Usage           Usage             // totals over run, validation, and retry invocations
+
+	Diff   string // worktree changes made by the node (RunOptions.Git); empty when disabled or unchanged
+	Commit string // commit created after validated success (GitOptions.Commit)
+
+	PathViolations []PathViolation // guardrail violations of every attempt (allowed_paths / protected_paths)
+	Env            []EnvAudit      // variables each invocation received (EnvOptions.Audit); names only
+	Interrupted    bool            // the node was stopped by an interrupt (ErrInterrupted)
+	Resumed        bool            // replayed from the resume state of an interrupted run; no agent ran
+	Approval       *Approval       // the answer at an approval node (RunApproval)
+	Attempts       []Attempt       // every agent invocation of the node, in order
+}
+
+// Attempt is one agent invocation of a node: its run, a validation, or a retry.
+type Attempt struct {
+	Phase      string `json:"phase"`   // PhaseRun, PhaseValidate, or PhaseRetry.
+	Attempt    int    `json:"attempt"` // 0 for the run and its validation, n for retry n and its validation.
+	CLI        string `json:"cli"`
+	Model      string `json:"model,omitempty"`
+	Prompt     string `json:"prompt"` // The rendered prompt.
+	Response   string `json:"response"`
+	Stderr     string `json:"stderr,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	Diff       string `json:"diff,omitempty"` // Worktree changes since the node started, after a run or retry (RunOptions.Git).
+	// Critique is the feedback this attempt produced for the next retry: the failed validation,
+	// output schema violations, or path violations.
+	Critique string `json:"critique,omitempty"`
+}
+
+func newAttempt(inv Invocation, res runner.Result, err error) Attempt {
+	a := Attempt{
+		Phase:      inv.Phase,
+		Attempt:    inv.Attempt,
+		CLI:        inv.CLI,
+		Model:      inv.Model,
+		Prompt:     inv.Prompt,
+		Response:   strings.TrimSpace(res.Stdout),
+		Stderr:     strings.TrimSpace(res.Stderr),
+		ExitCode:   res.ExitCode,
+		DurationMs: res.DurationMs,
+	}
+	if res.Model != "" {
+		a.Model = res.Model
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	return a
+}
+
+// critique records c as the critique of the node's last attempt.
+func (r *NodeResult) critique(c string) {
+	if n := len(r.Attempts); n > 0 {
+		r.Attempts[n-1].Critique = c
+	}
 }
 
 // RunNodeThenValidate runs the node, then automatically runs validation when ShouldValidate(node) is true.
 // On success (node run succeeds and, if validation ran, validation passed), Valid is true and the caller can run the next node.
 // On validation failure, retries run with a custom retry prompt (original + prior validation critiques + response type) until validation passes or EffectiveRetryLimit is reached.
+// When the node declares an output schema, an output that does not match it is retried the same way, with the violations as critique.
+// Usage of every invocation is totalled in NodeResult.Usage; node max_calls and the run budget (opts.Ledger) return ErrBudgetExceeded.
 // Returns a non-nil error only for run or validation CLI/shell/parse failures; when validation ran and fully_completed is false and retries exhausted, error is nil and Valid is false.
+// With opts.Git set, the worktree is snapshotted first and the node's diff is recorded in NodeResult.Diff; GitOptions controls reset before retries and commit after success.
+// When the node has path guardrails (opts.Guard, allowed_paths, protected_paths), each attempt that changes disallowed files is retried with the violations as critique.
+// An interrupt (opts.Interrupts) stops the node with ErrInterrupted and sets NodeResult.Interrupted.
 func RunNodeThenValidate(node *types.ProcessedNode, opts RunOptions) (NodeResult, error) {
+	res, err := runNodeWithGit(node, opts)
+	res.Interrupted = errors.Is(err, ErrInterrupted)
+	return res, err
+}
+
+func runNodeWithGit(node *types.ProcessedNode, opts RunOptions) (NodeResult, error) {
 	var out NodeResult
+	if opts.Git == nil || opts.Git.Repo == nil {
+		return runNodeThenValidate(node, opts, &out)
+	}
+	snap, err := opts.Git.Repo.Snapshot()
+	if err != nil {
+		return out, fmt.Errorf("git snapshot: %w", err)
+	}
+	opts.snapshot = &snap
+	res, runErr := runNodeThenValidate(node, opts, &out)
+	if err := finishGit(node, opts.Git, snap, &res); err != nil && runErr == nil {
+		return res, err
+	}
+	return res, runErr
+}
+
+func runNodeThenValidate(node *types.ProcessedNode, opts RunOptions, out *NodeResult) (NodeResult, error) {
+	opts.node = node
+	opts.nodeUsage = &out.Usage
+	opts.envAudit = &out.Env
+	opts.attempts = &out.Attempts
+	scan, err := startGuard(node, opts)
+	if err != nil {
+		return *out, err
+	}
 	runRes, err := RunNode(node, opts)
 	out.RunResult = runRes
 	if err != nil {
-		return out, err
+		return *out, err
+	}
+	pathViolations, err := finishGuard(node, opts, scan, out)
+	if err != nil {
+		out.ValidationError = err
+		return *out, err
+	}
+	if err := recordAttemptDiff(opts, out); err != nil {
+		out.ValidationError = err
+		return *out, err
+	}
+	if len(pathViolations) > 0 {
+		out.ValidationError = pathViolationError(pathViolations)
+		out.critique(FormatPathCritique(pathViolations))
+		return runRetryLoop(node, opts, out, []string{FormatPathCritique(pathViolations)})
+	}
+	output, violations, err := CheckOutput(node, runRes.Stdout)
+	if err != nil {
+		out.ValidationError = err
+		return *out, err
+	}
+	if len(violations) > 0 {
+		out.ValidationError = fmt.Errorf("%w: %s", ErrOutputSchema, strings.Join(violations, "; "))
+		out.critique(FormatSchemaCritique(violations))
+		return runRetryLoop(node, opts, out, []string{FormatSchemaCritique(violations)})
 	}
+	out.Output = output
 	if !ShouldValidate(node) {
 		out.Valid = true
-		return out, nil
+		return *out, nil
 	}
 	out.ValidationRan = true
 	valRes, err := RunValidation(node, opts, runRes.Stdout)
@@ -365,18 +739,19 @@ func RunNodeThenValidate(node *types.ProcessedNode, opts RunOptions) (NodeResult
 	if err != nil {
 		out.ValidationError = err
 		out.Valid = false
-		return out, err
+		return *out, err
 	}
 	out.Valid = valRes.Valid
 	if !out.Valid {
 		out.ValidationError = errors.New("validation did not pass: fully_completed is false")
-		runOut, retryErr := runRetryLoop(node, opts, &out, []string{FormatValidationCritique(valRes.Response)})
+		out.critique(FormatValidationCritique(valRes.Response))
+		runOut, retryErr := runRetryLoop(node, opts, out, []string{FormatValidationCritique(valRes.Response)})
 		if retryErr != nil {
 			return runOut, retryErr
 		}
 		return runOut, nil
 	}
-	return out, nil
+	return *out, nil
 }
 
 // RunRetry runs the node with a custom retry prompt using the retry CLI. Caller must verify response type and run validation.
@@ -385,18 +760,7 @@ func RunRetry(node *types.ProcessedNode, opts RunOptions, retryPrompt string) (r
 	if err != nil {
 		return runner.Result{}, err
 	}
-	command := BuildCommand(cli, retryPrompt)
-	shell, shellArgs := runner.DefaultShell()
-	res, err := runShell(runner.CommandSpec{
-		Shell:     shell,
-		ShellArgs: shellArgs,
-		Command:   command,
-		WorkDir:   opts.WorkDir,
-	})
-	if err == nil {
-		appendLongLog(opts.LogLongWriter, res.Stdout)
-	}
-	return res, err
+	return runCLI(node, PhaseRetry, cli, ModelFor(node, cli, opts), retryPrompt, opts)
 }
 
 // runRetryLoop runs retries until validation passes or EffectiveRetryLimit is reached. Mutates node.Retried and out.
@@ -404,32 +768,92 @@ func runRetryLoop(node *types.ProcessedNode, opts RunOptions, out *NodeResult, c
 	limit := EffectiveRetryLimit(node)
 	for node.Retried < limit {
 		node.Retried++
+		if opts.snapshot != nil && opts.Git.ResetOnRetry {
+			if err := opts.Git.Repo.Reset(*opts.snapshot); err != nil {
+				out.ValidationError = err
+				return *out, fmt.Errorf("git reset before retry: %w", err)
+			}
+		}
 		retryPrompt := BuildRetryPrompt(node, critiques)
 		if retryPrompt == "" {
 			return *out, errors.New("retry prompt is empty")
 		}
+		scan, err := startGuard(node, opts)
+		if err != nil {
+			out.ValidationError = err
+			return *out, err
+		}
 		runRes, err := RunRetry(node, opts, retryPrompt)
 		if err != nil {
 			out.ValidationError = err
 			return *out, err
 		}
-		if err := VerifyRunOutput(node, runRes.Stdout); err != nil {
+		pathViolations, err := finishGuard(node, opts, scan, out)
+		if err != nil {
+			out.ValidationError = err
+			return *out, err
+		}
+		if err := recordAttemptDiff(opts, out); err != nil {
+			out.ValidationError = err
+			return *out, err
+		}
+		if len(pathViolations) > 0 {
+			out.RunResult = runRes
+			out.Output = nil
+			out.ValidationError = pathViolationError(pathViolations)
+			critiques = append(critiques, FormatPathCritique(pathViolations))
+			out.critique(critiques[len(critiques)-1])
+			continue
+		}
+		// With an output schema, an unparsable response is a schema violation (CheckOutput).
+		if !HasOutputSchema(node) {
+			if err := VerifyRunOutput(node, runRes.Stdout); err != nil {
+				out.ValidationError = err
+				return *out, err
+			}
+		}
+		out.RunResult = runRes
+		output, violations, err := CheckOutput(node, runRes.Stdout)
+		if err != nil {
 			out.ValidationError = err
 			return *out, err
 		}
+		if len(violations) > 0 {
+			out.Output = nil
+			out.ValidationError = fmt.Errorf("%w: %s", ErrOutputSchema, strings.Join(violations, "; "))
+			critiques = append(critiques, FormatSchemaCritique(violations))
+			out.critique(critiques[len(critiques)-1])
+			continue
+		}
+		out.Output = output
+		if !ShouldValidate(node) {
+			out.Valid = true
+			out.ValidationError = nil
+			return *out, nil
+		}
+		out.ValidationRan = true
 		valRes, err := RunValidation(node, opts, runRes.Stdout)
 		if err != nil {
 			out.ValidationError = err
 			return *out, err
 		}
-		out.RunResult = runRes
 		out.Validation = &valRes
 		if valRes.Valid {
 			out.Valid = true
 			out.ValidationError = nil
 			return *out, nil
 		}
+		out.ValidationError = errors.New("validation did not pass: fully_completed is false")
 		critiques = append(critiques, FormatValidationCritique(valRes.Response))
+		out.critique(critiques[len(critiques)-1])
+	}
+	if errors.Is(out.ValidationError, ErrOutputSchema) {
+		out.ValidationError = fmt.Errorf("%w: max retries reached", ErrOutputSchema)
+		return *out, nil
+	}
+	if errors.Is(out.ValidationError, ErrPathViolation) {
+		out.ValidationError = fmt.Errorf("%w: max retries reached", ErrPathViolation)
+		return *out, nil
 	}
 	out.ValidationError = errors.New("validation did not pass: max retries reached")
 	return *out, nil
@@ -1,6 +1,8 @@
 package run
 
 import (
+	"io"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -109,18 +111,31 @@ func TestBuildRunPrompt(t *testing.T) {
 	})
 }
 
+func TestPreamble(t *testing.T) {
+	node := &types.ProcessedNode{Preamble: "Repo rules.", Prompt: "Do it", ValidatePrompt: "Done?"}
+	if got := BuildRunPrompt(node); !strings.HasPrefix(got, "Repo rules.\n\nDo it\n\n") {
+		t.Errorf("BuildRunPrompt = %q", got)
+	}
+	if got := BuildRetryPrompt(node, []string{"try again"}); !strings.HasPrefix(got, "Repo rules.\n\nDo it") {
+		t.Errorf("BuildRetryPrompt = %q", got)
+	}
+	if got := BuildValidatePrompt(node, "out"); !strings.HasPrefix(got, "Repo rules.\n\nDone?") {
+		t.Errorf("BuildValidatePrompt = %q", got)
+	}
+}
+
 func TestBuildCommand(t *testing.T) {
 	cli := types.CLI{Prompt: "agent \"<prompt>\""}
 	got := BuildCommand(cli, "hello world")
-	want := `agent "hello world"`
+	want := `agent 'hello world'`
 	if got != want {
 		t.Errorf("BuildCommand = %q, want %q", got, want)
 	}
-	// Escaping
+	// Quoting: nothing in the prompt is shell syntax
 	cli2 := types.CLI{Prompt: "cmd \"<prompt>\""}
-	got2 := BuildCommand(cli2, `say "hi"`)
-	want2 := `cmd "say \"hi\""`
-	if got2 != want2 {
+	got2 := BuildCommand(cli2, "say \"hi\", it's `id` $(id) $HOME")
+	want2 := `cmd 'say "hi", it'\''s ` + "`id`" + ` $(id) $HOME'`
+	if runtime.GOOS != "windows" && got2 != want2 {
 		t.Errorf("BuildCommand(quoted) = %q, want %q", got2, want2)
 	}
 	// Gemini CLI template includes --yolo and prompt
@@ -137,6 +152,34 @@ func TestBuildCommand(t *testing.T) {
 	}
 }
 
+func TestBuildCommandWithModel(t *testing.T) {
+	cli := types.CLI{Command: "agent", Prompt: "agent -p \"<prompt>\"", ModelFlag: "--model"}
+	if got, want := BuildCommandWithModel(cli, "haiku", "hi"), `agent --model 'haiku' -p 'hi'`; got != want {
+		t.Errorf("BuildCommandWithModel = %q, want %q", got, want)
+	}
+	if got, want := BuildCommandWithModel(cli, "", "hi"), `agent -p 'hi'`; got != want {
+		t.Errorf("BuildCommandWithModel(no model) = %q, want %q", got, want)
+	}
+	noFlag := types.CLI{Command: "agent", Prompt: "agent \"<prompt>\""}
+	if got, want := BuildCommandWithModel(noFlag, "haiku", "hi"), `agent 'hi'`; got != want {
+		t.Errorf("BuildCommandWithModel(no flag) = %q, want %q", got, want)
+	}
+}
+
+func TestModelFor(t *testing.T) {
+	opts := RunOptions{DefaultCLI: "CLAUDE", DefaultModels: map[string]string{"CLAUDE": "sonnet", "GEMINI": "gemini-2.5-flash"}}
+	node := &types.ProcessedNode{Model: "haiku"}
+	if got := ModelFor(node, types.ClaudeCLI, opts); got != "haiku" {
+		t.Errorf("ModelFor(own CLI) = %q, want haiku", got)
+	}
+	if got := ModelFor(node, types.GeminiCLI, opts); got != "gemini-2.5-flash" {
+		t.Errorf("ModelFor(other CLI) = %q, want gemini-2.5-flash (default model)", got)
+	}
+	if got := ModelFor(&types.ProcessedNode{}, types.ClaudeCLI, opts); got != "sonnet" {
+		t.Errorf("ModelFor(no node model) = %q, want sonnet", got)
+	}
+}
+
 func TestProcessResponseInstructionForKind(t *testing.T) {
 	p := ProcessResponseInstructionForKind(ResponseKindProcess)
 	if !strings.Contains(p, "completed") {
@@ -520,3 +563,87 @@ func TestRunNodeThenValidate_RetryOnExplicitFailPrompt(t *testing.T) {
 	}
 	t.Logf("verified: retry prompt contained validation fail feedback and response-type instruction")
 }
+
+func TestRunNode_NativeOutput(t *testing.T) {
+	var command string
+	SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+		command = spec.Command
+		stdout := `{"type":"result","result":"{\"completed\": true}","session_id":"abc","total_cost_usd":0.5,"usage":{"input_tokens":1,"output_tokens":2}}`
+		return runner.Result{Stdout: stdout, Success: true}, nil
+	})
+	defer SetShellRunner(nil)
+
+	node := &types.ProcessedNode{Prompt: "P", CLI: "CLAUDE"}
+	res, err := RunNode(node, RunOptions{NativeOutput: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(command, "--output-format json") {
+		t.Errorf("command = %q, want native output flag", command)
+	}
+	if res.Stdout != `{"completed": true}` || res.SessionID != "abc" || res.CostUSD != 0.5 || res.OutputTokens != 2 {
+		t.Errorf("RunNode result = %+v", res)
+	}
+	if err := VerifyRunOutput(node, res.Stdout); err != nil {
+		t.Errorf("VerifyRunOutput(unwrapped) = %v", err)
+	}
+}
+
+func TestRunNodeThenValidate_NativeErrorResultFails(t *testing.T) {
+	calls := 0
+	SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+		calls++
+		return runner.Result{Stdout: `{"type":"result","is_error":true,"result":"rate limited"}`, Success: true}, nil
+	})
+	defer SetShellRunner(nil)
+
+	node := &types.ProcessedNode{Name: "Build", Prompt: "P", CLI: "CLAUDE", ValidatePrompt: "Done?", ValidateCLI: "CLAUDE"}
+	res, err := RunNodeThenValidate(node, RunOptions{NativeOutput: true})
+	if err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Errorf("RunNodeThenValidate err = %v, want the error result", err)
+	}
+	if res.Valid || calls != 1 {
+		t.Errorf("Valid = %v, calls = %d; want the node failed without validation", res.Valid, calls)
+	}
+	if len(res.Attempts) != 1 || !strings.Contains(res.Attempts[0].Error, "rate limited") {
+		t.Errorf("attempts = %+v", res.Attempts)
+	}
+}
+
+func TestRunValidation_TruncatesLongOutput(t *testing.T) {
+	var command string
+	SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+		command = spec.Command
+		return runner.Result{Stdout: `{"fully_completed": true, "warnings": []}`, Success: true}, nil
+	})
+	defer SetShellRunner(nil)
+
+	node := &types.ProcessedNode{Name: "Build", Prompt: "Build it", ValidatePrompt: "Done?", ValidateCLI: "CLAUDE"}
+	output := "HEAD" + strings.Repeat("x", 1000) + "TAIL"
+	if _, err := RunValidation(node, RunOptions{MaxPromptOutput: 100}, output); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(command, "HEAD") || !strings.Contains(command, "TAIL") || !strings.Contains(command, "908 bytes omitted") {
+		t.Errorf("validation prompt does not embed the head and tail of the output: %q", command)
+	}
+}
+
+// TestBuildCommand_varsAreNotShellSource verifies that shell syntax in a --var value reaches the
+// agent verbatim instead of running or expanding.
+func TestBuildCommand_varsAreNotShellSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses /bin/sh")
+	}
+	value := "`echo PWNED` $(echo PWNED) $HOME it's"
+	node := types.NodeToProcessedNodeWithDefaults(&types.Node{Text: "Fix {{vars.ticket}}"},
+		&types.ProcessedNodeDefaults{Vars: map[string]string{"ticket": value}})
+	shell, args := runner.DefaultShell()
+	cli := types.CLI{Command: "printf", Prompt: "printf %s \"<prompt>\""}
+	res, err := runner.RunShellCommand(runner.CommandSpec{Shell: shell, ShellArgs: args, Command: BuildCommand(cli, node.Prompt), Stdout: io.Discard, Stderr: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stdout != "Fix "+value {
+		t.Errorf("stdout = %q, want the value verbatim", res.Stdout)
+	}
+}
@@ -0,0 +1,176 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// ErrBudgetExceeded is returned before an agent invocation when the run budget (MAX_RUN_COST,
+// MAX_RUN_TOKENS) or the node's max_calls has been used up.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Usage totals agent invocations, tokens, and cost. Tokens and cost are only known for
+// CLIs that report them (native output mode) or that have a price in the PriceTable.
+type Usage struct {
+	Calls        int     `json:"calls"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+// Add adds o to u.
+func (u *Usage) Add(o Usage) {
+	u.Calls += o.Calls
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.CostUSD += o.CostUSD
+}
+
+// Tokens returns input plus output tokens.
+func (u Usage) Tokens() int {
+	return u.InputTokens + u.OutputTokens
+}
+
+// String formats u for console output.
+func (u Usage) String() string {
+	return fmt.Sprintf("%d call(s), %d input + %d output tokens, $%.4f", u.Calls, u.InputTokens, u.OutputTokens, u.CostUSD)
+}
+
+// UsageOf returns the usage of a single agent invocation.
+func UsageOf(res runner.Result) Usage {
+	return Usage{Calls: 1, InputTokens: res.InputTokens, OutputTokens: res.OutputTokens, CostUSD: res.CostUSD}
+}
+
+// Price is the USD cost per million input and output tokens for a CLI.
+type Price struct {
+	InputPerMTok  float64
+	OutputPerMTok float64
+}
+
+// PriceTable maps CLI codename (uppercase) to its Price. Used to estimate cost when the
+// CLI reports tokens but not cost.
+type PriceTable map[string]Price
+
+// ParsePrice parses a PRICE_<CODENAME> setting: "input,output" in USD per million tokens (e.g. "3,15").
+func ParsePrice(s string) (Price, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return Price{}, fmt.Errorf("invalid price %q: want \"input,output\" USD per million tokens", s)
+	}
+	in, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return Price{}, fmt.Errorf("invalid price %q: %w", s, err)
+	}
+	out, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return Price{}, fmt.Errorf("invalid price %q: %w", s, err)
+	}
+	if in < 0 || out < 0 {
+		return Price{}, fmt.Errorf("invalid price %q: must not be negative", s)
+	}
+	return Price{InputPerMTok: in, OutputPerMTok: out}, nil
+}
+
+// Cost returns the estimated cost of the given token counts for codename, or 0 when it has no price.
+func (p PriceTable) Cost(codename string, inputTokens, outputTokens int) float64 {
+	price, ok := p[strings.ToUpper(strings.TrimSpace(codename))]
+	if !ok {
+		return 0
+	}
+	return (float64(inputTokens)*price.InputPerMTok + float64(outputTokens)*price.OutputPerMTok) / 1e6
+}
+
+// Budget limits the total usage of a run. Zero values mean unlimited.
+type Budget struct {
+	MaxCostUSD float64 // MAX_RUN_COST
+	MaxTokens  int     // MAX_RUN_TOKENS
+}
+
+// Ledger accumulates usage across every invocation of a run and enforces the Budget.
+// Set RunOptions.Ledger to share one Ledger between nodes. A nil *Ledger records nothing.
+type Ledger struct {
+	Budget Budget
+	Prices PriceTable
+	Total  Usage
+	ByCLI  map[string]Usage
+}
+
+// NewLedger returns a Ledger with the given budget and price table.
+func NewLedger(budget Budget, prices PriceTable) *Ledger {
+	return &Ledger{Budget: budget, Prices: prices, ByCLI: make(map[string]Usage)}
+}
+
+// Check returns an error wrapping ErrBudgetExceeded when the run budget is used up.
+func (l *Ledger) Check() error {
+	if l == nil {
+		return nil
+	}
+	if l.Budget.MaxCostUSD > 0 && l.Total.CostUSD >= l.Budget.MaxCostUSD {
+		return fmt.Errorf("%w: run cost $%.4f reached MAX_RUN_COST $%.4f", ErrBudgetExceeded, l.Total.CostUSD, l.Budget.MaxCostUSD)
+	}
+	if l.Budget.MaxTokens > 0 && l.Total.Tokens() >= l.Budget.MaxTokens {
+		return fmt.Errorf("%w: run tokens %d reached MAX_RUN_TOKENS %d", ErrBudgetExceeded, l.Total.Tokens(), l.Budget.MaxTokens)
+	}
+	return nil
+}
+
+// Record adds one invocation by the given CLI. When the CLI did not report a cost, it is
+// estimated from the price table and written back to res.CostUSD.
+func (l *Ledger) Record(codename string, res *runner.Result) {
+	if l == nil {
+		return
+	}
+	if res.CostUSD == 0 {
+		res.CostUSD = l.Prices.Cost(codename, res.InputTokens, res.OutputTokens)
+	}
+	u := UsageOf(*res)
+	l.Total.Add(u)
+	if l.ByCLI == nil {
+		l.ByCLI = make(map[string]Usage)
+	}
+	byCLI := l.ByCLI[codename]
+	byCLI.Add(u)
+	l.ByCLI[codename] = byCLI
+}
+
+// checkNodeCalls returns an error wrapping ErrBudgetExceeded when the node has used its max_calls.
+func checkNodeCalls(node *types.ProcessedNode, used Usage) error {
+	if node == nil || node.MaxCalls <= 0 || used.Calls < node.MaxCalls {
+		return nil
+	}
+	return fmt.Errorf("%w: node %q reached max_calls %d", ErrBudgetExceeded, node.Name, node.MaxCalls)
+}
+
+// canRetry reports whether anything can send the node back for a retry: validation, an output
+// schema, or path guardrails from guard or the node.
+func canRetry(node *types.ProcessedNode, guard *PathGuard) bool {
+	allowed, protected := guardRules(node, guard)
+	return ShouldValidate(node) || HasOutputSchema(node) || len(allowed)+len(protected) > 0
+}
+
+// WorstCaseCalls returns the most agent invocations the node can make: its run and validation,
+// plus EffectiveRetryLimit retries (each validated again) when canRetry. max_calls caps the total;
+// approval and Human nodes make none.
+func WorstCaseCalls(node *types.ProcessedNode, guard *PathGuard) int {
+	if node == nil || node.Approval || node.Human {
+		return 0
+	}
+	perAttempt := 1
+	if ShouldValidate(node) {
+		perAttempt++
+	}
+	attempts := 1
+	if canRetry(node, guard) {
+		attempts += EffectiveRetryLimit(node)
+	}
+	calls := perAttempt * attempts
+	if node.MaxCalls > 0 && calls > node.MaxCalls {
+		calls = node.MaxCalls
+	}
+	return calls
+}
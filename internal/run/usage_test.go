@@ -0,0 +1,107 @@
+package run
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func TestParsePrice(t *testing.T) {
+	p, err := ParsePrice(" 3, 15 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.InputPerMTok != 3 || p.OutputPerMTok != 15 {
+		t.Errorf("ParsePrice = %+v", p)
+	}
+	for _, bad := range []string{"3", "a,b", "-1,2"} {
+		if _, err := ParsePrice(bad); err == nil {
+			t.Errorf("ParsePrice(%q) want error", bad)
+		}
+	}
+}
+
+func TestLedger(t *testing.T) {
+	l := NewLedger(Budget{MaxTokens: 1500}, PriceTable{"GEMINI": {InputPerMTok: 1, OutputPerMTok: 10}})
+	if err := l.Check(); err != nil {
+		t.Fatalf("Check(empty) = %v", err)
+	}
+	res := runner.Result{InputTokens: 1000, OutputTokens: 100}
+	l.Record("GEMINI", &res)
+	if math.Abs(res.CostUSD-0.002) > 1e-9 {
+		t.Errorf("estimated CostUSD = %v, want 0.002", res.CostUSD)
+	}
+	reported := runner.Result{InputTokens: 300, OutputTokens: 100, CostUSD: 0.5}
+	l.Record("CLAUDE", &reported)
+	if reported.CostUSD != 0.5 {
+		t.Errorf("reported CostUSD overwritten: %v", reported.CostUSD)
+	}
+	if l.Total.Calls != 2 || l.Total.Tokens() != 1500 || l.ByCLI["CLAUDE"].Calls != 1 {
+		t.Errorf("ledger = %+v", l)
+	}
+	if err := l.Check(); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Check(over tokens) = %v, want ErrBudgetExceeded", err)
+	}
+	var nilLedger *Ledger
+	nilLedger.Record("GEMINI", &res)
+	if err := nilLedger.Check(); err != nil {
+		t.Errorf("nil Ledger Check = %v", err)
+	}
+}
+
+func TestRunNodeThenValidate_UsageAndMaxCalls(t *testing.T) {
+	processOut := `{"completed": true, "secs_taken": 0, "tokens_used": 0, "comments": []}`
+	validateFail := `{"fully_completed": false, "partially_completed": true, "should_retry": true, "warnings": ["no"]}`
+	calls := 0
+	SetShellRunner(func(spec runner.CommandSpec) (runner.Result, error) {
+		calls++
+		stdout := processOut
+		if calls%2 == 0 {
+			stdout = validateFail
+		}
+		return runner.Result{Stdout: stdout, Success: true, InputTokens: 10, OutputTokens: 5, CostUSD: 0.01}, nil
+	})
+	defer SetShellRunner(nil)
+
+	node := &types.ProcessedNode{Name: "Step", Prompt: "P", ValidatePrompt: "V", Retries: 5, MaxCalls: 3}
+	ledger := NewLedger(Budget{}, nil)
+	opts := RunOptions{DefaultCLI: "CURSOR", DefaultValidateCLI: "CURSOR", DefaultRetryCLI: "CURSOR", Ledger: ledger}
+	res, err := RunNodeThenValidate(node, opts)
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("err = %v, want ErrBudgetExceeded from max_calls", err)
+	}
+	if calls != 3 {
+		t.Errorf("shell calls = %d, want 3 (max_calls)", calls)
+	}
+	if res.Usage.Calls != 3 || res.Usage.InputTokens != 30 || math.Abs(res.Usage.CostUSD-0.03) > 1e-9 {
+		t.Errorf("node Usage = %+v", res.Usage)
+	}
+	if ledger.Total.Calls != 3 {
+		t.Errorf("ledger Total = %+v", ledger.Total)
+	}
+}
+
+func TestWorstCaseCalls(t *testing.T) {
+	tests := []struct {
+		name  string
+		node  *types.ProcessedNode
+		guard *PathGuard
+		want  int
+	}{
+		{"no validation", &types.ProcessedNode{Name: "a"}, nil, 1},
+		{"validated, 2 retries", &types.ProcessedNode{Name: "a", ValidatePrompt: "ok?", Retries: 2}, nil, 6},
+		{"validated, default retries", &types.ProcessedNode{Name: "a", ValidatePrompt: "ok?"}, nil, 8},
+		{"output schema", &types.ProcessedNode{Name: "a", OutputSchema: `{"type":"object"}`, Retries: 1}, nil, 2},
+		{"guarded", &types.ProcessedNode{Name: "a", Retries: 1}, &PathGuard{ProtectedPaths: []string{"go.mod"}}, 2},
+		{"max_calls", &types.ProcessedNode{Name: "a", ValidatePrompt: "ok?", MaxCalls: 3}, nil, 3},
+		{"approval", &types.ProcessedNode{Name: "a", Approval: true}, nil, 0},
+	}
+	for _, tt := range tests {
+		if got := WorstCaseCalls(tt.node, tt.guard); got != tt.want {
+			t.Errorf("%s: WorstCaseCalls = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
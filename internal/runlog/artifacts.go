@@ -0,0 +1,226 @@
+package runlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/history"
+	"github.com/ryanmontgomery/MonadsCLI/internal/redact"
+	"github.com/ryanmontgomery/MonadsCLI/internal/run"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// Files of a run directory (NewRunDir). TreeRunLogger.Write writes all but the manifest.
+const (
+	ManifestFile = "manifest.json"
+	ShortLogFile = "short.json"
+	LongLogFile  = "long.log"
+	StateFile    = "state.json"
+	AttemptsDir  = "attempts" // One folder per node attempt (AttemptDir).
+	OutputDir    = "output"   // Spilled agent output (runner.CaptureOptions.SpillDir).
+)
+
+// Files of an attempt folder.
+const (
+	PromptFile     = "prompt.txt"
+	StdoutFile     = "stdout.txt"
+	StderrFile     = "stderr.txt"
+	DiffFile       = "diff.patch"      // Worktree changes since the node started (git checkpoints).
+	ValidationFile = "validation.json" // The attempt's validation: prompt, response, and parsed result.
+	AttemptFile    = "attempt.json"    // CLI, model, exit code, duration, error, and critique.
+)
+
+// ManifestSchemaVersion is the schema_version of manifest.json.
+const ManifestSchemaVersion = 1
+
+// NewRunDir creates the directory of a run started at start: run_<time> under logDir (relative to
+// workDir), with a -2, -3, ... suffix when it exists. It returns the path relative to workDir when
+// logDir is relative.
+func NewRunDir(workDir, logDir string, start time.Time) (string, error) {
+	if err := os.MkdirAll(filepath.Join(workDir, logDir), 0o755); err != nil {
+		return "", err
+	}
+	base := "run_" + start.Format("20060102_150405")
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		dir := filepath.Join(logDir, name)
+		err := os.Mkdir(filepath.Join(workDir, dir), 0o755)
+		if err == nil {
+			return dir, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+	}
+}
+
+// AttemptDir returns the folder of a node attempt, relative to the run directory: the node's
+// position in the run (from 1), its name, and the attempt number (0 for the first run).
+func AttemptDir(position int, node string, attempt int) string {
+	return filepath.Join(AttemptsDir, fmt.Sprintf("%02d-%s-%d", position, run.FileSlug(node), attempt))
+}
+
+// Manifest describes a run directory (manifest.json) so the folder can be read on its own, e.g.
+// as a CI artifact.
+type Manifest struct {
+	SchemaVersion int               `json:"schema_version"`
+	Document      history.Document  `json:"document"`
+	Started       time.Time         `json:"started"`
+	Ended         time.Time         `json:"ended"`
+	DurationMs    int64             `json:"duration_ms"`
+	Status        string            `json:"status"`    // history.StatusPassed, StatusFailed, StatusError, or StatusInterrupted.
+	ExitCode      int               `json:"exit_code"` // Exit status of run-tree.
+	Error         string            `json:"error,omitempty"`
+	Settings      map[string]string `json:"settings"` // Effective settings, without secrets.
+	CLIs          map[string]string `json:"clis"`     // Version of each CLI the run used, by codename; "" when unknown.
+	Usage         run.Usage         `json:"usage"`
+	Nodes         []ManifestNode    `json:"nodes"`
+	Files         []string          `json:"files"` // Files of the run directory besides the attempts, e.g. short.json.
+}
+
+// ManifestNode is one executed node of a Manifest.
+type ManifestNode struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Valid    bool     `json:"valid"`
+	Retries  int      `json:"retries"`
+	Attempts []string `json:"attempts"` // Attempt folders (AttemptDir), in order.
+}
+
+// NewManifest returns the manifest of a finished run from its history record and the short log
+// entries of its nodes (in the same order). Settings, CLIs, and ExitCode are left to the caller.
+func NewManifest(r history.Run, entries []ShortEntry) Manifest {
+	m := Manifest{
+		SchemaVersion: ManifestSchemaVersion,
+		Document:      r.Document,
+		Started:       r.Started,
+		Ended:         r.Started.Add(time.Duration(r.DurationMs) * time.Millisecond),
+		DurationMs:    r.DurationMs,
+		Status:        r.Status,
+		Error:         r.Error,
+		Usage:         r.Usage,
+		Nodes:         make([]ManifestNode, 0, len(entries)),
+	}
+	for i, e := range entries {
+		n := ManifestNode{Name: e.NodeName, Type: e.NodeType, Attempts: []string{}}
+		if i < len(r.Nodes) {
+			n.Valid = r.Nodes[i].Valid
+		}
+		if e.Retries != nil {
+			n.Retries = e.Retries.Count
+		}
+		for _, a := range attemptNumbers(e) {
+			n.Attempts = append(n.Attempts, filepath.ToSlash(AttemptDir(i+1, e.NodeName, a)))
+		}
+		m.Nodes = append(m.Nodes, n)
+	}
+	return m
+}
+
+// WriteManifest writes m to manifest.json in dir, listing the files present, redacted with r.
+func WriteManifest(dir string, m Manifest, r *redact.Redactor) error {
+	m.Files = []string{}
+	for _, name := range []string{ShortLogFile, LongLogFile, StateFile, OutputDir} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			m.Files = append(m.Files, name)
+		}
+	}
+	payload, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestFile), r.Bytes(payload), 0o644)
+}
+
+// attemptNumbers returns the attempt numbers of a node in order; a node without agent
+// invocations (approval, Human) has the single attempt 0.
+func attemptNumbers(e ShortEntry) []int {
+	nums := []int{0}
+	for _, a := range e.Attempts {
+		if a.Phase == run.PhaseRetry {
+			nums = append(nums, a.Attempt)
+		}
+	}
+	return nums
+}
+
+// validationFile is the content of validation.json.
+type validationFile struct {
+	run.Attempt
+	Result *types.ValidationResponse `json:"result,omitempty"` // The parsed response; absent when it did not parse.
+}
+
+// attemptFile is the content of attempt.json: the attempt without the text kept in files.
+type attemptFile struct {
+	Phase      string `json:"phase"`
+	Attempt    int    `json:"attempt"`
+	CLI        string `json:"cli"`
+	Model      string `json:"model,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	Critique   string `json:"critique,omitempty"`
+}
+
+// writeAttempts writes a folder per node attempt under dir/attempts, redacted. A node without
+// agent invocations gets one folder with its response (e.g. the approval answer) as stdout.
+func (l *TreeRunLogger) writeAttempts(dir string) error {
+	for i, e := range l.shortEnts {
+		if len(e.Attempts) == 0 {
+			if err := l.writeFiles(filepath.Join(dir, AttemptDir(i+1, e.NodeName, 0)), map[string]string{StdoutFile: e.Response}); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, a := range e.Attempts {
+			files := map[string]string{}
+			if a.Phase == run.PhaseValidate {
+				v := validationFile{Attempt: a}
+				if parsed, err := types.ParseValidationResponse(a.Response); err == nil {
+					v.Result = &parsed
+				}
+				payload, err := json.MarshalIndent(v, "", "  ")
+				if err != nil {
+					return err
+				}
+				files[ValidationFile] = string(payload)
+			} else {
+				payload, err := json.MarshalIndent(attemptFile{Phase: a.Phase, Attempt: a.Attempt, CLI: a.CLI, Model: a.Model,
+					ExitCode: a.ExitCode, DurationMs: a.DurationMs, Error: a.Error, Critique: a.Critique}, "", "  ")
+				if err != nil {
+					return err
+				}
+				files[AttemptFile] = string(payload)
+				files[PromptFile] = a.Prompt
+				files[StdoutFile] = a.Response
+				files[StderrFile] = a.Stderr
+				if a.Diff != "" {
+					files[DiffFile] = a.Diff
+				}
+			}
+			if err := l.writeFiles(filepath.Join(dir, AttemptDir(i+1, e.NodeName, a.Attempt)), files); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *TreeRunLogger) writeFiles(dir string, files map[string]string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(l.Redactor.String(content)), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
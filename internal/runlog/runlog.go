@@ -3,15 +3,23 @@ package runlog
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
+	"github.com/ryanmontgomery/MonadsCLI/internal/redact"
 	"github.com/ryanmontgomery/MonadsCLI/internal/run"
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
 	"github.com/ryanmontgomery/MonadsCLI/types"
 )
 
+// ShortLogSchemaVersion is the schema_version of the short logs written by TreeRunLogger. Version 2
+// added attempts and decision; logs without schema_version are version 1. The JSON Schema is
+// published as schemas.ShortLog (schemas/short-log.schema.json).
+const ShortLogSchemaVersion = 2
+
 // ShortEntry is one node's response with validation and retries as child properties.
 type ShortEntry struct {
 	NodeName   string                     `json:"node_name"`
@@ -19,6 +27,28 @@ type ShortEntry struct {
 	Response   string                     `json:"response"`
 	Validation *types.ValidationResponse  `json:"validation,omitempty"`
 	Retries    *RetriesInfo               `json:"retries,omitempty"`
+	Output     json.RawMessage            `json:"output,omitempty"`
+	Usage      *run.Usage                 `json:"usage,omitempty"`
+
+	Diff   string `json:"diff,omitempty"`   // Worktree changes made by the node (git checkpoints).
+	Commit string `json:"commit,omitempty"` // Commit created after the node passed (GIT_COMMIT).
+
+	PathViolations []run.PathViolation `json:"path_violations,omitempty"` // Guardrail violations of every attempt.
+	Env            []run.EnvAudit      `json:"env,omitempty"`             // Variables each invocation received (run-tree --audit-env).
+	Interrupted    bool                `json:"interrupted,omitempty"`     // The run was interrupted while this node ran.
+	Resumed        bool                `json:"resumed,omitempty"`         // Replayed from the resume state (run-tree --resume); no agent ran.
+
+	Attempts []run.Attempt `json:"attempts,omitempty"` // Every agent invocation of the node, in order.
+	Decision *Decision     `json:"decision,omitempty"` // The route a decision node took and why.
+}
+
+// Decision is the answer of a decision node (agent or Human) and the route it selected.
+type Decision struct {
+	Choices []string `json:"choices,omitempty"`
+	Answer  string   `json:"answer"`
+	Route   string   `json:"route"`   // Route followed; empty when the answer matched none.
+	Matched bool     `json:"matched"` // The answer selected a route.
+	Reasons []string `json:"reasons,omitempty"`
 }
 
 // RetriesInfo is the retries child object in the short log.
@@ -26,9 +56,17 @@ type RetriesInfo struct {
 	Count int `json:"count"`
 }
 
+// UsageSummary is the run-wide usage breakdown in the short log.
+type UsageSummary struct {
+	Total run.Usage            `json:"total"`
+	ByCLI map[string]run.Usage `json:"by_cli,omitempty"`
+}
+
 type shortLogBody struct {
-	Chart string       `json:"chart"`
-	Nodes []ShortEntry `json:"nodes"`
+	SchemaVersion int           `json:"schema_version"`
+	Chart         string        `json:"chart"`
+	Nodes         []ShortEntry  `json:"nodes"`
+	Usage         *UsageSummary `json:"usage,omitempty"`
 }
 
 // TreeRunLogger accumulates long output and short entries for a tree run. Safe for single-run use; call Write once.
@@ -37,28 +75,49 @@ type TreeRunLogger struct {
 	LogDir     string
 	WriteShort bool
 	WriteLong  bool
-	longBuf    bytes.Buffer
+	Ledger     *run.Ledger      // when set, its totals are written to the short log
+	Redactor   *redact.Redactor // when set, masks secrets in both logs before they are written
+	State      RunState         // completed nodes; written as a resume state when State.Interrupted is set
+	StatePath  string           // set by Write when it wrote the resume state
+	long       *runner.Capture
 	shortEnts  []ShortEntry
 }
 
-// NewTreeRunLogger returns a logger that will write to logDir (relative to workDir when Write is called).
+// NewTreeRunLogger returns a logger that will write to logDir, the run's directory (relative to workDir when Write is called).
 func NewTreeRunLogger(chartName, logDir string, writeShort, writeLong bool) *TreeRunLogger {
 	return &TreeRunLogger{
 		ChartName:  chartName,
 		LogDir:     logDir,
 		WriteShort: writeShort,
 		WriteLong:  writeLong,
+		long:       runner.NewCapture("long", runner.CaptureOptions{}),
 		shortEnts:  make([]ShortEntry, 0),
+		State:      RunState{Completed: make([]CompletedNode, 0)},
 	}
 }
 
 // LongWriter returns an io.Writer that captures all LLM stdout for the long log. Set RunOptions.LogLongWriter to it.
-func (l *TreeRunLogger) LongWriter() *bytes.Buffer {
-	return &l.longBuf
+func (l *TreeRunLogger) LongWriter() io.Writer {
+	return l.long
+}
+
+// SetLongCapture bounds the long log kept in memory: past opts.MaxBytes it is spilled to a temporary
+// file (filtered by opts.Filter, or else the Redactor) and copied into the log by Write. Call before
+// anything is written.
+func (l *TreeRunLogger) SetLongCapture(opts runner.CaptureOptions) {
+	if opts.Filter == nil && l.Redactor != nil {
+		opts.Filter = l.Redactor.Bytes
+	}
+	l.long = runner.NewCapture("long", opts)
 }
 
 // RecordNode appends one node's result to the short log entries.
 func (l *TreeRunLogger) RecordNode(node *types.ProcessedNode, res run.NodeResult) {
+	l.shortEnts = append(l.shortEnts, NewShortEntry(node, res))
+}
+
+// NewShortEntry returns the short log entry for one node's result.
+func NewShortEntry(node *types.ProcessedNode, res run.NodeResult) ShortEntry {
 	ent := ShortEntry{
 		NodeName: "",
 		NodeType: run.ResponseKind(node),
@@ -71,60 +130,208 @@ func (l *TreeRunLogger) RecordNode(node *types.ProcessedNode, res run.NodeResult
 	if res.Validation != nil {
 		ent.Validation = &res.Validation.Response
 	}
-	l.shortEnts = append(l.shortEnts, ent)
+	ent.Output = res.Output
+	if res.Usage.Calls > 0 {
+		usage := res.Usage
+		ent.Usage = &usage
+	}
+	ent.Diff = res.Diff
+	ent.Commit = res.Commit
+	ent.PathViolations = res.PathViolations
+	ent.Env = res.Env
+	ent.Interrupted = res.Interrupted
+	ent.Resumed = res.Resumed
+	ent.Attempts = res.Attempts
+	if node != nil && !node.Approval && len(node.Children) > 1 {
+		if d, err := types.ParseDecisionResponse(res.RunResult.Stdout); err == nil {
+			ent.Decision = &Decision{Choices: d.Choices, Answer: d.Answer, Reasons: d.Reasons}
+			ent.Decision.Route, ent.Decision.Matched = resolveRoute(node.Children, d.Answer)
+		}
+	}
+	return ent
 }
 
-// Write creates logDir under workDir (if needed), then writes long and/or short log when enabled.
+// Write creates logDir under workDir (if needed), then writes the long and/or short log when
+// enabled (long.log, short.json) with a folder per node attempt (AttemptDir), and the resume state
+// (state.json, see RunState) when the run was interrupted. logDir is the run's own directory
+// (see NewRunDir); files of an earlier Write there are replaced.
 func (l *TreeRunLogger) Write(workDir string) error {
 	absDir := filepath.Join(workDir, l.LogDir)
-	if l.WriteLong || l.WriteShort {
+	interrupted := l.State.Interrupted != ""
+	if l.WriteLong || l.WriteShort || interrupted {
 		if err := os.MkdirAll(absDir, 0o755); err != nil {
 			return err
 		}
 	}
-	ts := time.Now().Format("20060102_150405")
-	if l.WriteLong && (l.ChartName != "" || l.longBuf.Len() > 0) {
-		longPath := filepath.Join(absDir, "run_"+ts+".log")
-		var b bytes.Buffer
-		if l.ChartName != "" {
-			b.WriteString("Chart: ")
-			b.WriteString(l.ChartName)
-			b.WriteString("\n\n")
-		}
-		b.Write(l.longBuf.Bytes())
-		if err := os.WriteFile(longPath, b.Bytes(), 0o644); err != nil {
+	if l.WriteLong && (l.ChartName != "" || l.long.Len() > 0) {
+		if err := l.writeLong(filepath.Join(absDir, LongLogFile)); err != nil {
 			return err
 		}
 	}
 	if l.WriteShort && len(l.shortEnts) > 0 {
-		shortPath := filepath.Join(absDir, "run_"+ts+".json")
-		body := shortLogBody{Chart: l.ChartName, Nodes: l.shortEnts}
+		shortPath := filepath.Join(absDir, ShortLogFile)
+		body := shortLogBody{SchemaVersion: ShortLogSchemaVersion, Chart: l.ChartName, Nodes: l.shortEnts}
+		if l.Ledger != nil {
+			body.Usage = &UsageSummary{Total: l.Ledger.Total, ByCLI: l.Ledger.ByCLI}
+		}
 		payload, err := json.MarshalIndent(body, "", "  ")
 		if err != nil {
 			return err
 		}
-		if err := os.WriteFile(shortPath, payload, 0o644); err != nil {
+		if err := os.WriteFile(shortPath, l.Redactor.Bytes(payload), 0o644); err != nil {
+			return err
+		}
+	}
+	if l.WriteLong || l.WriteShort {
+		if err := l.writeAttempts(absDir); err != nil {
 			return err
 		}
 	}
+	if interrupted {
+		statePath := filepath.Join(absDir, StateFile)
+		l.State.Chart = l.ChartName
+		payload, err := json.MarshalIndent(l.State, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(statePath, l.Redactor.Bytes(payload), 0o644); err != nil {
+			return err
+		}
+		l.StatePath = statePath
+	}
 	return nil
 }
 
+// writeLong writes the chart header and the long log to path, redacted. A spilled long log is
+// copied from its (already filtered) spill file, which is then removed.
+func (l *TreeRunLogger) writeLong(path string) error {
+	var b bytes.Buffer
+	if l.ChartName != "" {
+		b.WriteString("Chart: ")
+		b.WriteString(l.ChartName)
+		b.WriteString("\n\n")
+	}
+	if err := l.long.Close(); err != nil {
+		return err
+	}
+	spill := l.long.SpillPath()
+	if spill == "" {
+		_, _ = l.long.WriteTo(&b)
+		return os.WriteFile(path, l.Redactor.Bytes(b.Bytes()), 0o644)
+	}
+	defer os.Remove(spill)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(l.Redactor.Bytes(b.Bytes())); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := l.long.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 // ExecuteTree runs the tree from root: RunNodeThenValidate per node, records to logger, writes logs when enabled.
-// chartName is the document/chart title for log headers. workDir is the cwd for shell commands and for resolving logDir.
+// Structured outputs (output_schema) of executed nodes are passed to later nodes via ProcessedNode.Inputs.
+// Usage is accumulated in opts.Ledger (created when nil); when the budget is exceeded the run stops with
+// run.ErrBudgetExceeded after writing partial logs. Secrets are masked with opts.Redactor when set.
+// When interrupted (opts.Interrupts) the current node is marked interrupted, partial logs and a resume
+// state are written, and the error wraps run.ErrInterrupted and names the state file.
+// chartName is the document/chart title for log headers. workDir resolves logDir; shell commands run in opts.WorkDir.
 func ExecuteTree(root *types.ProcessedNode, opts run.RunOptions, workDir, logDir, chartName string, writeShort, writeLong bool) error {
+	return executeTree(root, nil, opts, workDir, logDir, chartName, writeShort, writeLong)
+}
+
+// ResumeTree is ExecuteTree for a run resumed from state: the completed nodes are not run again; their
+// recorded responses choose the branches and their outputs are passed on, and the run continues from
+// the interrupted node. The state must come from the same tree.
+func ResumeTree(root *types.ProcessedNode, state *RunState, opts run.RunOptions, workDir, logDir, chartName string, writeShort, writeLong bool) error {
+	return executeTree(root, state, opts, workDir, logDir, chartName, writeShort, writeLong)
+}
+
+func executeTree(root *types.ProcessedNode, resume *RunState, opts run.RunOptions, workDir, logDir, chartName string, writeShort, writeLong bool) error {
 	if root == nil {
 		return nil
 	}
 	logger := NewTreeRunLogger(chartName, logDir, writeShort, writeLong)
+	if opts.Ledger == nil {
+		opts.Ledger = run.NewLedger(run.Budget{}, nil)
+	}
+	logger.Ledger = opts.Ledger
+	logger.Redactor = opts.Redactor
+	logger.SetLongCapture(runner.CaptureOptions{MaxBytes: opts.Capture.MaxBytes})
 	if writeLong {
 		opts.LogLongWriter = logger.LongWriter()
 	}
+	var replay []CompletedNode
+	if resume != nil {
+		replay = resume.Completed
+	}
+	// outputs accumulates structured outputs along the executed path; each node sees those of its predecessors.
+	var outputs []types.NodeOutput
+	// prev and prevRes are the last node run on the path, shown at approval nodes.
+	var prev *types.ProcessedNode
+	var prevRes run.NodeResult
 	var runNode func(*types.ProcessedNode) (run.NodeResult, error)
 	runNode = func(node *types.ProcessedNode) (run.NodeResult, error) {
-		res, err := run.RunNodeThenValidate(node, opts)
-		logger.RecordNode(node, res)
-		if err != nil {
+		node.Inputs = append([]types.NodeOutput(nil), outputs...)
+		var res run.NodeResult
+		if len(replay) > 0 {
+			done := replay[0]
+			if done.Node != node.Name {
+				return res, fmt.Errorf("resume state does not match the tree: expected node %q, got %q", done.Node, node.Name)
+			}
+			replay = replay[1:]
+			res.RunResult.Stdout = done.Response
+			res.Output = done.Output
+			res.Valid, res.ValidationRan, res.Resumed = done.Valid, done.Validated, true
+			node.Retried = done.Retries
+			// Replayed nodes are logged again so the new run directory covers the whole run.
+			logger.RecordNode(node, res)
+			if opts.OnNodeDone != nil {
+				opts.OnNodeDone(node, res)
+			}
+		} else {
+			var err error
+			if node.Approval {
+				res, err = run.RunApproval(node, run.NewApprovalRequest(node, prev, prevRes, opts), opts)
+			} else if node.Human {
+				res, err = run.RunHumanDecision(node, run.NewChoiceRequest(node), opts)
+			} else {
+				res, err = run.RunNodeThenValidate(node, opts)
+			}
+			logger.RecordNode(node, res)
+			if opts.OnNodeDone != nil {
+				opts.OnNodeDone(node, res)
+			}
+			if err != nil {
+				if res.Interrupted {
+					logger.State.Interrupted = node.Name
+				}
+				return res, err
+			}
+		}
+		logger.State.Completed = append(logger.State.Completed, CompletedNode{Node: node.Name, Response: res.RunResult.Stdout, Output: res.Output,
+			Valid: res.Valid, Validated: res.ValidationRan, Retries: node.Retried})
+		if res.Output != nil {
+			outputs = append(outputs, types.NodeOutput{Node: node.Name, Output: res.Output})
+		}
+		prev, prevRes = node, res
+		if node.Approval {
+			// Approval node: approve/edit takes the approved route, reject the rejected one (or aborts).
+			a, err := run.ParseApproval(res.RunResult.Stdout)
+			if err != nil {
+				return res, err
+			}
+			child, err := run.ApprovalChild(node, a)
+			if err != nil || child == nil {
+				return res, err
+			}
+			_, err = runNode(child)
 			return res, err
 		}
 		if len(node.Children) == 0 {
@@ -133,7 +340,7 @@ func ExecuteTree(root *types.ProcessedNode, opts run.RunOptions, workDir, logDir
 		if len(node.Children) == 1 {
 			// Single child: process node; recurse to the only next step (no choice).
 			for _, child := range node.Children {
-				_, err = runNode(child)
+				_, err := runNode(child)
 				return res, err
 			}
 		}
@@ -144,33 +351,47 @@ func ExecuteTree(root *types.ProcessedNode, opts run.RunOptions, workDir, logDir
 		}
 		child := resolveChild(node.Children, d.Answer)
 		if child != nil {
-			_, err = runNode(child)
+			_, err := runNode(child)
 			return res, err
 		}
 		return res, nil
 	}
 	if _, err := runNode(root); err != nil {
 		_ = logger.Write(workDir) // best-effort write partial logs
+		if logger.StatePath != "" {
+			return fmt.Errorf("%w (resume state: %s)", err, logger.StatePath)
+		}
 		return err
 	}
+	if len(replay) > 0 {
+		return fmt.Errorf("resume state does not match the tree: node %q was not reached", replay[0].Node)
+	}
 	return logger.Write(workDir)
 }
 
 // resolveChild picks the next node by answer: exact key, else single child, else case-insensitive match.
 func resolveChild(children map[string]*types.ProcessedNode, answer string) *types.ProcessedNode {
-	if c := children[answer]; c != nil {
-		return c
+	if route, ok := resolveRoute(children, answer); ok {
+		return children[route]
+	}
+	return nil
+}
+
+// resolveRoute returns the route resolveChild follows for answer.
+func resolveRoute(children map[string]*types.ProcessedNode, answer string) (string, bool) {
+	if _, ok := children[answer]; ok {
+		return answer, true
 	}
 	if len(children) == 1 {
-		for _, c := range children {
-			return c
+		for k := range children {
+			return k, true
 		}
 	}
 	answerLower := strings.ToLower(strings.TrimSpace(answer))
-	for k, c := range children {
+	for k := range children {
 		if strings.ToLower(strings.TrimSpace(k)) == answerLower {
-			return c
+			return k, true
 		}
 	}
-	return nil
+	return "", false
 }
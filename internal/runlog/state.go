@@ -0,0 +1,53 @@
+package runlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// RunState is the resumable state of an interrupted run, written to the run directory as
+// state.json. Resuming replays Completed instead of running those nodes again.
+type RunState struct {
+	Chart       string          `json:"chart"`
+	Completed   []CompletedNode `json:"completed"`             // Nodes that finished, in execution order.
+	Interrupted string          `json:"interrupted,omitempty"` // Node that was running when the run stopped.
+}
+
+// CompletedNode is one finished node of a RunState.
+type CompletedNode struct {
+	Node     string          `json:"node"`
+	Response string          `json:"response"`         // Agent response; selects the branch of a decision node on resume.
+	Output   json.RawMessage `json:"output,omitempty"` // Structured output passed to later nodes.
+
+	// Outcome of the node, restored on resume so the resumed run reports it as it was.
+	Valid     bool `json:"valid"`
+	Validated bool `json:"validated,omitempty"`
+	Retries   int  `json:"retries,omitempty"`
+}
+
+// ReadRunState reads a state file written by an interrupted run.
+func ReadRunState(path string) (*RunState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s RunState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("resume state %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// ReadShortLog reads a short log (short.json, or run_<time>.json of older versions) written by TreeRunLogger.Write.
+func ReadShortLog(path string) (chart string, nodes []ShortEntry, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	var body shortLogBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return "", nil, fmt.Errorf("short log %s: %w", path, err)
+	}
+	return body.Chart, body.Nodes, nil
+}
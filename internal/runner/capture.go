@@ -0,0 +1,168 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// CaptureOptions bounds how much of a command's output is kept in memory.
+type CaptureOptions struct {
+	MaxBytes int    // Per stream; <= 0 keeps everything in memory.
+	SpillDir string // Where the full output is written once MaxBytes is exceeded; "" = os.TempDir().
+
+	// Filter, when set, is applied to complete lines before they are written to the spill file
+	// (e.g. secret redaction), so nothing unfiltered reaches disk.
+	Filter func([]byte) []byte
+}
+
+// DefaultCaptureMaxBytes is the in-memory cap used by the CLI when CAPTURE_MAX_BYTES is not set.
+const DefaultCaptureMaxBytes = 1 << 20
+
+// maxPendingLine bounds a line held back for Filter; longer lines are filtered in pieces.
+const maxPendingLine = 64 << 10
+
+// Capture is an io.Writer that keeps output in memory up to MaxBytes. Past that, everything
+// written (including what was in memory) goes to a spill file and memory keeps only the first
+// and last MaxBytes/2 bytes. Call Close when done writing.
+type Capture struct {
+	opts CaptureOptions
+	name string
+
+	buf     []byte // Everything until spilled; the head afterwards.
+	tail    []byte // Last MaxBytes/2 bytes once spilled.
+	total   int64
+	file    *os.File
+	pending []byte // Partial line waiting for Filter.
+	err     error  // Spill failure; output past the head and tail is then lost.
+}
+
+// NewCapture returns a Capture; name (e.g. "stdout") is used in the spill file name.
+func NewCapture(name string, opts CaptureOptions) *Capture {
+	return &Capture{opts: opts, name: name}
+}
+
+func (c *Capture) Write(p []byte) (int, error) {
+	c.total += int64(len(p))
+	if !c.spilled() {
+		if c.opts.MaxBytes <= 0 || len(c.buf)+len(p) <= c.opts.MaxBytes {
+			c.buf = append(c.buf, p...)
+			return len(p), nil
+		}
+		c.spill()
+	}
+	c.writeFile(p)
+	half := c.opts.MaxBytes / 2
+	c.tail = append(c.tail, p...)
+	if len(c.tail) > half {
+		c.tail = append(c.tail[:0], c.tail[len(c.tail)-half:]...)
+	}
+	return len(p), nil
+}
+
+func (c *Capture) spilled() bool {
+	return c.file != nil || c.err != nil
+}
+
+// spill moves the in-memory output to a new spill file and keeps only its head in memory.
+func (c *Capture) spill() {
+	dir := c.opts.SpillDir
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			c.err = err
+		}
+	}
+	if c.err == nil {
+		c.file, c.err = os.CreateTemp(dir, "monads-"+c.name+"-*.log")
+	}
+	c.writeFile(c.buf)
+	half := c.opts.MaxBytes / 2
+	if len(c.buf) > half {
+		c.tail = append([]byte(nil), c.buf[half:]...)
+		c.buf = c.buf[:half]
+	}
+}
+
+func (c *Capture) writeFile(p []byte) {
+	if c.file == nil {
+		return
+	}
+	if c.opts.Filter == nil {
+		_, _ = c.file.Write(p)
+		return
+	}
+	c.pending = append(c.pending, p...)
+	if i := bytes.LastIndexByte(c.pending, '\n'); i >= 0 {
+		_, _ = c.file.Write(c.opts.Filter(c.pending[:i+1]))
+		c.pending = append(c.pending[:0], c.pending[i+1:]...)
+	}
+	if len(c.pending) > maxPendingLine {
+		_, _ = c.file.Write(c.opts.Filter(c.pending))
+		c.pending = c.pending[:0]
+	}
+}
+
+// Close writes any held partial line and closes the spill file.
+func (c *Capture) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	if len(c.pending) > 0 {
+		_, _ = c.file.Write(c.opts.Filter(c.pending))
+		c.pending = nil
+	}
+	return c.file.Close()
+}
+
+// Len is the number of bytes written.
+func (c *Capture) Len() int64 {
+	return c.total
+}
+
+// SpillPath returns the spill file holding the full output, or "" while it fits in memory.
+func (c *Capture) SpillPath() string {
+	if c.file == nil {
+		return ""
+	}
+	return c.file.Name()
+}
+
+// String returns the output: all of it while it fits in memory, otherwise the head and tail
+// around a marker naming the spill file.
+func (c *Capture) String() string {
+	if !c.spilled() {
+		return string(c.buf)
+	}
+	where := "full output in " + c.SpillPath()
+	if c.err != nil {
+		where = "full output not saved: " + c.err.Error()
+	}
+	omitted := c.total - int64(len(c.buf)) - int64(len(c.tail))
+	return string(c.buf) + fmt.Sprintf("\n\n[... %d bytes omitted; %s ...]\n\n", omitted, where) + string(c.tail)
+}
+
+// WriteTo writes the full output to w: the spill file when spilled, otherwise the memory buffer.
+// Call Close first.
+func (c *Capture) WriteTo(w io.Writer) (int64, error) {
+	if c.file == nil {
+		n, err := w.Write(c.buf)
+		return int64(n), err
+	}
+	f, err := os.Open(c.file.Name())
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+// TruncateMiddle returns s when it is at most max bytes (or max <= 0), otherwise its first and
+// last max/2 bytes around a marker giving the number of omitted bytes.
+func TruncateMiddle(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	half := max / 2
+	return s[:half] + fmt.Sprintf("\n\n[... %d bytes omitted ...]\n\n", len(s)-2*half) + s[len(s)-half:]
+}
@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCaptureSpillsPastMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCapture("stdout", CaptureOptions{MaxBytes: 20, SpillDir: dir, Filter: func(b []byte) []byte {
+		return bytes.ReplaceAll(b, []byte("secret"), []byte("******"))
+	}})
+	c.Write([]byte("0123456789\n"))
+	if c.SpillPath() != "" || c.String() != "0123456789\n" {
+		t.Fatalf("under MaxBytes: spill %q, String %q", c.SpillPath(), c.String())
+	}
+	c.Write([]byte("a secret line\n"))
+	c.Write([]byte("tail end"))
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.SpillPath() == "" || !strings.HasPrefix(c.SpillPath(), dir) {
+		t.Fatalf("SpillPath = %q, want a file in %s", c.SpillPath(), dir)
+	}
+	full, err := os.ReadFile(c.SpillPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(full) != "0123456789\na ****** line\ntail end" {
+		t.Errorf("spill file = %q (filtered full output)", full)
+	}
+	view := c.String()
+	if !strings.HasPrefix(view, "0123456789") || !strings.HasSuffix(view, "e\ntail end") || !strings.Contains(view, "bytes omitted; full output in "+c.SpillPath()) {
+		t.Errorf("String() = %q, want head, marker, and tail", view)
+	}
+	if c.Len() != 33 {
+		t.Errorf("Len = %d, want 33", c.Len())
+	}
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	if got := TruncateMiddle("short", 10); got != "short" {
+		t.Errorf("TruncateMiddle(short) = %q", got)
+	}
+	got := TruncateMiddle(strings.Repeat("a", 10)+strings.Repeat("b", 10), 8)
+	if want := "aaaa\n\n[... 12 bytes omitted ...]\n\nbbbb"; got != want {
+		t.Errorf("TruncateMiddle = %q, want %q", got, want)
+	}
+}
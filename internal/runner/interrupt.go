@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ErrInterrupted is returned by RunShellCommand when the command was stopped by Interrupts,
+// or was not started because an interrupt had already been requested.
+var ErrInterrupted = errors.New("interrupted")
+
+// DefaultGrace is how long Interrupt waits for commands to exit before killing them.
+const DefaultGrace = 10 * time.Second
+
+// Interrupts stops the commands started with it (CommandSpec.Interrupts). Each command runs in its
+// own process group; the first Interrupt forwards the signal to every group and kills the groups
+// still running after the grace period, a second Interrupt kills them at once.
+type Interrupts struct {
+	Grace time.Duration // <= 0 uses DefaultGrace
+
+	mu      sync.Mutex
+	count   int
+	running map[*exec.Cmd]struct{}
+	done    chan struct{}
+}
+
+// NewInterrupts returns an Interrupts with the given grace period.
+func NewInterrupts(grace time.Duration) *Interrupts {
+	return &Interrupts{Grace: grace, running: make(map[*exec.Cmd]struct{}), done: make(chan struct{})}
+}
+
+// Interrupt requests a stop: the first call forwards sig to the running commands and starts the
+// grace timer, later calls force-kill them. It returns true when the call forced the kill.
+func (i *Interrupts) Interrupt(sig os.Signal) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.count++
+	if i.count > 1 {
+		for cmd := range i.running {
+			killGroup(cmd)
+		}
+		return true
+	}
+	close(i.done)
+	for cmd := range i.running {
+		signalGroup(cmd, sig)
+	}
+	grace := i.Grace
+	if grace <= 0 {
+		grace = DefaultGrace
+	}
+	time.AfterFunc(grace, func() {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		for cmd := range i.running {
+			killGroup(cmd)
+		}
+	})
+	return false
+}
+
+// Done returns a channel closed by the first Interrupt; nil (never closed) for a nil Interrupts.
+func (i *Interrupts) Done() <-chan struct{} {
+	if i == nil {
+		return nil
+	}
+	return i.done
+}
+
+// Interrupted reports whether Interrupt has been called. A nil Interrupts is never interrupted.
+func (i *Interrupts) Interrupted() bool {
+	if i == nil {
+		return false
+	}
+	select {
+	case <-i.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// start starts cmd in its own process group and tracks it until finished is called. It returns
+// ErrInterrupted without starting when an interrupt has already been requested.
+func (i *Interrupts) start(cmd *exec.Cmd) error {
+	if i == nil {
+		return cmd.Start()
+	}
+	setProcessGroup(cmd)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.count > 0 {
+		return ErrInterrupted
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	i.running[cmd] = struct{}{}
+	return nil
+}
+
+func (i *Interrupts) finished(cmd *exec.Cmd) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	delete(i.running, cmd)
+	i.mu.Unlock()
+}
@@ -0,0 +1,40 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestInterruptsStopProcessGroup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are not used on windows")
+	}
+	interrupts := NewInterrupts(300 * time.Millisecond)
+	done := make(chan struct{})
+	var res Result
+	var err error
+	go func() {
+		defer close(done)
+		// The background sleep ignores SIGINT and keeps the pipe open until the grace period kills its group.
+		res, err = RunShellCommand(CommandSpec{Shell: "/bin/sh", ShellArgs: []string{"-c"}, Command: "echo started; sleep 30 & wait", Interrupts: interrupts})
+	}()
+	time.Sleep(200 * time.Millisecond)
+	interrupts.Interrupt(os.Interrupt)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command still running 5s after interrupt")
+	}
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("err = %v, want ErrInterrupted", err)
+	}
+	if res.Stdout != "started\n" {
+		t.Errorf("partial stdout = %q", res.Stdout)
+	}
+	if _, err := RunShellCommand(CommandSpec{Shell: "/bin/sh", ShellArgs: []string{"-c"}, Command: "true", Interrupts: interrupts}); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("start after interrupt err = %v, want ErrInterrupted", err)
+	}
+}
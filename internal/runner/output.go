@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter writes each line to W with Prefix in front. A trailing partial line is held until
+// it is completed or Flush is called. Safe for concurrent use.
+type PrefixWriter struct {
+	W      io.Writer
+	Prefix string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// NewPrefixWriter returns a PrefixWriter writing to w.
+func NewPrefixWriter(w io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{W: w, Prefix: prefix}
+}
+
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := io.WriteString(p.W, p.Prefix+string(p.buf[:i+1])); err != nil {
+			return len(b), err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes a held partial line, ending it with a newline.
+func (p *PrefixWriter) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(p.W, p.Prefix+string(p.buf)+"\n")
+	p.buf = nil
+	return err
+}
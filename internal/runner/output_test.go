@@ -0,0 +1,35 @@
+package runner
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPrefixWriter(&buf, "[Build] ")
+	for _, chunk := range []string{"first line\nsec", "ond line\n", "\npartial"} {
+		if _, err := p.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "[Build] first line\n[Build] second line\n[Build] \n[Build] partial\n"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRunShellCommandOutputSinks(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	shell, args := DefaultShell()
+	res, err := RunShellCommand(CommandSpec{Shell: shell, ShellArgs: args, Command: "echo out && echo err 1>&2", Stdout: &stdout, Stderr: &stderr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != res.Stdout || stderr.String() != res.Stderr || res.Stdout == "" || res.Stderr == "" {
+		t.Errorf("sinks got %q / %q, result %+v", stdout.String(), stderr.String(), res)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package runner
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on Windows, where console signals cannot be forwarded to a child.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup kills the command: Windows has no interrupt signal for other processes.
+func signalGroup(cmd *exec.Cmd, sig os.Signal) {
+	killGroup(cmd)
+}
+
+func killGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
@@ -1,7 +1,7 @@
 package runner
 
 import (
-	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
@@ -15,6 +15,18 @@ type CommandSpec struct {
 	ShellArgs []string
 	Command   string
 	WorkDir   string
+	Env       []string // KEY=VALUE entries; nil inherits the current process environment.
+
+	// Interrupts, when set, runs the command in its own process group and stops it on interrupt.
+	Interrupts *Interrupts
+
+	// Stdout and Stderr receive the command's output as it runs, in addition to Result;
+	// nil = os.Stdout / os.Stderr. Use io.Discard for quiet runs.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Capture bounds the output kept in Result; longer output spills to files (Result.StdoutFile).
+	Capture CaptureOptions
 }
 
 type Result struct {
@@ -30,6 +42,19 @@ type Result struct {
 	Stdout     string    `json:"stdout"`
 	Stderr     string    `json:"stderr"`
 	Error      string    `json:"error,omitempty"`
+
+	// Set when the output exceeded CaptureOptions.MaxBytes: Stdout/Stderr then hold the head and
+	// tail and these files the full output.
+	StdoutFile string `json:"stdoutFile,omitempty"`
+	StderrFile string `json:"stderrFile,omitempty"`
+
+	// Filled by internal/adapter when the CLI ran in its machine-readable output mode.
+	RawStdout    string  `json:"rawStdout,omitempty"` // original envelope; Stdout holds the unwrapped assistant message
+	Model        string  `json:"model,omitempty"`
+	SessionID    string  `json:"sessionId,omitempty"`
+	CostUSD      float64 `json:"costUsd,omitempty"`
+	InputTokens  int     `json:"inputTokens,omitempty"`
+	OutputTokens int     `json:"outputTokens,omitempty"`
 }
 
 func DefaultShell() (string, []string) {
@@ -54,6 +79,9 @@ func RunShellCommand(spec CommandSpec) (Result, error) {
 	if spec.WorkDir != "" {
 		cmd.Dir = spec.WorkDir
 	}
+	if spec.Env != nil {
+		cmd.Env = spec.Env
+	}
 
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
@@ -73,10 +101,10 @@ func RunShellCommand(spec CommandSpec) (Result, error) {
 		return result, err
 	}
 
-	var stdoutBuf bytes.Buffer
-	var stderrBuf bytes.Buffer
+	stdoutBuf := NewCapture("stdout", spec.Capture)
+	stderrBuf := NewCapture("stderr", spec.Capture)
 
-	if err := cmd.Start(); err != nil {
+	if err := spec.Interrupts.start(cmd); err != nil {
 		result.EndTime = time.Now()
 		result.Error = err.Error()
 		result.DurationMs = result.EndTime.Sub(result.StartTime).Milliseconds()
@@ -84,26 +112,40 @@ func RunShellCommand(spec CommandSpec) (Result, error) {
 		return result, err
 	}
 
+	liveStdout, liveStderr := spec.Stdout, spec.Stderr
+	if liveStdout == nil {
+		liveStdout = os.Stdout
+	}
+	if liveStderr == nil {
+		liveStderr = os.Stderr
+	}
+
 	wg := sync.WaitGroup{}
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		_, _ = io.Copy(io.MultiWriter(os.Stdout, &stdoutBuf), stdoutPipe)
+		_, _ = io.Copy(io.MultiWriter(liveStdout, stdoutBuf), stdoutPipe)
 	}()
 
 	go func() {
 		defer wg.Done()
-		_, _ = io.Copy(io.MultiWriter(os.Stderr, &stderrBuf), stderrPipe)
+		_, _ = io.Copy(io.MultiWriter(liveStderr, stderrBuf), stderrPipe)
 	}()
 
-	waitErr := cmd.Wait()
+	// Read the pipes to EOF before Wait, which closes them.
 	wg.Wait()
+	waitErr := cmd.Wait()
+	spec.Interrupts.finished(cmd)
 
 	result.EndTime = time.Now()
 	result.DurationMs = result.EndTime.Sub(result.StartTime).Milliseconds()
+	_ = stdoutBuf.Close()
+	_ = stderrBuf.Close()
 	result.Stdout = stdoutBuf.String()
 	result.Stderr = stderrBuf.String()
+	result.StdoutFile = stdoutBuf.SpillPath()
+	result.StderrFile = stderrBuf.SpillPath()
 
 	if waitErr != nil {
 		if exitErr, ok := waitErr.(*exec.ExitError); ok {
@@ -111,6 +153,9 @@ func RunShellCommand(spec CommandSpec) (Result, error) {
 		} else {
 			result.ExitCode = 1
 		}
+		if spec.Interrupts.Interrupted() {
+			waitErr = fmt.Errorf("%w: %v", ErrInterrupted, waitErr)
+		}
 		result.Error = waitErr.Error()
 		result.Success = false
 		return result, waitErr
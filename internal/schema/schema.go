@@ -0,0 +1,394 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is a parsed JSON Schema document. Only the subset of keywords needed for
+// node output validation is supported: type, properties, required,
+// additionalProperties, items, enum, const, minimum, maximum, minLength, maxLength,
+// minItems, maxItems, and pattern. Unknown keywords are ignored.
+type Schema struct {
+	Types                []string           // "type" as a list; empty means any type
+	Properties           map[string]*Schema // "properties"
+	Required             []string           // "required"
+	AdditionalProperties *Schema            // "additionalProperties" when given as a schema
+	NoAdditional         bool               // "additionalProperties": false
+	Items                *Schema            // "items"
+	Enum                 []interface{}      // "enum"
+	Const                interface{}        // "const"
+	HasConst             bool
+	Minimum              *float64
+	Maximum              *float64
+	MinLength            *int
+	MaxLength            *int
+	MinItems             *int
+	MaxItems             *int
+	Pattern              *regexp.Regexp
+}
+
+// Parse decodes a JSON Schema document.
+func Parse(data []byte) (*Schema, error) {
+	var raw interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	return fromValue(raw, "#")
+}
+
+func fromValue(raw interface{}, path string) (*Schema, error) {
+	switch v := raw.(type) {
+	case bool:
+		if v {
+			return &Schema{}, nil
+		}
+		// false schema: nothing validates; model as an impossible enum.
+		return &Schema{Enum: []interface{}{}}, nil
+	case map[string]interface{}:
+		return fromObject(v, path)
+	default:
+		return nil, fmt.Errorf("parse schema: %s must be an object or boolean", path)
+	}
+}
+
+func fromObject(m map[string]interface{}, path string) (*Schema, error) {
+	s := &Schema{}
+	if t, ok := m["type"]; ok {
+		switch tv := t.(type) {
+		case string:
+			s.Types = []string{tv}
+		case []interface{}:
+			for _, item := range tv {
+				name, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("parse schema: %s/type must contain strings", path)
+				}
+				s.Types = append(s.Types, name)
+			}
+		default:
+			return nil, fmt.Errorf("parse schema: %s/type must be a string or array", path)
+		}
+		for _, name := range s.Types {
+			if !knownType(name) {
+				return nil, fmt.Errorf("parse schema: %s/type has unknown type %q", path, name)
+			}
+		}
+	}
+	if props, ok := m["properties"].(map[string]interface{}); ok {
+		s.Properties = make(map[string]*Schema, len(props))
+		for name, sub := range props {
+			child, err := fromValue(sub, path+"/properties/"+name)
+			if err != nil {
+				return nil, err
+			}
+			s.Properties[name] = child
+		}
+	}
+	if req, ok := m["required"].([]interface{}); ok {
+		for _, item := range req {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("parse schema: %s/required must contain strings", path)
+			}
+			s.Required = append(s.Required, name)
+		}
+	}
+	switch ap := m["additionalProperties"].(type) {
+	case bool:
+		s.NoAdditional = !ap
+	case map[string]interface{}:
+		child, err := fromObject(ap, path+"/additionalProperties")
+		if err != nil {
+			return nil, err
+		}
+		s.AdditionalProperties = child
+	}
+	if items, ok := m["items"]; ok {
+		child, err := fromValue(items, path+"/items")
+		if err != nil {
+			return nil, err
+		}
+		s.Items = child
+	}
+	if enum, ok := m["enum"].([]interface{}); ok {
+		s.Enum = enum
+	}
+	if c, ok := m["const"]; ok {
+		s.Const = c
+		s.HasConst = true
+	}
+	var err error
+	if s.Minimum, err = numberKeyword(m, "minimum", path); err != nil {
+		return nil, err
+	}
+	if s.Maximum, err = numberKeyword(m, "maximum", path); err != nil {
+		return nil, err
+	}
+	if s.MinLength, err = intKeyword(m, "minLength", path); err != nil {
+		return nil, err
+	}
+	if s.MaxLength, err = intKeyword(m, "maxLength", path); err != nil {
+		return nil, err
+	}
+	if s.MinItems, err = intKeyword(m, "minItems", path); err != nil {
+		return nil, err
+	}
+	if s.MaxItems, err = intKeyword(m, "maxItems", path); err != nil {
+		return nil, err
+	}
+	if p, ok := m["pattern"].(string); ok {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("parse schema: %s/pattern: %w", path, err)
+		}
+		s.Pattern = re
+	}
+	return s, nil
+}
+
+func knownType(name string) bool {
+	switch name {
+	case "object", "array", "string", "number", "integer", "boolean", "null":
+		return true
+	}
+	return false
+}
+
+func numberKeyword(m map[string]interface{}, key, path string) (*float64, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("parse schema: %s/%s must be a number", path, key)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("parse schema: %s/%s: %w", path, key, err)
+	}
+	return &f, nil
+}
+
+func intKeyword(m map[string]interface{}, key, path string) (*int, error) {
+	f, err := numberKeyword(m, key, path)
+	if err != nil || f == nil {
+		return nil, err
+	}
+	if *f < 0 || *f != math.Trunc(*f) {
+		return nil, fmt.Errorf("parse schema: %s/%s must be a non-negative integer", path, key)
+	}
+	i := int(*f)
+	return &i, nil
+}
+
+// ValidateJSON decodes data and validates it against s. It returns one message per
+// violation (empty when data is valid) or an error when data is not valid JSON.
+func (s *Schema) ValidateJSON(data []byte) ([]string, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("decode output: %w", err)
+	}
+	return s.Validate(v), nil
+}
+
+// Validate checks a decoded JSON value (as produced by encoding/json with UseNumber)
+// against s and returns one message per violation.
+func (s *Schema) Validate(v interface{}) []string {
+	var out []string
+	s.validate(v, "$", &out)
+	return out
+}
+
+func (s *Schema) validate(v interface{}, path string, out *[]string) {
+	if s == nil {
+		return
+	}
+	if len(s.Types) > 0 && !matchesAnyType(v, s.Types) {
+		*out = append(*out, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(s.Types, " or "), typeOf(v)))
+		return
+	}
+	if s.Enum != nil && !containsValue(s.Enum, v) {
+		*out = append(*out, fmt.Sprintf("%s: value %s is not one of the allowed values", path, compact(v)))
+	}
+	if s.HasConst && !equalValues(s.Const, v) {
+		*out = append(*out, fmt.Sprintf("%s: value %s does not equal const %s", path, compact(v), compact(s.Const)))
+	}
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		s.validateObject(tv, path, out)
+	case []interface{}:
+		if s.MinItems != nil && len(tv) < *s.MinItems {
+			*out = append(*out, fmt.Sprintf("%s: expected at least %d items, got %d", path, *s.MinItems, len(tv)))
+		}
+		if s.MaxItems != nil && len(tv) > *s.MaxItems {
+			*out = append(*out, fmt.Sprintf("%s: expected at most %d items, got %d", path, *s.MaxItems, len(tv)))
+		}
+		if s.Items != nil {
+			for i, item := range tv {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), out)
+			}
+		}
+	case string:
+		n := len([]rune(tv))
+		if s.MinLength != nil && n < *s.MinLength {
+			*out = append(*out, fmt.Sprintf("%s: expected length >= %d, got %d", path, *s.MinLength, n))
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			*out = append(*out, fmt.Sprintf("%s: expected length <= %d, got %d", path, *s.MaxLength, n))
+		}
+		if s.Pattern != nil && !s.Pattern.MatchString(tv) {
+			*out = append(*out, fmt.Sprintf("%s: %q does not match pattern %q", path, tv, s.Pattern.String()))
+		}
+	case json.Number:
+		f, err := tv.Float64()
+		if err != nil {
+			return
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			*out = append(*out, fmt.Sprintf("%s: %s is less than minimum %v", path, tv, *s.Minimum))
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			*out = append(*out, fmt.Sprintf("%s: %s is greater than maximum %v", path, tv, *s.Maximum))
+		}
+	}
+}
+
+func (s *Schema) validateObject(obj map[string]interface{}, path string, out *[]string) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			*out = append(*out, fmt.Sprintf("%s: missing required property %q", path, name))
+		}
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := path + "." + k
+		if prop, ok := s.Properties[k]; ok {
+			prop.validate(obj[k], child, out)
+			continue
+		}
+		if s.NoAdditional {
+			*out = append(*out, fmt.Sprintf("%s: unexpected property %q", path, k))
+			continue
+		}
+		if s.AdditionalProperties != nil {
+			s.AdditionalProperties.validate(obj[k], child, out)
+		}
+	}
+}
+
+func matchesAnyType(v interface{}, names []string) bool {
+	for _, name := range names {
+		if matchesType(v, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(v interface{}, name string) bool {
+	switch name {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return false
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if equalValues(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalValues compares two decoded JSON values by their canonical encoding.
+func equalValues(a, b interface{}) bool {
+	return compact(a) == compact(b)
+}
+
+func compact(v interface{}) string {
+	data, err := json.Marshal(normalizeNumbers(v))
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func normalizeNumbers(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case json.Number:
+		if f, err := tv.Float64(); err == nil {
+			return f
+		}
+		return tv.String()
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(tv))
+		for k, item := range tv {
+			out[k] = normalizeNumbers(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(tv))
+		for i, item := range tv {
+			out[i] = normalizeNumbers(item)
+		}
+		return out
+	}
+	return v
+}
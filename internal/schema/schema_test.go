@@ -0,0 +1,80 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("invalid_json", func(t *testing.T) {
+		if _, err := Parse([]byte("{not json")); err == nil {
+			t.Error("Parse(invalid) want error")
+		}
+	})
+	t.Run("unknown_type", func(t *testing.T) {
+		if _, err := Parse([]byte(`{"type": "float"}`)); err == nil {
+			t.Error("Parse(unknown type) want error")
+		}
+	})
+	t.Run("bad_pattern", func(t *testing.T) {
+		if _, err := Parse([]byte(`{"type": "string", "pattern": "("}`)); err == nil {
+			t.Error("Parse(bad pattern) want error")
+		}
+	})
+}
+
+func TestValidateJSON(t *testing.T) {
+	s, err := Parse([]byte(`{
+		"type": "object",
+		"required": ["files", "severity"],
+		"additionalProperties": false,
+		"properties": {
+			"files": {"type": "array", "items": {"type": "string"}, "minItems": 1},
+			"severity": {"enum": ["low", "medium", "high"]},
+			"score": {"type": "integer", "minimum": 0, "maximum": 10}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		got, err := s.ValidateJSON([]byte(`{"files": ["a.go"], "severity": "high", "score": 3}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0 {
+			t.Errorf("violations = %v, want none", got)
+		}
+	})
+	t.Run("violations", func(t *testing.T) {
+		got, err := s.ValidateJSON([]byte(`{"files": [1], "severity": "critical", "score": 11.5, "extra": true}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		joined := strings.Join(got, "\n")
+		for _, want := range []string{"$.files[0]: expected string", "$.severity", "$.score: expected integer", `unexpected property "extra"`} {
+			if !strings.Contains(joined, want) {
+				t.Errorf("violations missing %q:\n%s", want, joined)
+			}
+		}
+	})
+	t.Run("missing_required", func(t *testing.T) {
+		got, err := s.ValidateJSON([]byte(`{"files": []}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		joined := strings.Join(got, "\n")
+		if !strings.Contains(joined, `missing required property "severity"`) {
+			t.Errorf("violations = %v, want missing severity", got)
+		}
+		if !strings.Contains(joined, "at least 1 items") {
+			t.Errorf("violations = %v, want minItems", got)
+		}
+	})
+	t.Run("not_json", func(t *testing.T) {
+		if _, err := s.ValidateJSON([]byte("nope")); err == nil {
+			t.Error("ValidateJSON(not json) want error")
+		}
+	})
+}
@@ -122,14 +122,22 @@ func FromJSON(payload string) (Settings, error) {
 	return settings, nil
 }
 
-// ToEnv loads settings and applies them to the current environment.
-// Stored values are merged with defaultValues so unset behavior keys get the documented default.
-func ToEnv() (Settings, error) {
+// Effective loads settings without touching the environment. Stored values are merged with
+// defaultValues so unset behavior keys get the documented default.
+func Effective() (Settings, error) {
 	settings, err := loadSettings()
 	if err != nil {
 		return nil, err
 	}
-	effective := applyDefaults(settings)
+	return applyDefaults(settings), nil
+}
+
+// ToEnv loads settings (see Effective) and applies them to the current environment.
+func ToEnv() (Settings, error) {
+	effective, err := Effective()
+	if err != nil {
+		return nil, err
+	}
 	for key, value := range effective {
 		if err := os.Setenv(key, value); err != nil {
 			return nil, err
@@ -138,6 +146,72 @@ func ToEnv() (Settings, error) {
 	return effective, nil
 }
 
+// IsSecretKey reports whether a setting holds a credential: a CLI API key (KeyENV) or a key
+// ending in _KEY, _SECRET, _TOKEN, or _PASSWORD.
+func IsSecretKey(key string) bool {
+	key = strings.ToUpper(strings.TrimSpace(key))
+	for _, suffix := range []string{"_KEY", "_SECRET", "_TOKEN", "_PASSWORD"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return types.IsCLIKeyENV(key)
+}
+
+// TemplateLookupEnv resolves {{env.NAME}} in node text, metadata, and prompt files from the
+// process environment. Secrets (IsSecretKey) never resolve: prompts end up in process arguments,
+// run logs, and recordings.
+func TemplateLookupEnv(name string) (string, bool) {
+	if IsSecretKey(name) {
+		return "", false
+	}
+	return os.LookupEnv(name)
+}
+
+// EnvMetadataLookupEnv resolves {{env.NAME}} in env metadata, whose values only reach the
+// agent's environment: s, then the process environment. CLI API keys never resolve; each agent
+// gets its own from CLISecrets.
+func EnvMetadataLookupEnv(s Settings) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		if types.IsCLIKeyENV(name) {
+			return "", false
+		}
+		if v, ok := s[name]; ok {
+			return v, true
+		}
+		return os.LookupEnv(name)
+	}
+}
+
+// CLISecrets returns the CLI API keys (KeyENV) stored in s, for run.EnvOptions.Secrets.
+func CLISecrets(s Settings) map[string]string {
+	out := make(map[string]string)
+	for key, value := range s {
+		if types.IsCLIKeyENV(key) {
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// SecretValues returns the non-empty values of the secret settings in s (see IsSecretKey),
+// plus the values of the same keys in the current environment.
+func SecretValues(s Settings) []string {
+	var out []string
+	for _, key := range settingsKeys() {
+		if !IsSecretKey(key) {
+			continue
+		}
+		if v := strings.TrimSpace(s[key]); v != "" {
+			out = append(out, v)
+		}
+		if v := strings.TrimSpace(os.Getenv(key)); v != "" && v != strings.TrimSpace(s[key]) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 // CLILoginStatus returns which supported CLIs have credentials configured.
 // It uses only the encrypted settings file (loadSettings): a CLI is logged in
 // if at least one of its KeyENV keys is present in settings and non-empty.
@@ -253,6 +327,11 @@ func settingsKeyPath() (string, error) {
 	return filepath.Join(dir, keyFileName), nil
 }
 
+// StateDir returns the directory of the encrypted settings file; the run history lives there too.
+func StateDir() (string, error) {
+	return stateDir()
+}
+
 // stateDir returns the OS-appropriate directory for the encrypted state file.
 // Prefer config dir so it's included in normal backups; key lives in a different dir (keyDir).
 func stateDir() (string, error) {
@@ -404,6 +483,17 @@ func settingsKeys() []string {
 		keys = append(keys, name)
 	}
 	for _, cli := range types.AllCLIs {
+		for _, prefix := range perCLISettingsPrefixes {
+			if cli.Codename == "" {
+				continue
+			}
+			name := prefix + cli.Codename
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			keys = append(keys, name)
+		}
 		if strings.TrimSpace(cli.KeyENV) == "" {
 			continue
 		}
@@ -424,13 +514,44 @@ func settingsKeys() []string {
 	return keys
 }
 
+// perCLISettingsPrefixes are prefixes of settings keyed by CLI codename (e.g. PRICE_CLAUDE).
+var perCLISettingsPrefixes = []string{
+	"DEFAULT_MODEL_",
+	"MODELS_",
+	"PRICE_",
+}
+
 var extraSettingsKeys = []string{
 	"DEFAULT_CLI",
 	"DEFAULT_TIMEOUT",
 	"DEFAULT_RETRY_CLI",
 	"DEFAULT_RETRY_COUNT",
 	"DEFAULT_VALIDATE_CLI",
+	"ALLOWED_PATHS",
+	"CONTEXT_MAX_BYTES",
+	"CONTEXT_MAX_FILE_BYTES",
+	"ENV_PASSTHROUGH",
+	"GIT_CHECKPOINT",
+	"GIT_COMMIT",
+	"GIT_RESET_ON_RETRY",
 	"LOG_DIR",
+	"MAX_RUN_COST",
+	"MAX_RUN_TOKENS",
+	"NATIVE_OUTPUT",
+	"PATH_GUARD_REVERT",
+	"PROMPTS_DIR",
+	"PROMPT_VALIDATE",
+	"PROMPT_PROCESS_RESPONSE",
+	"PROMPT_DECISION_RESPONSE",
+	"PROMPT_VALIDATION_RESPONSE",
+	"PROMPT_OUTPUT_SCHEMA",
+	"PROTECTED_PATHS",
+	"REDACT_PATTERNS",
+	"RUN_HISTORY",
+	"INTERRUPT_GRACE",
+	"APPROVAL_TIMEOUT",
+	"CAPTURE_MAX_BYTES",
+	"VALIDATE_OUTPUT_MAX_BYTES",
 	"WRITE_LOG_SHORT",
 	"WRITE_LOG_LONG",
 	"LUCIDCHART_API_KEY",
@@ -4,7 +4,10 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/types"
 )
 
 func TestFromJSONAndGet(t *testing.T) {
@@ -221,3 +224,46 @@ func clearSettingsFiles(t *testing.T) {
 	}
 	_ = os.Remove(keyPath)
 }
+
+func TestSecretValues(t *testing.T) {
+	for key, want := range map[string]bool{
+		"ANTHROPIC_API_KEY": true, "GH_TOKEN": true, "LUCID_OAUTH_CLIENT_SECRET": true,
+		"DEFAULT_CLI": false, "LOG_DIR": false, "REDACT_PATTERNS": false,
+	} {
+		if got := IsSecretKey(key); got != want {
+			t.Errorf("IsSecretKey(%s) = %v, want %v", key, got, want)
+		}
+	}
+
+	for _, key := range settingsKeys() {
+		if IsSecretKey(key) {
+			t.Setenv(key, "")
+		}
+	}
+	t.Setenv("GEMINI_API_KEY", "gemini-from-env")
+	got := SecretValues(Settings{"ANTHROPIC_API_KEY": "claude-key", "DEFAULT_CLI": "CLAUDE", "CURSOR_API_KEY": " "})
+	sort.Strings(got)
+	if want := []string{"claude-key", "gemini-from-env"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SecretValues = %v, want %v", got, want)
+	}
+}
+
+func TestTemplateLookupEnv(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "exported-key")
+	t.Setenv("REPO", "monads")
+	stored := Settings{"ANTHROPIC_API_KEY": "stored-key", "NPM_TOKEN": "npm-secret"}
+	n := &types.Node{
+		Text:     "Fix {{env.REPO}} with {{env.ANTHROPIC_API_KEY}}",
+		Metadata: map[string]string{"validate_prompt": "{{env.NPM_TOKEN}}?", "env": `{"NPM_TOKEN": "{{env.NPM_TOKEN}}"}`},
+	}
+	p := types.NodeToProcessedNodeWithDefaults(n, &types.ProcessedNodeDefaults{LookupEnv: TemplateLookupEnv, LookupEnvMetadata: EnvMetadataLookupEnv(stored)})
+	if p.Prompt != "Fix monads with {{env.ANTHROPIC_API_KEY}}" || p.ValidatePrompt != "{{env.NPM_TOKEN}}?" {
+		t.Errorf("secrets reached the prompts: %q, %q", p.Prompt, p.ValidatePrompt)
+	}
+	if p.Env != `{"NPM_TOKEN": "npm-secret"}` {
+		t.Errorf("Env = %q", p.Env)
+	}
+	if want := []string{"env.ANTHROPIC_API_KEY", "env.NPM_TOKEN"}; !reflect.DeepEqual(p.UndefinedVars, want) {
+		t.Errorf("UndefinedVars = %v, want %v", p.UndefinedVars, want)
+	}
+}
@@ -0,0 +1,281 @@
+// Package treetest runs a tree offline against scripted agent responses and checks the path
+// taken, retries, final status, and rendered prompts (monadscli test).
+package treetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/run"
+	"github.com/ryanmontgomery/MonadsCLI/internal/runlog"
+	"github.com/ryanmontgomery/MonadsCLI/internal/runner"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+// Final statuses of a tree run.
+const (
+	StatusPassed = "passed" // The tree finished and every node passed.
+	StatusFailed = "failed" // The tree finished but a node did not pass validation after its retries.
+	StatusError  = "error"  // The run stopped with an error (preflight, unscripted call, rejection, ...).
+)
+
+// Default responses for calls a case does not script.
+const (
+	DefaultProcessResponse    = `{"completed": true, "secs_taken": 0, "tokens_used": 0, "comments": []}`
+	DefaultValidationResponse = `{"fully_completed": true, "partially_completed": false, "should_retry": false, "warnings": []}`
+)
+
+// Spec is a test spec file: test cases for one tree.
+type Spec struct {
+	// Settings override the built-in defaults for every case (e.g. DEFAULT_RETRY_COUNT); user
+	// settings are not read, so results do not depend on the machine.
+	Settings map[string]string `json:"settings,omitempty"`
+	Tests    []Case            `json:"tests"`
+}
+
+// Case is one scripted run of the tree.
+type Case struct {
+	Name      string            `json:"name"`
+	Vars      map[string]string `json:"vars,omitempty"`      // Tree inputs ({{vars.x}}).
+	Answers   map[string]string `json:"answers,omitempty"`   // Routes of Human decision nodes, by node name.
+	Approvals map[string]string `json:"approvals,omitempty"` // Answers at Approval nodes (see run.ParseApproval), by node name.
+	Responses map[string]Script `json:"responses,omitempty"` // Agent responses, by node name.
+	Expect    Expect            `json:"expect"`
+}
+
+// Script holds a node's responses per phase, used in order. A response is a JSON string (the
+// agent's stdout as is) or any other JSON value (its text is the stdout). Unscripted run and
+// retry calls of process nodes get DefaultProcessResponse and unscripted validations
+// DefaultValidationResponse; other unscripted calls fail the run.
+type Script struct {
+	Run      []json.RawMessage `json:"run,omitempty"`
+	Validate []json.RawMessage `json:"validate,omitempty"`
+	Retry    []json.RawMessage `json:"retry,omitempty"`
+}
+
+// Expect holds the assertions of a case; empty fields are not checked.
+type Expect struct {
+	Path    []string       `json:"path,omitempty"`    // Names of the nodes run, in order.
+	Retries map[string]int `json:"retries,omitempty"` // Retry count by node name.
+	Status  string         `json:"status,omitempty"`  // StatusPassed, StatusFailed, or StatusError.
+	Error   string         `json:"error,omitempty"`   // Substring of the run error.
+	Prompts []PromptCheck  `json:"prompts,omitempty"`
+}
+
+// PromptCheck asserts on the prompt of one call: Phase defaults to run, Attempt to 0.
+type PromptCheck struct {
+	Node        string   `json:"node"`
+	Phase       string   `json:"phase,omitempty"`
+	Attempt     int      `json:"attempt,omitempty"`
+	Contains    []string `json:"contains,omitempty"`
+	NotContains []string `json:"not_contains,omitempty"`
+}
+
+// Result is the outcome of one case.
+type Result struct {
+	Name     string
+	Status   string   // Final status of the tree run.
+	Path     []string // Names of the nodes run, in order.
+	Failures []string // Unmet expectations.
+	Err      error    // The case could not be run (e.g. invalid vars); reported as a JUnit error.
+	Duration time.Duration
+}
+
+// Passed reports whether the case ran and met every expectation.
+func (r Result) Passed() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// LoadSpec reads a spec file.
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read spec: %w", err)
+	}
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("spec %s: %w", path, err)
+	}
+	if len(spec.Tests) == 0 {
+		return nil, fmt.Errorf("spec %s has no tests", path)
+	}
+	for i, c := range spec.Tests {
+		if strings.TrimSpace(c.Name) == "" {
+			spec.Tests[i].Name = fmt.Sprintf("test %d", i+1)
+		}
+		switch c.Expect.Status {
+		case "", StatusPassed, StatusFailed, StatusError:
+		default:
+			return nil, fmt.Errorf("spec %s: test %q: invalid status %q", path, spec.Tests[i].Name, c.Expect.Status)
+		}
+	}
+	return &spec, nil
+}
+
+// RunCase runs the tree at root with the case's scripted responses, answers, and approvals, and
+// checks its expectations. opts supplies the CLI defaults; its Executor, Approver, and Answers are
+// replaced, and no logs are written. Preflight runs first, as in run-tree.
+func RunCase(c Case, root *types.ProcessedNode, opts run.RunOptions) Result {
+	start := time.Now()
+	script := newScriptedExecutor(c, root)
+	opts.Executor = script
+	opts.Approver = scriptedApprover(c.Approvals)
+	opts.Answers = c.Answers
+	res := Result{Name: c.Name, Status: StatusPassed}
+	opts.OnNodeDone = func(node *types.ProcessedNode, nr run.NodeResult) {
+		res.Path = append(res.Path, node.Name)
+		if !nr.Valid && res.Status == StatusPassed {
+			res.Status = StatusFailed
+		}
+	}
+	err := run.Preflight(root, opts)
+	if err == nil {
+		err = runlog.ExecuteTree(root, opts, "", "", "", false, false)
+	}
+	if err != nil {
+		res.Status = StatusError
+	}
+	res.Duration = time.Since(start)
+	res.Failures = check(c.Expect, res, err, root, script.calls)
+	return res
+}
+
+func check(want Expect, res Result, runErr error, root *types.ProcessedNode, calls []run.Invocation) []string {
+	var failures []string
+	status := want.Status
+	if status == "" {
+		status = StatusPassed
+	}
+	if res.Status != status {
+		msg := fmt.Sprintf("status: got %s, want %s", res.Status, status)
+		if runErr != nil {
+			msg += ": " + runErr.Error()
+		}
+		failures = append(failures, msg)
+	}
+	if want.Error != "" && (runErr == nil || !strings.Contains(runErr.Error(), want.Error)) {
+		failures = append(failures, fmt.Sprintf("error: got %v, want it to contain %q", runErr, want.Error))
+	}
+	if want.Path != nil && strings.Join(res.Path, "\x00") != strings.Join(want.Path, "\x00") {
+		failures = append(failures, fmt.Sprintf("path: got %s, want %s", formatPath(res.Path), formatPath(want.Path)))
+	}
+	retries := map[string]int{}
+	walk(root, func(n *types.ProcessedNode) {
+		retries[n.Name] += n.Retried
+	})
+	for _, name := range sortedKeys(want.Retries) {
+		if got := retries[name]; got != want.Retries[name] {
+			failures = append(failures, fmt.Sprintf("retries of %q: got %d, want %d", name, got, want.Retries[name]))
+		}
+	}
+	for _, pc := range want.Prompts {
+		phase := pc.Phase
+		if phase == "" {
+			phase = run.PhaseRun
+		}
+		prompt, ok := findPrompt(calls, pc.Node, phase, pc.Attempt)
+		if !ok {
+			failures = append(failures, fmt.Sprintf("prompt of %q %s attempt %d: no such call", pc.Node, phase, pc.Attempt))
+			continue
+		}
+		for _, s := range pc.Contains {
+			if !strings.Contains(prompt, s) {
+				failures = append(failures, fmt.Sprintf("prompt of %q %s attempt %d: missing %q", pc.Node, phase, pc.Attempt, s))
+			}
+		}
+		for _, s := range pc.NotContains {
+			if strings.Contains(prompt, s) {
+				failures = append(failures, fmt.Sprintf("prompt of %q %s attempt %d: contains %q", pc.Node, phase, pc.Attempt, s))
+			}
+		}
+	}
+	return failures
+}
+
+func findPrompt(calls []run.Invocation, node, phase string, attempt int) (string, bool) {
+	for _, inv := range calls {
+		if inv.Node == node && inv.Phase == phase && inv.Attempt == attempt {
+			return inv.Prompt, true
+		}
+	}
+	return "", false
+}
+
+func formatPath(path []string) string {
+	if len(path) == 0 {
+		return "(none)"
+	}
+	return strings.Join(path, " -> ")
+}
+
+// scriptedExecutor serves a case's scripted responses (run.Executor) and records the calls.
+type scriptedExecutor struct {
+	script map[string]Script
+	kinds  map[string]string // run.ResponseKind by node name
+	used   map[string]int    // responses used by node and phase
+	calls  []run.Invocation
+}
+
+func newScriptedExecutor(c Case, root *types.ProcessedNode) *scriptedExecutor {
+	e := &scriptedExecutor{script: c.Responses, kinds: map[string]string{}, used: map[string]int{}}
+	walk(root, func(n *types.ProcessedNode) {
+		e.kinds[n.Name] = run.ResponseKind(n)
+	})
+	return e
+}
+
+func (e *scriptedExecutor) Execute(inv run.Invocation, spec runner.CommandSpec) (runner.Result, error) {
+	e.calls = append(e.calls, inv)
+	s := e.script[inv.Node]
+	responses := s.Run
+	switch inv.Phase {
+	case run.PhaseValidate:
+		responses = s.Validate
+	case run.PhaseRetry:
+		responses = s.Retry
+	}
+	key := inv.Node + "\x00" + inv.Phase
+	i := e.used[key]
+	e.used[key]++
+	var stdout string
+	switch {
+	case i < len(responses):
+		var text string
+		if err := json.Unmarshal(responses[i], &text); err != nil {
+			text = string(responses[i])
+		}
+		stdout = text
+	case inv.Phase == run.PhaseValidate:
+		stdout = DefaultValidationResponse
+	case e.kinds[inv.Node] == run.ResponseKindProcess:
+		stdout = DefaultProcessResponse
+	default:
+		return runner.Result{}, fmt.Errorf("no scripted %s response #%d for node %q", inv.Phase, i+1, inv.Node)
+	}
+	return runner.Result{Stdout: stdout, Success: true}, nil
+}
+
+// scriptedApprover answers Approval nodes from a case's approvals.
+type scriptedApprover map[string]string
+
+func (a scriptedApprover) Approve(_ context.Context, req run.ApprovalRequest) (run.Approval, error) {
+	answer, ok := a[req.Node]
+	if !ok {
+		return run.Approval{}, fmt.Errorf("no scripted approval for node %q", req.Node)
+	}
+	return run.ParseApproval(answer)
+}
+
+func walk(n *types.ProcessedNode, f func(*types.ProcessedNode)) {
+	if n == nil {
+		return
+	}
+	f(n)
+	for _, route := range sortedKeys(n.Children) {
+		walk(n.Children[route], f)
+	}
+}
@@ -0,0 +1,107 @@
+package treetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryanmontgomery/MonadsCLI/internal/run"
+	"github.com/ryanmontgomery/MonadsCLI/types"
+)
+
+func newTree() *types.ProcessedNode {
+	fix := &types.ProcessedNode{Name: "Fix", Prompt: "Fix the bug", ValidatePrompt: "Fixed?", Retries: 2}
+	done := &types.ProcessedNode{Name: "Done", Prompt: "Write notes"}
+	return &types.ProcessedNode{Name: "Broken?", Prompt: "Is the build broken?", Children: map[string]*types.ProcessedNode{
+		"yes": fix,
+		"no":  done,
+	}}
+}
+
+func TestRunCase(t *testing.T) {
+	opts := run.RunOptions{DefaultCLI: "CURSOR", DefaultValidateCLI: "CURSOR", DefaultRetryCLI: "CURSOR"}
+	spec := []byte(`{"tests": [
+		{
+			"name": "fixed after a retry",
+			"responses": {
+				"Broken?": {"run": [{"choices": ["yes", "no"], "answer": "yes", "reasons": []}]},
+				"Fix": {"validate": [
+					{"fully_completed": false, "partially_completed": true, "should_retry": true, "warnings": ["tests still fail"]}
+				]}
+			},
+			"expect": {
+				"path": ["Broken?", "Fix"],
+				"retries": {"Fix": 1},
+				"prompts": [
+					{"node": "Broken?", "contains": ["Is the build broken?"]},
+					{"node": "Fix", "phase": "retry", "attempt": 1, "contains": ["tests still fail"]}
+				]
+			}
+		},
+		{
+			"name": "never fixed",
+			"responses": {
+				"Broken?": {"run": ["{\"answer\": \"yes\"}"]},
+				"Fix": {"validate": [
+					{"fully_completed": false}, {"fully_completed": false}, {"fully_completed": false}
+				]}
+			},
+			"expect": {"status": "failed", "retries": {"Fix": 2}}
+		},
+		{
+			"name": "wrong expectations",
+			"expect": {"path": ["Broken?", "Done"], "error": "no scripted"}
+		}
+	]}`)
+	path := filepath.Join(t.TempDir(), "spec.json")
+	if err := os.WriteFile(path, spec, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSpec(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []Result
+	for _, c := range s.Tests {
+		results = append(results, RunCase(c, newTree(), opts))
+	}
+	for _, r := range results[:2] {
+		if !r.Passed() {
+			t.Errorf("%s: failures %v", r.Name, r.Failures)
+		}
+	}
+	wrong := results[2]
+	if wrong.Passed() || wrong.Status != StatusError || len(wrong.Failures) != 2 || !strings.Contains(wrong.Failures[0], "status: got error, want passed") {
+		t.Errorf("wrong expectations: status %s, failures %q", wrong.Status, wrong.Failures)
+	}
+
+	results = append(results, Result{Name: "bad vars", Err: errors.New("missing required input ticket")})
+	var text, junit bytes.Buffer
+	WriteText(&text, results)
+	if !strings.Contains(text.String(), "PASS  fixed after a retry") || !strings.Contains(text.String(), "FAIL  2 of 4 test(s) failed") {
+		t.Errorf("text report:\n%s", text.String())
+	}
+	if err := WriteJUnit(&junit, "tree.csv", results); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`<testsuite name="tree.csv" tests="4" failures="1" errors="1"`, `<testcase name="never fixed" classname="tree.csv"`, `<error message="missing required input ticket">`} {
+		if !strings.Contains(junit.String(), want) {
+			t.Errorf("JUnit lacks %s:\n%s", want, junit.String())
+		}
+	}
+}
+
+func TestLoadSpecRejectsUnknownStatus(t *testing.T) {
+	data, _ := json.Marshal(Spec{Tests: []Case{{Name: "x", Expect: Expect{Status: "ok"}}}})
+	path := filepath.Join(t.TempDir(), "spec.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSpec(path); err == nil || !strings.Contains(err.Error(), `invalid status "ok"`) {
+		t.Errorf("LoadSpec err = %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package prompts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Names of the built-in prompts that can be overridden.
+const (
+	NameValidate           = "validate"            // default validation prompt (validate.txt)
+	NameProcessResponse    = "process_response"    // ProcessResponse JSON instruction
+	NameDecisionResponse   = "decision_response"   // DecisionResponse JSON instruction
+	NameValidationResponse = "validation_response" // ValidationResponse JSON instruction
+	NameOutputSchema       = "output_schema"       // output key instruction for nodes with an output_schema
+)
+
+// SourceBuiltin is the Effective source of a prompt that has no override.
+const SourceBuiltin = "built-in"
+
+// Data is the template data available to prompt overrides, e.g. {{.Name}} or
+// {{if eq .Kind "decision"}}. Fields that do not apply are empty; the validate
+// prompt is rendered while the tree is converted and only sees Name and Prompt.
+type Data struct {
+	Name         string // Node shape label
+	Prompt       string // Node prompt text
+	Kind         string // "process" or "decision"
+	CLI          string // Codename running the node
+	Model        string
+	ValidateCLI  string
+	RetryCLI     string
+	Retries      int
+	Retried      int
+	Timeout      int
+	OutputSchema string
+}
+
+// Names returns the overridable prompt names in display order.
+func Names() []string {
+	return []string{NameValidate, NameProcessResponse, NameDecisionResponse, NameValidationResponse, NameOutputSchema}
+}
+
+// Builtin returns the compiled-in template text for name.
+func Builtin(name string) (string, bool) {
+	switch name {
+	case NameValidate:
+		return strings.TrimSpace(defaultValidatePrompt), true
+	case NameProcessResponse:
+		return processResponseText, true
+	case NameDecisionResponse:
+		return decisionResponseText, true
+	case NameValidationResponse:
+		return validationResponseText, true
+	case NameOutputSchema:
+		return outputSchemaText, true
+	}
+	return "", false
+}
+
+type override struct {
+	text   string
+	source string
+	tmpl   *template.Template
+}
+
+var (
+	overridesMu sync.RWMutex
+	overrides   = map[string]override{}
+)
+
+// Warnings receives a line for every override that fails to execute in Render; nil discards them.
+var Warnings io.Writer = os.Stderr
+
+// SetOverride replaces the built-in prompt name with text, a text/template executed with Data.
+// source describes where the text came from (e.g. a file path) for Effective.
+// The template is parsed and test-executed so mistakes fail here rather than mid-run.
+func SetOverride(name, text, source string) error {
+	if _, ok := Builtin(name); !ok {
+		return fmt.Errorf("unknown prompt %q (known: %s)", name, strings.Join(Names(), ", "))
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("prompt %s: %w", name, err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, Data{}); err != nil {
+		return fmt.Errorf("prompt %s: %w", name, err)
+	}
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	overrides[name] = override{text: text, source: source, tmpl: tmpl}
+	return nil
+}
+
+// ResetOverrides removes every override so the built-in prompts are used.
+func ResetOverrides() {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	overrides = map[string]override{}
+}
+
+// Effective returns the template text used for name and its source: a file path, or SourceBuiltin.
+func Effective(name string) (string, string) {
+	overridesMu.RLock()
+	o, ok := overrides[name]
+	overridesMu.RUnlock()
+	if ok {
+		return o.text, o.source
+	}
+	text, _ := Builtin(name)
+	return text, SourceBuiltin
+}
+
+// Render returns the prompt name executed with data. An override that fails to execute (e.g.
+// on data SetOverride's test run did not cover) is reported to Warnings and the built-in text
+// is used instead.
+func Render(name string, data Data) string {
+	overridesMu.RLock()
+	o, ok := overrides[name]
+	overridesMu.RUnlock()
+	if ok {
+		var b bytes.Buffer
+		err := o.tmpl.Execute(&b, data)
+		if err == nil {
+			return strings.TrimSpace(b.String())
+		}
+		if Warnings != nil {
+			fmt.Fprintf(Warnings, "warning: prompt %s (%s): %v; using the built-in prompt\n", name, o.source, err)
+		}
+	}
+	text, _ := Builtin(name)
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return text
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return text
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// LoadOverrides sets an override for every prompt with a file: files[name] when set
+// (e.g. from PROMPT_<NAME> settings), otherwise <dir>/<name>.txt when it exists.
+// It returns the names that were overridden.
+func LoadOverrides(dir string, files map[string]string) ([]string, error) {
+	var loaded []string
+	var errs []error
+	for _, name := range Names() {
+		path := strings.TrimSpace(files[name])
+		if path == "" && dir != "" {
+			candidate := filepath.Join(dir, name+".txt")
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+			}
+		}
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("prompt %s: %w", name, err))
+			continue
+		}
+		if err := SetOverride(name, string(data), path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		loaded = append(loaded, name)
+	}
+	return loaded, errors.Join(errs...)
+}
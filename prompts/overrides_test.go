@@ -0,0 +1,91 @@
+package prompts
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOverrides(t *testing.T) {
+	t.Cleanup(ResetOverrides)
+
+	t.Run("builtin", func(t *testing.T) {
+		if text, source := Effective(NameProcessResponse); source != SourceBuiltin || text != processResponseText {
+			t.Errorf("Effective = %q, %q", text, source)
+		}
+		if got := OutputSchemaInstruction(` {"type":"object"} `); !strings.HasSuffix(got, "\n"+`{"type":"object"}`) {
+			t.Errorf("OutputSchemaInstruction = %q", got)
+		}
+	})
+	t.Run("template", func(t *testing.T) {
+		if err := SetOverride(NameDecisionResponse, `Pick for {{.Name}} via {{.CLI}}{{if .Model}} ({{.Model}}){{end}}.`, "test"); err != nil {
+			t.Fatal(err)
+		}
+		if got := Render(NameDecisionResponse, Data{Name: "Decision", CLI: "CLAUDE"}); got != "Pick for Decision via CLAUDE." {
+			t.Errorf("Render = %q", got)
+		}
+		if _, source := Effective(NameDecisionResponse); source != "test" {
+			t.Errorf("source = %q, want test", source)
+		}
+		ResetOverrides()
+		if got := DecisionResponseInstruction(); got != decisionResponseText {
+			t.Errorf("after reset = %q", got)
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		if err := SetOverride("nope", "x", ""); err == nil || !strings.Contains(err.Error(), "unknown prompt") {
+			t.Errorf("SetOverride(unknown) = %v", err)
+		}
+		if err := SetOverride(NameValidate, "{{.Name", ""); err == nil {
+			t.Error("SetOverride(bad syntax) = nil")
+		}
+		if err := SetOverride(NameValidate, "{{.Missing}}", ""); err == nil {
+			t.Error("SetOverride(unknown field) = nil")
+		}
+	})
+	t.Run("render_error", func(t *testing.T) {
+		var warnings bytes.Buffer
+		Warnings = &warnings
+		t.Cleanup(func() { Warnings = os.Stderr })
+		// Passes SetOverride's test run (empty Name) but fails for a short name.
+		if err := SetOverride(NameDecisionResponse, `{{if .Name}}{{index .Name 99}}{{end}}`, "decision.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if got := Render(NameDecisionResponse, Data{Name: "Decision"}); got != decisionResponseText {
+			t.Errorf("Render = %q, want the built-in prompt", got)
+		}
+		if !strings.Contains(warnings.String(), "prompt decision_response (decision.txt)") {
+			t.Errorf("Warnings = %q", warnings.String())
+		}
+	})
+}
+
+func TestLoadOverrides(t *testing.T) {
+	t.Cleanup(ResetOverrides)
+	dir := t.TempDir()
+	explicit := filepath.Join(t.TempDir(), "validate.tmpl")
+	for path, content := range map[string]string{
+		filepath.Join(dir, "validate.txt"):            "from dir",
+		filepath.Join(dir, "validation_response.txt"): "Answer as JSON for {{.Name}}.",
+		explicit: "Check {{.Prompt}} carefully.",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loaded, err := LoadOverrides(dir, map[string]string{NameValidate: explicit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(loaded, ",") != "validate,validation_response" {
+		t.Errorf("loaded = %v", loaded)
+	}
+	if got := Render(NameValidate, Data{Prompt: "the fix"}); got != "Check the fix carefully." {
+		t.Errorf("validate = %q, want explicit file over dir", got)
+	}
+	if _, err := LoadOverrides(dir, map[string]string{NameOutputSchema: filepath.Join(dir, "missing.txt")}); err == nil {
+		t.Error("LoadOverrides(missing file) err = nil")
+	}
+}
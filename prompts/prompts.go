@@ -11,27 +11,40 @@ var defaultValidatePrompt string
 // DefaultValidatePrompt returns the default validation prompt used for processed nodes
 // when the NoValidation tag is not present.
 func DefaultValidatePrompt() string {
-	return strings.TrimSpace(defaultValidatePrompt)
+	return Render(NameValidate, Data{})
 }
 
 // ProcessResponseInstruction returns prompt text that instructs the CLI to respond
 // with a JSON object matching ProcessResponse (completed, secs_taken, tokens_used, comments).
 // Used for childless (leaf) nodes.
 func ProcessResponseInstruction() string {
-	return "Respond with only a JSON object with keys: completed (boolean), secs_taken (number), tokens_used (number), comments (array of strings). Do not include any explanation, markdown, or text before or after the JSON — output only the single JSON object."
+	return Render(NameProcessResponse, Data{})
 }
 
 // DecisionResponseInstruction returns prompt text that instructs the CLI to respond
 // with a JSON object matching DecisionResponse (choices, answer, reasons).
 // Used for nodes that have children (decision nodes).
 func DecisionResponseInstruction() string {
-	return "Respond with only a JSON object with keys: choices (array of strings), answer (string), reasons (array of strings). Do not include any explanation, markdown, or text before or after the JSON — output only the single JSON object."
+	return Render(NameDecisionResponse, Data{})
 }
 
 // ValidationResponseInstruction returns prompt text that instructs the CLI to respond
 // with a JSON object matching ValidationResponse (fully_completed, partially_completed, should_retry, warnings).
 // Used when running the validation prompt after a node completes.
 func ValidationResponseInstruction() string {
-	return "Respond with only a JSON object with keys: fully_completed (boolean), partially_completed (boolean), should_retry (boolean), warnings (array of strings). Do not include any explanation, markdown, or text before or after the JSON — output only the single JSON object."
+	return Render(NameValidationResponse, Data{})
 }
 
+// OutputSchemaInstruction returns prompt text that instructs the CLI to include an
+// "output" key in its ProcessResponse JSON whose value conforms to the given JSON Schema.
+// Used for process nodes that declare an output_schema.
+func OutputSchemaInstruction(schema string) string {
+	return Render(NameOutputSchema, Data{OutputSchema: strings.TrimSpace(schema)})
+}
+
+const (
+	processResponseText    = "Respond with only a JSON object with keys: completed (boolean), secs_taken (number), tokens_used (number), comments (array of strings). Do not include any explanation, markdown, or text before or after the JSON — output only the single JSON object."
+	decisionResponseText   = "Respond with only a JSON object with keys: choices (array of strings), answer (string), reasons (array of strings). Do not include any explanation, markdown, or text before or after the JSON — output only the single JSON object."
+	validationResponseText = "Respond with only a JSON object with keys: fully_completed (boolean), partially_completed (boolean), should_retry (boolean), warnings (array of strings). Do not include any explanation, markdown, or text before or after the JSON — output only the single JSON object."
+	outputSchemaText       = "Also include an output key in the JSON object whose value is your structured result and conforms to this JSON Schema:\n{{.OutputSchema}}"
+)
@@ -0,0 +1,13 @@
+// Package schemas publishes the JSON Schemas of the files MonadsCLI writes for other tools.
+package schemas
+
+import _ "embed"
+
+//go:embed short-log.schema.json
+var shortLog []byte
+
+// ShortLog returns the JSON Schema of the run-tree short log (short.json in a run directory), schema_version
+// runlog.ShortLogSchemaVersion.
+func ShortLog() []byte {
+	return append([]byte(nil), shortLog...)
+}
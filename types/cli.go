@@ -9,4 +9,23 @@ type CLI struct {
 	Command  string `json:"command"`
 	Prompt   string `json:"prompt"`
 	Install  string `json:"install"`
+
+	// NativePrompt is the Prompt template with the CLI's machine-readable output mode enabled; empty when unsupported.
+	NativePrompt string `json:"nativePrompt,omitempty"`
+	// OutputFormat names the envelope NativePrompt produces (OutputFormatResultJSON, OutputFormatGeminiJSON).
+	OutputFormat string `json:"outputFormat,omitempty"`
+
+	// ModelFlag is the flag that selects a model (e.g. "--model"); empty when the CLI has no model selection.
+	ModelFlag string `json:"modelFlag,omitempty"`
+	// Models lists accepted model names; an entry ending in "*" matches any name with that prefix.
+	// Empty with a ModelFlag means any model name is accepted.
+	Models []string `json:"models,omitempty"`
 }
+
+const (
+	// OutputFormatResultJSON is the {"type":"result","result":...} envelope printed by Claude
+	// (--output-format json or stream-json) and Cursor (--output-format json).
+	OutputFormatResultJSON = "result-json"
+	// OutputFormatGeminiJSON is the {"response":...,"stats":...} envelope printed by Gemini (--output-format json).
+	OutputFormatGeminiJSON = "gemini-json"
+)
@@ -8,6 +8,11 @@ var GeminiCLI = CLI{
 	Command:  "gemini",
 	Prompt:   "gemini --yolo -p \"<prompt>\"",
 	Install:  "npm install -g @google/gemini-cli",
+
+	NativePrompt: "gemini --yolo --output-format json -p \"<prompt>\"",
+	OutputFormat: OutputFormatGeminiJSON,
+	ModelFlag:    "--model",
+	Models:       []string{"gemini-*"},
 }
 
 var CursorCLI = CLI{
@@ -18,6 +23,11 @@ var CursorCLI = CLI{
 	Command:  "agent",
 	Prompt:   "agent -p --force \"<prompt>\"",
 	Install:  "curl https://cursor.com/install -fsS | bash",
+
+	NativePrompt: "agent -p --force --output-format json \"<prompt>\"",
+	OutputFormat: OutputFormatResultJSON,
+	ModelFlag:    "--model",
+	Models:       []string{"auto", "composer-*", "sonnet-*", "opus-*", "gpt-*", "gemini-*", "grok*"},
 }
 
 var ClaudeCLI = CLI{
@@ -28,6 +38,11 @@ var ClaudeCLI = CLI{
 	Command:  "claude",
 	Prompt:   "claude -p \"<prompt>\" --dangerously-skip-permissions",
 	Install:  "npm install -g @anthropic-ai/claude-code",
+
+	NativePrompt: "claude -p \"<prompt>\" --output-format json --dangerously-skip-permissions",
+	OutputFormat: OutputFormatResultJSON,
+	ModelFlag:    "--model",
+	Models:       []string{"sonnet", "opus", "haiku", "opusplan", "claude-*"},
 }
 
 var CopilotCLI = CLI{
@@ -38,6 +53,9 @@ var CopilotCLI = CLI{
 	Command:  "copilot",
 	Prompt:   "copilot -p \"<prompt>\" --allow-all-tools",
 	Install:  "npm install -g @github/copilot",
+
+	ModelFlag: "--model",
+	Models:    []string{"claude-*", "gpt-*", "gemini-*"},
 }
 
 var AiderCLI = CLI{
@@ -48,6 +66,8 @@ var AiderCLI = CLI{
 	Command:  "aider",
 	Prompt:   "aider --yes -m \"<prompt>\"",
 	Install:  "python -m pip install -U \"tree-sitter-yaml @ git+https://github.com/tree-sitter-grammars/tree-sitter-yaml.git@v0.7.1\" && python -m pip install -U aider-chat",
+
+	ModelFlag: "--model", // Aider accepts any LiteLLM model name.
 }
 
 var QodoCLI = CLI{
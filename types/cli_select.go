@@ -39,6 +39,62 @@ func SelectCLIs(names []string) ([]CLI, error) {
 	return selected, nil
 }
 
+// KeyENVNames returns the variable names of the CLI's API keys (KeyENV, comma-separated).
+func KeyENVNames(cli CLI) []string {
+	var out []string
+	for _, k := range strings.Split(cli.KeyENV, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// IsCLIKeyENV reports whether name is an API key variable of any known CLI.
+func IsCLIKeyENV(name string) bool {
+	for _, cli := range AllCLIs {
+		for _, k := range KeyENVNames(cli) {
+			if k == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func normalizeCLIKey(value string) string {
 	return strings.ToLower(strings.TrimSpace(value))
 }
+
+// CheckModel returns an error when cli cannot run the given model: the CLI has no
+// ModelFlag, or the name matches neither cli.Models nor extra (e.g. from MODELS_<CODENAME>).
+// An entry ending in "*" matches by prefix. A CLI with a ModelFlag and no Models accepts any name.
+func CheckModel(cli CLI, model string, extra []string) error {
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return nil
+	}
+	if cli.ModelFlag == "" {
+		return fmt.Errorf("%s does not support model selection (model %q)", cli.Name, model)
+	}
+	if strings.ContainsAny(model, " \t\r\n\"'`$;|&<>") {
+		return fmt.Errorf("invalid model name %q for %s", model, cli.Name)
+	}
+	allowed := append(append([]string{}, cli.Models...), extra...)
+	if len(cli.Models) == 0 {
+		return nil
+	}
+	for _, pattern := range allowed {
+		pattern = strings.TrimSpace(pattern)
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(model, strings.TrimSuffix(pattern, "*")) {
+				return nil
+			}
+			continue
+		}
+		if pattern == model {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown model %q for %s (known: %s; add more with MODELS_%s)", model, cli.Name, strings.Join(allowed, ", "), cli.Codename)
+}
@@ -0,0 +1,174 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxReportedRejections caps how many rejected candidates an ExtractError lists in its message.
+const maxReportedRejections = 5
+
+// Rejection records why one JSON candidate found in agent output was not used.
+type Rejection struct {
+	Offset  int    // byte offset of the candidate's opening brace in the trimmed output
+	Snippet string // shortened candidate text
+	Reason  string
+}
+
+// ExtractError is returned when no JSON object in agent output decodes into the target
+// response type with its required keys. Rejections are ordered from last to first in the output.
+type ExtractError struct {
+	Target     string
+	Rejections []Rejection
+}
+
+func (e *ExtractError) Error() string {
+	if len(e.Rejections) == 0 {
+		return fmt.Sprintf("no JSON object found in output for %s", e.Target)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "no usable JSON object for %s (%d candidate(s) rejected)", e.Target, len(e.Rejections))
+	for i, r := range e.Rejections {
+		if i == maxReportedRejections {
+			fmt.Fprintf(&b, "; ... %d more", len(e.Rejections)-i)
+			break
+		}
+		fmt.Fprintf(&b, "; at offset %d %s: %s", r.Offset, r.Snippet, r.Reason)
+	}
+	return b.String()
+}
+
+// jsonCandidate is a balanced {...} span in agent output.
+type jsonCandidate struct {
+	start int
+	end   int // exclusive
+}
+
+// scanJSONObjects returns every balanced JSON-looking object in s, including objects
+// nested inside other objects. A candidate starts at a '{' whose next non-space byte is
+// '"' or '}', which skips braces in prose and code. Braces inside JSON strings are ignored.
+func scanJSONObjects(s string) []jsonCandidate {
+	var out []jsonCandidate
+	for i := 0; i < len(s); i++ {
+		if s[i] != '{' || !looksLikeObjectStart(s, i) {
+			continue
+		}
+		if end := matchBrace(s, i); end > 0 {
+			out = append(out, jsonCandidate{start: i, end: end})
+		}
+	}
+	return out
+}
+
+func looksLikeObjectStart(s string, i int) bool {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '"', '}':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// matchBrace returns the index just past the '}' that closes the '{' at start, or -1.
+func matchBrace(s string, start int) int {
+	depth := 0
+	inString := false
+	escaped := false
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// extractJSON finds the last JSON object in output that decodes into v and contains all
+// required keys, and stores it in v. v must be a non-nil pointer. Candidates are tried by
+// end position, latest first, so an object printed after other JSON (tool calls, logs,
+// echoed examples) wins. On failure the returned *ExtractError explains each rejection.
+func extractJSON(output string, v interface{}, required ...string) error {
+	target := reflect.TypeOf(v).Elem()
+	trimmed := strings.TrimSpace(output)
+	candidates := scanJSONObjects(trimmed)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].end != candidates[j].end {
+			return candidates[i].end > candidates[j].end
+		}
+		return candidates[i].start < candidates[j].start
+	})
+	extractErr := &ExtractError{Target: target.Name()}
+	for _, c := range candidates {
+		text := trimmed[c.start:c.end]
+		reason := decodeCandidate(text, target, v, required)
+		if reason == "" {
+			return nil
+		}
+		extractErr.Rejections = append(extractErr.Rejections, Rejection{
+			Offset:  c.start,
+			Snippet: snippet(text),
+			Reason:  reason,
+		})
+	}
+	return extractErr
+}
+
+// decodeCandidate decodes text into v when it is a JSON object with every required key.
+// It returns an empty string on success or the reason the candidate was rejected.
+func decodeCandidate(text string, target reflect.Type, v interface{}, required []string) string {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &keys); err != nil {
+		return "invalid JSON: " + err.Error()
+	}
+	var missing []string
+	for _, k := range required {
+		if _, ok := keys[k]; !ok {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		return "missing required key(s): " + strings.Join(missing, ", ")
+	}
+	fresh := reflect.New(target)
+	if err := json.Unmarshal([]byte(text), fresh.Interface()); err != nil {
+		return "does not match " + target.Name() + ": " + err.Error()
+	}
+	reflect.ValueOf(v).Elem().Set(fresh.Elem())
+	return ""
+}
+
+func snippet(text string) string {
+	const max = 60
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > max {
+		text = text[:max] + "..."
+	}
+	return text
+}
@@ -0,0 +1,76 @@
+package types
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExtractJSON(t *testing.T) {
+	t.Run("nested_object_in_response", func(t *testing.T) {
+		stdout := `Done. {"completed": true, "comments": [], "output": {"files": ["a.go"], "meta": {"n": 1}}}`
+		p, err := ParseProcessResponse(stdout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.Completed || !strings.Contains(string(p.Output), `"meta"`) {
+			t.Errorf("ParseProcessResponse = %+v", p)
+		}
+	})
+	t.Run("prefers_last_valid_blob", func(t *testing.T) {
+		stdout := "Example: {\"answer\": \"A\", \"choices\": [\"A\"]}\n" +
+			"tool_call {\"name\": \"read_file\", \"args\": {\"path\": \"x\"}}\n" +
+			"```json\n{\"choices\": [\"A\", \"B\"], \"answer\": \"B\", \"reasons\": [\"}\"]}\n```\n" +
+			"Thanks!"
+		d, err := ParseDecisionResponse(stdout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Answer != "B" {
+			t.Errorf("Answer = %q, want B (last valid object)", d.Answer)
+		}
+	})
+	t.Run("inner_object_of_wrapper", func(t *testing.T) {
+		stdout := `{"type": "result", "result": {"fully_completed": true, "warnings": []}, "session": "abc"}`
+		v, err := ParseValidationResponse(stdout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !v.FullyCompleted {
+			t.Error("FullyCompleted want true from nested object")
+		}
+	})
+	t.Run("braces_in_prose_ignored", func(t *testing.T) {
+		stdout := "func main() { fmt.Println(\"{\") }\n{\"completed\": true}"
+		p, err := ParseProcessResponse(stdout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.Completed {
+			t.Error("Completed want true")
+		}
+	})
+	t.Run("rejection_reasons", func(t *testing.T) {
+		stdout := `{"completed": "yes"} and {"comments": []}`
+		_, err := ParseProcessResponse(stdout)
+		var extractErr *ExtractError
+		if !errors.As(err, &extractErr) {
+			t.Fatalf("err = %v, want *ExtractError", err)
+		}
+		if extractErr.Target != "ProcessResponse" || len(extractErr.Rejections) != 2 {
+			t.Fatalf("ExtractError = %+v", extractErr)
+		}
+		if !strings.Contains(extractErr.Rejections[0].Reason, "missing required key(s): completed") {
+			t.Errorf("first rejection = %q", extractErr.Rejections[0].Reason)
+		}
+		if !strings.Contains(extractErr.Rejections[1].Reason, "does not match ProcessResponse") {
+			t.Errorf("second rejection = %q", extractErr.Rejections[1].Reason)
+		}
+	})
+	t.Run("no_candidates", func(t *testing.T) {
+		_, err := ParseProcessResponse("nothing here")
+		if err == nil || !strings.Contains(err.Error(), "no JSON object found") {
+			t.Errorf("err = %v, want no JSON object found", err)
+		}
+	})
+}
@@ -41,4 +41,13 @@ type Document struct {
 	Title  string `json:"title,omitempty"`
 	Status string `json:"status,omitempty"`
 	Root   *Node  `json:"root,omitempty"`
+
+	// Metadata: custom key-values on the document itself (e.g. CSV columns on the Document row).
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Inputs: declared tree parameters (document metadata key "inputs"), referenced as {{vars.name}}.
+	Inputs []Input `json:"inputs,omitempty"`
 }
+
+// DocumentInputsKey is the document metadata key holding the JSON array of Input declarations.
+const DocumentInputsKey = "inputs"
@@ -39,19 +39,30 @@ func canonicalTag(s string) string {
 type NodeVariableField int
 
 const (
-	FieldCLI            NodeVariableField = iota // CLI codename for running the node (DEFAULT_CLI)
-	FieldValidatePrompt                          // Custom validation prompt text (not a default setting)
-	FieldValidateCLI                             // CLI codename for validation (DEFAULT_VALIDATE_CLI)
-	FieldRetries                                 // Max retry count (DEFAULT_RETRY_COUNT)
-	FieldRetryCLI                                // CLI codename for retries (DEFAULT_RETRY_CLI)
-	FieldTimeout                                 // Timeout in seconds for CLI operations (DEFAULT_TIMEOUT)
+	FieldCLI                NodeVariableField = iota // CLI codename for running the node (DEFAULT_CLI)
+	FieldValidatePrompt                              // Custom validation prompt text (not a default setting)
+	FieldValidateCLI                                 // CLI codename for validation (DEFAULT_VALIDATE_CLI)
+	FieldRetries                                     // Max retry count (DEFAULT_RETRY_COUNT)
+	FieldRetryCLI                                    // CLI codename for retries (DEFAULT_RETRY_CLI)
+	FieldTimeout                                     // Timeout in seconds for CLI operations (DEFAULT_TIMEOUT)
+	FieldOutputSchema                                // JSON Schema (inline or file path) for the node's structured output
+	FieldMaxCalls                                    // Max agent invocations (run + validate + retries) for the node
+	FieldModel                                       // Model name for running the node (DEFAULT_MODEL_<CODENAME>)
+	FieldPromptFile                                  // File whose contents replace the node text as the prompt
+	FieldValidatePromptFile                          // File whose contents are the validation prompt
+	FieldContextFiles                                // Glob patterns of files appended to the prompt as context
+	FieldPreamble                                    // Text prepended to every prompt (usually set on the document)
+	FieldAllowedPaths                                // Glob patterns of the only paths the agent may change
+	FieldProtectedPaths                              // Glob patterns of paths the agent must not change
+	FieldEnv                                         // Extra environment variables for the node's agent invocations
+	FieldApprovalTimeout                             // Seconds an approval node waits for an answer (APPROVAL_TIMEOUT)
 )
 
 // NodeVariableRegistry is the single map of all node metadata variable names
 // that affect ProcessedNode. There is one variable per "default" setting in
 // readme/settings.md (cli, validate_cli, retries, retry_cli, timeout), plus
-// validate_prompt and the cli alias "codename". Keys are canonical (lowercase);
-// lookup from Node.Metadata is case-insensitive.
+// validate_prompt, output_schema, max_calls, model, prompt_file, validate_prompt_file, context_files,
+// preamble, allowed_paths, protected_paths, env, approval_timeout, and the cli alias "codename". Keys are canonical (lowercase); lookup from Node.Metadata is case-insensitive.
 var NodeVariableRegistry = map[string]NodeVariableField{
 	"cli":             FieldCLI,
 	"codename":        FieldCLI,
@@ -60,6 +71,18 @@ var NodeVariableRegistry = map[string]NodeVariableField{
 	"retries":         FieldRetries,
 	"retry_cli":       FieldRetryCLI,
 	"timeout":         FieldTimeout,
+	"output_schema":   FieldOutputSchema,
+	"max_calls":       FieldMaxCalls,
+	"model":           FieldModel,
+
+	"prompt_file":          FieldPromptFile,
+	"validate_prompt_file": FieldValidatePromptFile,
+	"context_files":        FieldContextFiles,
+	"preamble":             FieldPreamble,
+	"allowed_paths":        FieldAllowedPaths,
+	"protected_paths":      FieldProtectedPaths,
+	"env":                  FieldEnv,
+	"approval_timeout":     FieldApprovalTimeout,
 }
 
 // KnownCLICodenames returns the set of all known CLI codenames (uppercase).
@@ -100,7 +123,21 @@ type resolvedNodeValues struct {
 	Retries        int
 	RetryCLI       string
 	Timeout        int   // seconds; 0 = use runner default
+	OutputSchema   string
+	MaxCalls       int // 0 = unlimited
+	Model          string
 	NoValidation   bool
+
+	PromptFile         string
+	ValidatePromptFile string
+	ContextFiles       []string
+	Preamble           string
+	AllowedPaths       []string
+	ProtectedPaths     []string
+	Env                string
+	Approval           bool
+	ApprovalTimeout    int // seconds; 0 = APPROVAL_TIMEOUT
+	Human              bool
 }
 
 func resolveNodeValues(n *Node, defaultValidatePrompt string, knownCodenames map[string]struct{}, defaults *ProcessedNodeDefaults) resolvedNodeValues {
@@ -123,12 +160,31 @@ func resolveNodeValues(n *Node, defaultValidatePrompt string, knownCodenames map
 		return out
 	}
 
+	// Document metadata (ProcessedNodeDefaults.Metadata): below tags and node metadata, above settings
+	if defaults != nil {
+		applyMetadata(&out, documentDefaults(defaults.Metadata))
+	}
+
 	// NoValidation tag → skip validation (clear ValidatePrompt)
 	if hasTag(n, TagNoValidation) {
 		out.NoValidation = true
 		out.ValidatePrompt = ""
 	}
 
+	// Approval tag or shape → human approval gate; nothing to validate
+	if hasTag(n, TagApproval) || canonicalTag(n.Label) == canonicalTag(TagApproval) {
+		out.Approval = true
+		out.NoValidation = true
+		out.ValidatePrompt = ""
+	}
+
+	// Human tag → a person picks the route; nothing to validate
+	if hasTag(n, TagHuman) {
+		out.Human = true
+		out.NoValidation = true
+		out.ValidatePrompt = ""
+	}
+
 	// CLI from tag: any tag that is a known codename overrides default
 	for _, tag := range n.Tags {
 		tag = strings.TrimSpace(tag)
@@ -143,34 +199,7 @@ func resolveNodeValues(n *Node, defaultValidatePrompt string, knownCodenames map
 	}
 
 	// Metadata variables (single map: NodeVariableRegistry)
-	if n.Metadata != nil {
-		for canonKey, field := range NodeVariableRegistry {
-			val, ok := metadataGet(n.Metadata, canonKey)
-			if !ok || val == "" {
-				continue
-			}
-			switch field {
-			case FieldCLI:
-				out.CLI = strings.ToUpper(strings.TrimSpace(val))
-			case FieldValidatePrompt:
-				if !out.NoValidation {
-					out.ValidatePrompt = val
-				}
-			case FieldValidateCLI:
-				out.ValidateCLI = strings.ToUpper(strings.TrimSpace(val))
-			case FieldRetries:
-				if i, err := strconv.Atoi(strings.TrimSpace(val)); err == nil && i >= 0 {
-					out.Retries = i
-				}
-			case FieldRetryCLI:
-				out.RetryCLI = strings.ToUpper(strings.TrimSpace(val))
-			case FieldTimeout:
-				if i, err := strconv.Atoi(strings.TrimSpace(val)); err == nil && i >= 0 {
-					out.Timeout = i
-				}
-			}
-		}
-	}
+	applyMetadata(&out, n.Metadata)
 
 	// Apply defaults from settings when not set by node (tag or metadata)
 	if defaults != nil {
@@ -192,7 +221,110 @@ func resolveNodeValues(n *Node, defaultValidatePrompt string, knownCodenames map
 	// If NoValidation was set by tag, keep ValidatePrompt empty (already set above)
 	if out.NoValidation {
 		out.ValidatePrompt = ""
+		out.ValidatePromptFile = ""
+	}
+
+	return out
+}
+
+// splitPatterns splits a context_files, allowed_paths, or protected_paths value on commas and newlines, dropping empty entries.
+func splitPatterns(val string) []string {
+	var out []string
+	for _, p := range strings.FieldsFunc(val, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
 	}
+	return out
+}
 
+// applyMetadata sets out from the registry variables in metadata. A validate_prompt clears an
+// inherited validate_prompt_file; when both are set at the same level the file wins.
+func applyMetadata(out *resolvedNodeValues, metadata map[string]string) {
+	if len(metadata) == 0 {
+		return
+	}
+	if v, ok := metadataGet(metadata, "validate_prompt"); ok && v != "" {
+		out.ValidatePromptFile = ""
+	}
+	for canonKey, field := range NodeVariableRegistry {
+		val, ok := metadataGet(metadata, canonKey)
+		if !ok || val == "" {
+			continue
+		}
+		switch field {
+		case FieldCLI:
+			out.CLI = strings.ToUpper(strings.TrimSpace(val))
+		case FieldValidatePrompt:
+			if !out.NoValidation {
+				out.ValidatePrompt = val
+			}
+		case FieldValidateCLI:
+			out.ValidateCLI = strings.ToUpper(strings.TrimSpace(val))
+		case FieldRetries:
+			if i, err := strconv.Atoi(strings.TrimSpace(val)); err == nil && i >= 0 {
+				out.Retries = i
+			}
+		case FieldRetryCLI:
+			out.RetryCLI = strings.ToUpper(strings.TrimSpace(val))
+		case FieldTimeout:
+			if i, err := strconv.Atoi(strings.TrimSpace(val)); err == nil && i >= 0 {
+				out.Timeout = i
+			}
+		case FieldOutputSchema:
+			out.OutputSchema = val
+		case FieldMaxCalls:
+			if i, err := strconv.Atoi(strings.TrimSpace(val)); err == nil && i >= 0 {
+				out.MaxCalls = i
+			}
+		case FieldModel:
+			out.Model = val
+		case FieldPromptFile:
+			out.PromptFile = val
+		case FieldValidatePromptFile:
+			if !out.NoValidation {
+				out.ValidatePromptFile = val
+			}
+		case FieldContextFiles:
+			out.ContextFiles = splitPatterns(val)
+		case FieldPreamble:
+			out.Preamble = val
+		case FieldAllowedPaths:
+			out.AllowedPaths = splitPatterns(val)
+		case FieldProtectedPaths:
+			out.ProtectedPaths = splitPatterns(val)
+		case FieldEnv:
+			out.Env = val
+		case FieldApprovalTimeout:
+			if i, err := strconv.Atoi(strings.TrimSpace(val)); err == nil && i >= 0 {
+				out.ApprovalTimeout = i
+			}
+		}
+	}
+}
+
+// DocumentDefaultKeys are the metadata variables a document may set for every node.
+// Node-specific variables (prompt_file, output_schema) are ignored at document level.
+var DocumentDefaultKeys = []string{
+	"cli", "codename", "validate_prompt", "validate_prompt_file", "validate_cli", "retries",
+	"retry_cli", "timeout", "max_calls", "model", "context_files", "preamble",
+	"allowed_paths", "protected_paths", "env", "approval_timeout",
+}
+
+// documentDefaults returns the DocumentDefaultKeys entries of document metadata.
+func documentDefaults(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(DocumentDefaultKeys))
+	for _, k := range DocumentDefaultKeys {
+		allowed[k] = true
+	}
+	out := make(map[string]string)
+	for k, v := range metadata {
+		if allowed[canonicalMetadataKey(k)] {
+			out[k] = v
+		}
+	}
 	return out
 }
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"strings"
 
 	"github.com/ryanmontgomery/MonadsCLI/prompts"
@@ -10,6 +11,14 @@ import (
 // ValidatePrompt is left empty (validation is skipped).
 const TagNoValidation = "NoValidation"
 
+// TagApproval is a functional tag. A node with it (or whose shape is named "Approval") runs no
+// agent: the run pauses for a person to approve, reject, or edit before continuing.
+const TagApproval = "Approval"
+
+// TagHuman is a functional tag. On a decision node it makes a person choose the route (on the
+// terminal or from --answer / --answers) instead of an agent.
+const TagHuman = "Human"
+
 // AvailableTags provides behavioral descriptions for each supported functional tag.
 // Implementations hold the set of known tags and return a description for any tag name.
 type AvailableTags interface {
@@ -32,6 +41,17 @@ type ProcessedNodeDefaults struct {
 	RetryCLI    string // DEFAULT_RETRY_CLI
 	Retries     int    // DEFAULT_RETRY_COUNT; 0 = use 3
 	Timeout     int    // DEFAULT_TIMEOUT (seconds); 0 = use runner default
+
+	// Vars are the tree inputs for {{vars.name}}; LookupEnv resolves {{env.NAME}} (nil = os.LookupEnv).
+	// LookupEnvMetadata resolves {{env.NAME}} in env metadata, whose values go to the agent's
+	// environment instead of its prompt (nil = LookupEnv).
+	Vars              map[string]string
+	LookupEnv         func(string) (string, bool)
+	LookupEnvMetadata func(string) (string, bool)
+
+	// Metadata is document-level metadata (Document.Metadata). Its DocumentDefaultKeys apply to
+	// every node, above these settings defaults and below the node's own tags and metadata.
+	Metadata map[string]string
 }
 
 // ProcessedNode is a recursive linked-list style type for processed document
@@ -49,11 +69,53 @@ type ProcessedNode struct {
 	Retries        int    `json:"retries,omitempty"`       // Max retry count (DEFAULT_RETRY_COUNT).
 	Timeout        int    `json:"timeout,omitempty"`      // Timeout in seconds for CLI ops (DEFAULT_TIMEOUT); 0 = default.
 	Retried        int    `json:"retried,omitempty"`      // Number of retries so far (runtime).
+	OutputSchema   string `json:"output_schema,omitempty"` // JSON Schema for ProcessResponse.Output (inline JSON or file path).
+	MaxCalls       int    `json:"max_calls,omitempty"`     // Max agent invocations (run + validate + retries); 0 = unlimited.
+	Model          string `json:"model,omitempty"`         // Model for run and retries on the node's CLI; empty = DEFAULT_MODEL_<CODENAME>.
+	Preamble       string `json:"preamble,omitempty"`      // Text prepended to the run, retry, and validation prompts (document preamble).
+
+	// Files: prompt_file / validate_prompt_file paths and context_files globs, loaded into
+	// Prompt, ValidatePrompt, and Context before the run (run.LoadNodeFiles). Context goes with
+	// the run and retry prompts only, not the validation prompt's copy of the task.
+	PromptFile         string   `json:"prompt_file,omitempty"`
+	ValidatePromptFile string   `json:"validate_prompt_file,omitempty"`
+	ContextFiles       []string `json:"context_files,omitempty"`
+	Context            string   `json:"context,omitempty"`
+
+	// Path guardrails: glob patterns (relative to the workdir) checked against the files each
+	// attempt changed. Empty AllowedPaths allows everything not protected.
+	AllowedPaths   []string `json:"allowed_paths,omitempty"`
+	ProtectedPaths []string `json:"protected_paths,omitempty"`
+
+	// Env: extra environment for the node's agent invocations, as KEY=VALUE lines or a JSON
+	// object (parsed by run.NodeEnv). Each invocation otherwise gets only a base environment.
+	Env string `json:"env,omitempty"`
+
+	// Approval: the node is a human approval gate (TagApproval); its text is shown as the question.
+	// ApprovalTimeout is how long to wait for an answer in seconds; 0 = APPROVAL_TIMEOUT.
+	Approval        bool `json:"approval,omitempty"`
+	ApprovalTimeout int  `json:"approval_timeout,omitempty"`
+
+	// Human: a person chooses this decision node's route (TagHuman); no agent runs.
+	Human bool `json:"human,omitempty"`
+
+	// UndefinedVars: {{vars.x}} / {{env.X}} references in the node that had no value; reported by preflight.
+	UndefinedVars []string `json:"undefined_vars,omitempty"`
+
+	// Inputs: structured outputs of the nodes that ran before this one (runtime).
+	Inputs []NodeOutput `json:"inputs,omitempty"`
 
 	// Children: route name -> child processed node.
 	Children map[string]*ProcessedNode `json:"children,omitempty"`
 }
 
+// NodeOutput is the structured output (ProcessResponse.Output) produced by a node
+// with an output schema, passed to later nodes as context.
+type NodeOutput struct {
+	Node   string          `json:"node"`
+	Output json.RawMessage `json:"output"`
+}
+
 // hasTag returns whether the node has the given tag.
 // Tag matching is case-insensitive and snake/camel-safe.
 func hasTag(n *Node, tag string) bool {
@@ -82,31 +144,99 @@ func NodeToProcessedNodeWithDefaults(n *Node, defaults *ProcessedNodeDefaults) *
 	if n == nil {
 		return nil
 	}
-	defaultValidate := prompts.DefaultValidatePrompt()
 	codenames := KnownCLICodenames()
-	return nodeToProcessedNodeWith(n, defaultValidate, codenames, defaults)
+	var docUndefined []string
+	if defaults != nil && len(defaults.Metadata) > 0 {
+		cp := *defaults
+		cp.Metadata = make(map[string]string, len(defaults.Metadata))
+		for k, v := range documentDefaults(defaults.Metadata) {
+			val, missing := Interpolate(v, defaults.Vars, envLookupFor(defaults, k))
+			cp.Metadata[k] = val
+			docUndefined = append(docUndefined, missing...)
+		}
+		defaults = &cp
+	}
+	out := nodeToProcessedNodeWith(n, codenames, defaults)
+	if len(docUndefined) > 0 {
+		// Document-level references are reported once, on the root.
+		out.UndefinedVars = uniqueSorted(append(out.UndefinedVars, docUndefined...))
+	}
+	return out
 }
 
-func nodeToProcessedNodeWith(n *Node, defaultValidate string, codenames map[string]struct{}, defaults *ProcessedNodeDefaults) *ProcessedNode {
+func nodeToProcessedNodeWith(n *Node, codenames map[string]struct{}, defaults *ProcessedNodeDefaults) *ProcessedNode {
 	if n == nil {
 		return nil
 	}
-	res := resolveNodeValues(n, defaultValidate, codenames, defaults)
+	interpolated, undefined := interpolateNode(n, defaults)
+	// The default validation prompt (or its override) sees the node's name and prompt.
+	defaultValidate := prompts.Render(prompts.NameValidate, prompts.Data{Name: strings.TrimSpace(n.Label), Prompt: strings.TrimSpace(interpolated.Text)})
+	res := resolveNodeValues(interpolated, defaultValidate, codenames, defaults)
 	out := &ProcessedNode{
 		Name:           strings.TrimSpace(n.Label),
-		Prompt:         strings.TrimSpace(n.Text),
+		Prompt:         strings.TrimSpace(interpolated.Text),
 		ValidatePrompt: res.ValidatePrompt,
 		CLI:            res.CLI,
 		ValidateCLI:    res.ValidateCLI,
 		RetryCLI:       res.RetryCLI,
 		Retries:        res.Retries,
 		Timeout:        res.Timeout,
+		OutputSchema:   res.OutputSchema,
+		MaxCalls:       res.MaxCalls,
+		Model:          res.Model,
+		Preamble:       res.Preamble,
+		UndefinedVars:  undefined,
+
+		PromptFile:         res.PromptFile,
+		ValidatePromptFile: res.ValidatePromptFile,
+		ContextFiles:       res.ContextFiles,
+
+		AllowedPaths:   res.AllowedPaths,
+		ProtectedPaths: res.ProtectedPaths,
+		Env:            res.Env,
+
+		Approval:        res.Approval,
+		ApprovalTimeout: res.ApprovalTimeout,
+		Human:           res.Human,
 	}
 	if len(n.Children) > 0 {
 		out.Children = make(map[string]*ProcessedNode, len(n.Children))
 		for route, child := range n.Children {
-			out.Children[route] = nodeToProcessedNodeWith(child, defaultValidate, codenames, defaults)
+			out.Children[route] = nodeToProcessedNodeWith(child, codenames, defaults)
 		}
 	}
 	return out
 }
+
+// envLookupFor returns the {{env.NAME}} resolver for the metadata value under key ("" for node
+// text): LookupEnvMetadata for env metadata, else LookupEnv.
+func envLookupFor(defaults *ProcessedNodeDefaults, key string) func(string) (string, bool) {
+	if defaults == nil {
+		return nil
+	}
+	if defaults.LookupEnvMetadata != nil && NodeVariableRegistry[canonicalMetadataKey(key)] == FieldEnv {
+		return defaults.LookupEnvMetadata
+	}
+	return defaults.LookupEnv
+}
+
+// interpolateNode returns a copy of n with {{vars.x}} and {{env.X}} replaced in Text and
+// metadata values, plus the references that had no value.
+func interpolateNode(n *Node, defaults *ProcessedNodeDefaults) (*Node, []string) {
+	var vars map[string]string
+	if defaults != nil {
+		vars = defaults.Vars
+	}
+	cp := *n
+	text, undefined := Interpolate(n.Text, vars, envLookupFor(defaults, ""))
+	cp.Text = text
+	if len(n.Metadata) > 0 {
+		cp.Metadata = make(map[string]string, len(n.Metadata))
+		for k, v := range n.Metadata {
+			val, missing := Interpolate(v, vars, envLookupFor(defaults, k))
+			cp.Metadata[k] = val
+			undefined = append(undefined, missing...)
+		}
+	}
+	return &cp, uniqueSorted(undefined)
+}
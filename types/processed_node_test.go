@@ -2,6 +2,7 @@ package types
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -113,6 +114,26 @@ func TestNodeToProcessedNode(t *testing.T) {
 		}
 	})
 
+	t.Run("Approval tag or shape", func(t *testing.T) {
+		for _, n := range []*Node{
+			{Text: "Push?", Tags: []string{"approval"}, Metadata: map[string]string{"approval_timeout": "120"}},
+			{Label: "Approval", Text: "Push?", Metadata: map[string]string{"approval_timeout": "120"}},
+		} {
+			p := NodeToProcessedNode(n)
+			if !p.Approval || p.ApprovalTimeout != 120 || p.ValidatePrompt != "" {
+				t.Errorf("Approval = %v, ApprovalTimeout = %d, ValidatePrompt = %q; want approval gate with timeout 120 and no validation", p.Approval, p.ApprovalTimeout, p.ValidatePrompt)
+			}
+		}
+	})
+
+	t.Run("Human tag", func(t *testing.T) {
+		n := &Node{Text: "Which approach?", Tags: []string{"human"}}
+		p := NodeToProcessedNode(n)
+		if !p.Human || p.ValidatePrompt != "" {
+			t.Errorf("Human = %v, ValidatePrompt = %q; want human decision without validation", p.Human, p.ValidatePrompt)
+		}
+	})
+
 	t.Run("CLI from tag", func(t *testing.T) {
 		n := &Node{Text: "Use Gemini", Tags: []string{"GEMINI"}}
 		p := NodeToProcessedNode(n)
@@ -281,6 +302,14 @@ func TestNodeToProcessedNode(t *testing.T) {
 		}
 	})
 
+	t.Run("output_schema metadata", func(t *testing.T) {
+		n := &Node{Text: "List files", Metadata: map[string]string{"outputSchema": "schemas/files.json"}}
+		p := NodeToProcessedNode(n)
+		if p.OutputSchema != "schemas/files.json" {
+			t.Errorf("OutputSchema = %q, want schemas/files.json", p.OutputSchema)
+		}
+	})
+
 	t.Run("CLI tag case-insensitive", func(t *testing.T) {
 		n := &Node{Text: "Use Gemini", Tags: []string{"gemini"}}
 		p := NodeToProcessedNode(n)
@@ -291,15 +320,15 @@ func TestNodeToProcessedNode(t *testing.T) {
 }
 
 func TestNodeVariableRegistry_completeness(t *testing.T) {
-	// One metadata variable per default setting in readme/settings.md, plus validate_prompt and codename alias.
-	wantKeys := []string{"cli", "codename", "validate_prompt", "validate_cli", "retries", "retry_cli", "timeout"}
+	// One metadata variable per default setting in readme/settings.md, plus validate_prompt, output_schema, max_calls, model, file keys, preamble, and codename alias.
+	wantKeys := []string{"cli", "codename", "validate_prompt", "validate_cli", "retries", "retry_cli", "timeout", "output_schema", "max_calls", "model", "prompt_file", "validate_prompt_file", "context_files", "preamble", "allowed_paths", "protected_paths", "env", "approval_timeout"}
 	for _, k := range wantKeys {
 		if _, ok := NodeVariableRegistry[k]; !ok {
 			t.Errorf("NodeVariableRegistry missing key %q", k)
 		}
 	}
 	if len(NodeVariableRegistry) != len(wantKeys) {
-		t.Errorf("NodeVariableRegistry has %d entries, want %d (one per default setting + validate_prompt + codename)", len(NodeVariableRegistry), len(wantKeys))
+		t.Errorf("NodeVariableRegistry has %d entries, want %d (one per default setting + validate_prompt + output_schema + max_calls + model + file keys + preamble + path guardrails + env + approval_timeout + codename)", len(NodeVariableRegistry), len(wantKeys))
 	}
 }
 
@@ -328,6 +357,153 @@ func TestEveryDefaultSettingHasMetadataVariable(t *testing.T) {
 	}
 }
 
+func TestModelMetadata(t *testing.T) {
+	n := &Node{Text: "X", Metadata: map[string]string{"cli": "CLAUDE", "model": " haiku "}}
+	if p := NodeToProcessedNode(n); p.Model != "haiku" {
+		t.Errorf("Model = %q, want haiku", p.Model)
+	}
+}
+
+func TestNodeToProcessedNode_interpolation(t *testing.T) {
+	n := &Node{
+		Text:     "Fix {{vars.ticket}}",
+		Metadata: map[string]string{"validate_prompt": "Is {{vars.ticket}} fixed in {{env.REPO}}?", "retries": "{{vars.n}}", "model": "{{vars.model}}"},
+	}
+	defaults := &ProcessedNodeDefaults{
+		Vars:      map[string]string{"ticket": "ABC-1", "n": "5"},
+		LookupEnv: func(k string) (string, bool) { return "", false },
+	}
+	p := NodeToProcessedNodeWithDefaults(n, defaults)
+	if p.Prompt != "Fix ABC-1" {
+		t.Errorf("Prompt = %q, want Fix ABC-1", p.Prompt)
+	}
+	if p.ValidatePrompt != "Is ABC-1 fixed in {{env.REPO}}?" {
+		t.Errorf("ValidatePrompt = %q", p.ValidatePrompt)
+	}
+	if p.Retries != 5 {
+		t.Errorf("Retries = %d, want 5 (from {{vars.n}})", p.Retries)
+	}
+	if want := []string{"env.REPO", "vars.model"}; !reflect.DeepEqual(p.UndefinedVars, want) {
+		t.Errorf("UndefinedVars = %v, want %v", p.UndefinedVars, want)
+	}
+	if n.Text != "Fix {{vars.ticket}}" {
+		t.Errorf("source node was modified: %q", n.Text)
+	}
+}
+
+func TestFileMetadata(t *testing.T) {
+	n := &Node{Text: "X", Metadata: map[string]string{"prompt_file": "p.md", "validate_prompt_file": "v.md", "context_files": "docs/*.md,\n src/**/*.go ,"}}
+	p := NodeToProcessedNode(n)
+	if p.PromptFile != "p.md" || p.ValidatePromptFile != "v.md" {
+		t.Errorf("PromptFile = %q, ValidatePromptFile = %q", p.PromptFile, p.ValidatePromptFile)
+	}
+	if want := []string{"docs/*.md", "src/**/*.go"}; !reflect.DeepEqual(p.ContextFiles, want) {
+		t.Errorf("ContextFiles = %v, want %v", p.ContextFiles, want)
+	}
+	n.Tags = []string{TagNoValidation}
+	if p := NodeToProcessedNode(n); p.ValidatePromptFile != "" {
+		t.Errorf("ValidatePromptFile = %q, want empty with NoValidation", p.ValidatePromptFile)
+	}
+}
+
+func TestPathGuardMetadata(t *testing.T) {
+	n := &Node{Text: "X", Metadata: map[string]string{"allowedPaths": "src/**, docs", "protected_paths": ".github\ngo.mod"}}
+	p := NodeToProcessedNodeWithDefaults(n, &ProcessedNodeDefaults{Metadata: map[string]string{"protected_paths": "secrets/**"}})
+	if want := []string{"src/**", "docs"}; !reflect.DeepEqual(p.AllowedPaths, want) {
+		t.Errorf("AllowedPaths = %v, want %v", p.AllowedPaths, want)
+	}
+	if want := []string{".github", "go.mod"}; !reflect.DeepEqual(p.ProtectedPaths, want) {
+		t.Errorf("ProtectedPaths = %v, want %v (node replaces document)", p.ProtectedPaths, want)
+	}
+	p = NodeToProcessedNodeWithDefaults(&Node{Text: "Y"}, &ProcessedNodeDefaults{Metadata: map[string]string{"protected_paths": "secrets/**"}})
+	if want := []string{"secrets/**"}; !reflect.DeepEqual(p.ProtectedPaths, want) {
+		t.Errorf("ProtectedPaths from document = %v, want %v", p.ProtectedPaths, want)
+	}
+}
+
+func TestDocumentDefaults(t *testing.T) {
+	settingsDefaults := func() *ProcessedNodeDefaults {
+		return &ProcessedNodeDefaults{
+			CLI: "GEMINI", Retries: 3, Timeout: 600,
+			Vars: map[string]string{"repo": "api"},
+			Metadata: map[string]string{
+				"preamble": "You are working in repo {{vars.repo}}.", "cli": "CURSOR", "retries": "1",
+				"timeout": "120", "validate_prompt": "Doc check?", "prompt_file": "ignored.md", "inputs": "[]",
+			},
+		}
+	}
+	t.Run("document_over_settings", func(t *testing.T) {
+		p := NodeToProcessedNodeWithDefaults(&Node{Text: "X"}, settingsDefaults())
+		if p.CLI != "CURSOR" || p.Retries != 1 || p.Timeout != 120 || p.ValidatePrompt != "Doc check?" {
+			t.Errorf("ProcessedNode = %+v, want document defaults", p)
+		}
+		if p.Preamble != "You are working in repo api." {
+			t.Errorf("Preamble = %q", p.Preamble)
+		}
+		if p.PromptFile != "" {
+			t.Errorf("PromptFile = %q, want empty (not a document default)", p.PromptFile)
+		}
+	})
+	t.Run("node_over_document", func(t *testing.T) {
+		n := &Node{Text: "X", Tags: []string{"CLAUDE"}, Metadata: map[string]string{"retries": "4", "preamble": ""}}
+		p := NodeToProcessedNodeWithDefaults(n, settingsDefaults())
+		if p.CLI != "CLAUDE" || p.Retries != 4 || p.Timeout != 120 {
+			t.Errorf("ProcessedNode = %+v, want node tag and metadata over document", p)
+		}
+	})
+	t.Run("no_validation_tag_wins", func(t *testing.T) {
+		n := &Node{Text: "X", Tags: []string{TagNoValidation}}
+		if p := NodeToProcessedNodeWithDefaults(n, settingsDefaults()); p.ValidatePrompt != "" {
+			t.Errorf("ValidatePrompt = %q, want empty", p.ValidatePrompt)
+		}
+	})
+	t.Run("undefined_document_vars_on_root", func(t *testing.T) {
+		d := settingsDefaults()
+		d.Vars = nil
+		n := &Node{Text: "X", Children: map[string]*Node{"": {Text: "Y"}}}
+		p := NodeToProcessedNodeWithDefaults(n, d)
+		if want := []string{"vars.repo"}; !reflect.DeepEqual(p.UndefinedVars, want) {
+			t.Errorf("root UndefinedVars = %v, want %v", p.UndefinedVars, want)
+		}
+		if len(p.Children[""].UndefinedVars) != 0 {
+			t.Errorf("child UndefinedVars = %v, want none", p.Children[""].UndefinedVars)
+		}
+	})
+}
+
+func TestCheckModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		cli     CLI
+		model   string
+		extra   []string
+		wantErr string
+	}{
+		{"empty_model", ClaudeCLI, "", nil, ""},
+		{"exact", ClaudeCLI, "haiku", nil, ""},
+		{"prefix", ClaudeCLI, "claude-sonnet-4-5", nil, ""},
+		{"unknown", ClaudeCLI, "gpt-5", nil, "add more with MODELS_CLAUDE"},
+		{"extra", ClaudeCLI, "my-proxy-model", []string{"my-proxy-*"}, ""},
+		{"any_model", AiderCLI, "ollama/llama3", nil, ""},
+		{"no_model_flag", QodoCLI, "gpt-5", nil, "does not support model selection"},
+		{"shell_metacharacters", AiderCLI, "x; rm -rf /", nil, "invalid model name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckModel(tt.cli, tt.model, tt.extra)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckModel = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckModel = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestKnownCLICodenames(t *testing.T) {
 	codenames := KnownCLICodenames()
 	for _, cli := range AllCLIs {
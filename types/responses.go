@@ -1,9 +1,6 @@
 package types
 
-import (
-	"encoding/json"
-	"strings"
-)
+import "encoding/json"
 
 // ProcessResponse holds the result of a process step.
 type ProcessResponse struct {
@@ -11,6 +8,8 @@ type ProcessResponse struct {
 	SecsTaken   float64  `json:"secs_taken"`
 	TokensUsed float64  `json:"tokens_used"`
 	Comments    []string `json:"comments"`
+	// Output is the node's structured result; present when the node declares an output_schema.
+	Output json.RawMessage `json:"output,omitempty"`
 }
 
 // DecisionResponse holds the result of a decision step.
@@ -28,57 +27,32 @@ type ValidationResponse struct {
 	Warnings          []string `json:"warnings"`
 }
 
-// parseJSONFromStdout unmarshals trimmed stdout into v; if that fails, strips markdown
-// code fences (```json ... ```) and tries again, then tries from last "{" to end.
-func parseJSONFromStdout(trimmed string, v interface{}) error {
-	try := trimmed
-	for _, prefix := range []string{"```json\n", "```json\r\n", "```\n", "```\r\n"} {
-		if strings.HasPrefix(try, prefix) {
-			try = try[len(prefix):]
-			break
-		}
-	}
-	if strings.HasSuffix(try, "```") {
-		try = strings.TrimSuffix(try, "```")
-		try = strings.TrimSpace(try)
-	}
-	if err := json.Unmarshal([]byte(try), v); err == nil {
-		return nil
-	}
-	start := strings.LastIndex(try, "{")
-	if start < 0 {
-		return json.Unmarshal([]byte(try), v)
-	}
-	return json.Unmarshal([]byte(try[start:]), v)
-}
-
 // ParseProcessResponse extracts and parses a ProcessResponse from CLI stdout.
+// The last JSON object in the output with a "completed" key is used.
 func ParseProcessResponse(stdout string) (ProcessResponse, error) {
 	var p ProcessResponse
-	trimmed := strings.TrimSpace(stdout)
-	if err := parseJSONFromStdout(trimmed, &p); err != nil {
+	if err := extractJSON(stdout, &p, "completed"); err != nil {
 		return p, err
 	}
 	return p, nil
 }
 
 // ParseDecisionResponse extracts and parses a DecisionResponse from CLI stdout.
+// The last JSON object in the output with an "answer" key is used.
 func ParseDecisionResponse(stdout string) (DecisionResponse, error) {
 	var d DecisionResponse
-	trimmed := strings.TrimSpace(stdout)
-	if err := parseJSONFromStdout(trimmed, &d); err != nil {
+	if err := extractJSON(stdout, &d, "answer"); err != nil {
 		return d, err
 	}
 	return d, nil
 }
 
 // ParseValidationResponse extracts and parses a ValidationResponse from CLI stdout.
-// It tries to unmarshal the trimmed output first; if that fails, it looks for the last
-// JSON object in the output (e.g. when the CLI echoes other text).
+// The last JSON object in the output with a "fully_completed" key is used, so echoed
+// text, fenced blocks, and other JSON printed before the answer are skipped.
 func ParseValidationResponse(stdout string) (ValidationResponse, error) {
 	var v ValidationResponse
-	trimmed := strings.TrimSpace(stdout)
-	if err := parseJSONFromStdout(trimmed, &v); err != nil {
+	if err := extractJSON(stdout, &v, "fully_completed"); err != nil {
 		return v, err
 	}
 	return v, nil
@@ -0,0 +1,223 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Input types accepted in a Document input declaration. An empty type means InputTypeString.
+const (
+	InputTypeString = "string"
+	InputTypeInt    = "int"
+	InputTypeNumber = "number"
+	InputTypeBool   = "bool"
+)
+
+// Input declares a tree parameter, referenced from node text and metadata as {{vars.<name>}}.
+// Values come from run-tree --var / --vars-file; Default is used when none is given.
+type Input struct {
+	Name        string  `json:"name"`
+	Type        string  `json:"type,omitempty"`
+	Default     *string `json:"default,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+}
+
+// ParseInputs parses the document "inputs" value: a JSON array of Input declarations.
+// Defaults may be written as JSON strings, numbers, or booleans.
+func ParseInputs(s string) ([]Input, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	var raw []struct {
+		Input
+		Default json.RawMessage `json:"default,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, fmt.Errorf("invalid inputs: %w", err)
+	}
+	out := make([]Input, 0, len(raw))
+	for _, r := range raw {
+		in := r.Input
+		in.Name = strings.TrimSpace(in.Name)
+		if !varNamePattern.MatchString(in.Name) {
+			return nil, fmt.Errorf("invalid input name %q", in.Name)
+		}
+		switch in.Type {
+		case "", InputTypeString, InputTypeInt, InputTypeNumber, InputTypeBool:
+		default:
+			return nil, fmt.Errorf("input %q: unknown type %q (want string, int, number, or bool)", in.Name, in.Type)
+		}
+		if len(r.Default) > 0 && string(r.Default) != "null" {
+			def, err := scalarString(r.Default)
+			if err != nil {
+				return nil, fmt.Errorf("input %q default: %w", in.Name, err)
+			}
+			in.Default = &def
+		}
+		out = append(out, in)
+	}
+	return out, nil
+}
+
+// ResolveVars applies input declarations to the given values: defaults fill missing values,
+// required inputs must be set, and typed inputs must parse. Given values without a declaration
+// are kept as-is. All problems are returned together.
+func ResolveVars(inputs []Input, given map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(given)+len(inputs))
+	for k, v := range given {
+		out[k] = v
+	}
+	var errs []error
+	for _, in := range inputs {
+		v, ok := out[in.Name]
+		if !ok && in.Default != nil {
+			v, ok = *in.Default, true
+			out[in.Name] = v
+		}
+		if !ok {
+			if in.Required {
+				errs = append(errs, fmt.Errorf("missing required input %q (set with --var %s=...)", in.Name, in.Name))
+			} else {
+				out[in.Name] = ""
+			}
+			continue
+		}
+		if err := checkInputType(in, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+func checkInputType(in Input, v string) error {
+	var err error
+	switch in.Type {
+	case InputTypeInt:
+		_, err = strconv.Atoi(strings.TrimSpace(v))
+	case InputTypeNumber:
+		_, err = strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case InputTypeBool:
+		_, err = strconv.ParseBool(strings.TrimSpace(v))
+	}
+	if err != nil {
+		return fmt.Errorf("input %q: %q is not a valid %s", in.Name, v, in.Type)
+	}
+	return nil
+}
+
+// ParseVarAssignment parses a --var value of the form KEY=VALUE.
+func ParseVarAssignment(s string) (string, string, error) {
+	key, value, ok := strings.Cut(s, "=")
+	key = strings.TrimSpace(key)
+	if !ok || !varNamePattern.MatchString(key) {
+		return "", "", fmt.Errorf("invalid variable %q: want KEY=VALUE", s)
+	}
+	return key, value, nil
+}
+
+// ParseVarsFile parses a --vars-file: either a JSON object with string, number, or boolean
+// values, or KEY=VALUE lines where blank lines and lines starting with # are ignored.
+func ParseVarsFile(data []byte) (map[string]string, error) {
+	text := strings.TrimSpace(string(data))
+	out := make(map[string]string)
+	if strings.HasPrefix(text, "{") {
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(text), &raw); err != nil {
+			return nil, fmt.Errorf("invalid vars file: %w", err)
+		}
+		for k, v := range raw {
+			s, err := scalarString(v)
+			if err != nil {
+				return nil, fmt.Errorf("vars file key %q: %w", k, err)
+			}
+			out[k] = s
+		}
+		return out, nil
+	}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, err := ParseVarAssignment(line)
+		if err != nil {
+			return nil, fmt.Errorf("vars file line %d: %w", i+1, err)
+		}
+		out[k] = strings.TrimSpace(v)
+	}
+	return out, nil
+}
+
+// scalarString returns a JSON string, number, or boolean as its plain text form.
+func scalarString(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+	switch v.(type) {
+	case float64, bool:
+		return strings.TrimSpace(string(raw)), nil
+	}
+	return "", fmt.Errorf("want a string, number, or boolean, got %s", raw)
+}
+
+var (
+	varNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+	// varRefPattern matches {{vars.name}} and {{env.NAME}}, with optional spaces inside the braces.
+	varRefPattern = regexp.MustCompile(`\{\{\s*(vars|env)\.([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+)
+
+// Interpolate replaces {{vars.name}} with vars[name] and {{env.NAME}} with the environment
+// variable NAME (looked up with lookupEnv, or os.LookupEnv when nil). References that cannot
+// be resolved are left in place and returned, sorted and de-duplicated, as "vars.name" or "env.NAME".
+func Interpolate(s string, vars map[string]string, lookupEnv func(string) (string, bool)) (string, []string) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+	var undefined []string
+	out := varRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := varRefPattern.FindStringSubmatch(ref)
+		var v string
+		var ok bool
+		if m[1] == "vars" {
+			v, ok = vars[m[2]]
+		} else {
+			v, ok = lookupEnv(m[2])
+		}
+		if !ok {
+			undefined = append(undefined, m[1]+"."+m[2])
+			return ref
+		}
+		return v
+	})
+	return out, uniqueSorted(undefined)
+}
+
+func uniqueSorted(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	sort.Strings(s)
+	out := s[:1]
+	for _, v := range s[1:] {
+		if v != out[len(out)-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
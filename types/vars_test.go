@@ -0,0 +1,90 @@
+package types
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := func(k string) (string, bool) {
+		if k == "HOME" {
+			return "/home/me", true
+		}
+		return "", false
+	}
+	vars := map[string]string{"ticket": "ABC-1"}
+	got, undefined := Interpolate("Fix {{vars.ticket}} in {{ env.HOME }}; {{vars.repo}} {{env.NOPE}} {{vars.repo}} {{other}}", vars, env)
+	if want := "Fix ABC-1 in /home/me; {{vars.repo}} {{env.NOPE}} {{vars.repo}} {{other}}"; got != want {
+		t.Errorf("Interpolate = %q, want %q", got, want)
+	}
+	if want := []string{"env.NOPE", "vars.repo"}; !reflect.DeepEqual(undefined, want) {
+		t.Errorf("undefined = %v, want %v", undefined, want)
+	}
+}
+
+func TestParseInputs(t *testing.T) {
+	inputs, err := ParseInputs(`[{"name":"ticket","required":true},{"name":"n","type":"int","default":2},{"name":"dry","type":"bool","default":"false"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != 3 || !inputs[0].Required || inputs[0].Default != nil || *inputs[1].Default != "2" || *inputs[2].Default != "false" {
+		t.Errorf("ParseInputs = %+v", inputs)
+	}
+	if _, err := ParseInputs(`[{"name":"x","type":"date"}]`); err == nil || !strings.Contains(err.Error(), "unknown type") {
+		t.Errorf("ParseInputs(bad type) err = %v", err)
+	}
+	if _, err := ParseInputs(`[{"name":"a b"}]`); err == nil {
+		t.Error("ParseInputs(bad name) err = nil")
+	}
+}
+
+func TestResolveVars(t *testing.T) {
+	two := "2"
+	inputs := []Input{
+		{Name: "ticket", Required: true},
+		{Name: "n", Type: InputTypeInt, Default: &two},
+		{Name: "note"},
+	}
+	t.Run("defaults_and_extra", func(t *testing.T) {
+		got, err := ResolveVars(inputs, map[string]string{"ticket": "T-1", "adhoc": "x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"ticket": "T-1", "n": "2", "note": "", "adhoc": "x"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ResolveVars = %v, want %v", got, want)
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		_, err := ResolveVars(inputs, map[string]string{"n": "two"})
+		if err == nil {
+			t.Fatal("ResolveVars err = nil")
+		}
+		for _, want := range []string{`missing required input "ticket"`, `"two" is not a valid int`} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("err = %v, want %q", err, want)
+			}
+		}
+	})
+}
+
+func TestParseVarsFile(t *testing.T) {
+	lines, err := ParseVarsFile([]byte("# comment\nticket=ABC-1\n\nrepo = api=v2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"ticket": "ABC-1", "repo": "api=v2"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("ParseVarsFile(lines) = %v, want %v", lines, want)
+	}
+	obj, err := ParseVarsFile([]byte(`{"ticket": "ABC-1", "n": 3, "dry": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"ticket": "ABC-1", "n": "3", "dry": "true"}; !reflect.DeepEqual(obj, want) {
+		t.Errorf("ParseVarsFile(json) = %v, want %v", obj, want)
+	}
+	if _, err := ParseVarsFile([]byte("novalue")); err == nil {
+		t.Error("ParseVarsFile(bad line) err = nil")
+	}
+}